@@ -1210,6 +1210,17 @@ func pathForBuildToolDep(ctx PathContext, path string) toolDepPath {
 	return toolDepPath{basePath{path, ""}}
 }
 
+// PathForArbitraryInput returns a Path for an input file given outside of the Android.bp files,
+// e.g. in an environment variable.  It may be an absolute path or a path relative to the top of
+// the tree, and may be in the output directory, e.g. a file written by a previous build.  It is
+// not validated to be in the source tree, so it must not be used for paths from Android.bp files.
+func PathForArbitraryInput(ctx PathContext, path string) Path {
+	if strings.Contains(path, "$") {
+		ReportPathErrorf(ctx, "Path contains invalid character($): %s", path)
+	}
+	return toolDepPath{basePath{filepath.Clean(path), ""}}
+}
+
 // PathForOutput joins the provided paths and returns an OutputPath that is
 // validated to not escape the build dir.
 // On error, it will return a usable, but invalid OutputPath, and report a ModuleError.
@@ -22,6 +22,12 @@ import (
 
 var phonyMapOnceKey = NewOnceKey("phony")
 
+// PrepareForTestWithPhony registers the singleton that writes the phony rules, so that tests can
+// check the dependencies of a phony target with SingletonForTests("phony").Output(name).
+var PrepareForTestWithPhony = FixtureRegisterWithContext(func(ctx RegistrationContext) {
+	ctx.RegisterSingletonType("phony", phonySingletonFactory)
+})
+
 type phonyMap map[string]Paths
 
 var phonyMapLock sync.Mutex
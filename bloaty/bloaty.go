@@ -14,9 +14,16 @@
 
 // Package bloaty implements a singleton that measures binary (e.g. ELF
 // executable, shared library or Rust rlib) section sizes at build time.
+//
+// It also lets modules check the section sizes of their binaries against a
+// budget, and reports the files that grew the most compared to the sizes
+// measured by a previous build.
 package bloaty
 
 import (
+	"strconv"
+	"strings"
+
 	"android/soong/android"
 
 	"github.com/google/blueprint"
@@ -24,6 +31,12 @@ import (
 
 const bloatyDescriptorExt = ".bloaty.csv"
 const protoFilename = "binary_sizes.pb.gz"
+const growthReportFilename = "binary_sizes_growth.txt"
+
+// Environment variable pointing to the binary_sizes.pb.gz of a previous build.
+// When set, the files that grew the most since that build are reported in
+// binary_sizes_growth.txt.
+const envVariableBaseline = "SOONG_BLOATY_BASELINE"
 
 var (
 	fileSizeMeasurerKey blueprint.ProviderKey
@@ -45,12 +58,32 @@ var (
 			Rspfile:        "${out}.lst",
 			RspfileContent: "${in}",
 		})
+
+	// bloatyBudget measures a binary section sizes and verifies them against
+	// a budget.
+	bloatyBudget = pctx.AndroidStaticRule("bloatyBudget",
+		blueprint.RuleParams{
+			Command: "${bloaty} -n 0 --csv ${in} > ${out}.csv && " +
+				"${bloatyBudgetCheck} --name ${in} ${budgetFlags} ${out}.csv && " +
+				"touch ${out}",
+			CommandDeps: []string{"${bloaty}", "${bloatyBudgetCheck}"},
+		}, "budgetFlags")
+
+	// bloatyDiff reports the files that grew the most between two protobufs
+	// created by the bloaty merger.
+	bloatyDiff = pctx.AndroidStaticRule("bloatyDiff",
+		blueprint.RuleParams{
+			Command:     "${bloatyDiffCmd} ${baseline} ${in} > ${out}",
+			CommandDeps: []string{"${bloatyDiffCmd}"},
+		}, "baseline")
 )
 
 func init() {
 	pctx.VariableConfigMethod("hostPrebuiltTag", android.Config.PrebuiltOS)
 	pctx.SourcePathVariable("bloaty", "prebuilts/build-tools/${hostPrebuiltTag}/bin/bloaty")
 	pctx.HostBinToolVariable("bloatyMerger", "bloaty_merger")
+	pctx.HostBinToolVariable("bloatyBudgetCheck", "bloaty_budget")
+	pctx.HostBinToolVariable("bloatyDiffCmd", "bloaty_diff")
 	android.RegisterSingletonType("file_metrics", fileSizesSingleton)
 	fileSizeMeasurerKey = blueprint.NewProvider(measuredFiles{})
 }
@@ -76,7 +109,58 @@ func MeasureSizeForPaths(ctx android.ModuleContext, paths ...android.OptionalPat
 	ctx.SetProvider(fileSizeMeasurerKey, mf)
 }
 
-type sizesSingleton struct{}
+// SizeBudget contains the maximum section sizes of a binary.
+type SizeBudget struct {
+	// Maximum size in bytes of the code (.text section) in the file.
+	Text *int64
+
+	// Maximum size in bytes of the data (.data, .data.rel.ro, .bss, .tdata and
+	// .tbss sections) once loaded in memory.
+	Data *int64
+
+	// Maximum size in bytes of the file.
+	Total *int64
+}
+
+func (b SizeBudget) flags() []string {
+	var flags []string
+	if b.Text != nil {
+		flags = append(flags, "--text "+strconv.FormatInt(*b.Text, 10))
+	}
+	if b.Data != nil {
+		flags = append(flags, "--data "+strconv.FormatInt(*b.Data, 10))
+	}
+	if b.Total != nil {
+		flags = append(flags, "--total "+strconv.FormatInt(*b.Total, 10))
+	}
+	return flags
+}
+
+// CheckSizeBudget registers a build statement verifying that the section
+// sizes of path fit within budget. It returns the path of the timestamp file
+// of the check, meant to be used as a validation of a rule that builds path,
+// or nil if the budget is empty.
+func CheckSizeBudget(ctx android.ModuleContext, path android.Path, budget SizeBudget) android.WritablePath {
+	flags := budget.flags()
+	if len(flags) == 0 {
+		return nil
+	}
+	timestamp := android.PathForModuleOut(ctx, "size_budget", path.Base()+".timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        bloatyBudget,
+		Description: "size budget " + path.Base(),
+		Input:       path,
+		Output:      timestamp,
+		Args: map[string]string{
+			"budgetFlags": strings.Join(flags, " "),
+		},
+	})
+	return timestamp
+}
+
+type sizesSingleton struct {
+	growthReport android.WritablePath
+}
 
 func fileSizesSingleton() android.Singleton {
 	return &sizesSingleton{}
@@ -102,13 +186,35 @@ func (singleton *sizesSingleton) GenerateBuildActions(ctx android.SingletonConte
 		}
 	})
 
+	proto := android.PathForOutput(ctx, protoFilename)
 	ctx.Build(pctx, android.BuildParams{
 		Rule:   bloatyMerger,
 		Inputs: android.SortedUniquePaths(deps),
-		Output: android.PathForOutput(ctx, protoFilename),
+		Output: proto,
 	})
+
+	if env := ctx.Config().Getenv(envVariableBaseline); env != "" {
+		// The baseline is an input, so that the report is updated when it changes. It may be an
+		// absolute path, e.g. to the binary_sizes.pb.gz of another build, or a path relative to
+		// the top of the tree.
+		baseline := android.PathForArbitraryInput(ctx, env)
+		singleton.growthReport = android.PathForOutput(ctx, growthReportFilename)
+		ctx.Build(pctx, android.BuildParams{
+			Rule:        bloatyDiff,
+			Description: "bloaty diff " + env,
+			Input:       proto,
+			Implicit:    baseline,
+			Output:      singleton.growthReport,
+			Args: map[string]string{
+				"baseline": baseline.String(),
+			},
+		})
+	}
 }
 
 func (singleton *sizesSingleton) MakeVars(ctx android.MakeVarsContext) {
 	ctx.DistForGoalWithFilename("checkbuild", android.PathForOutput(ctx, protoFilename), protoFilename)
+	if singleton.growthReport != nil {
+		ctx.DistForGoalWithFilename("checkbuild", singleton.growthReport, growthReportFilename)
+	}
 }
@@ -0,0 +1,91 @@
+# Copyright 2021 Google Inc. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Bloaty Size Budget Checker
+
+Verifies that the section sizes measured by Bloaty for a binary fit within a
+budget. It takes a Bloaty CSV file and the budget as arguments. For instance:
+
+    $ bloaty_budget --name libfoo.so --text 4096 --total 8192 libfoo.so.csv
+
+"""
+
+import argparse
+import csv
+import sys
+
+# Sections accounted for in the code size, as stored in the file.
+TEXT_SECTIONS = frozenset([".text"])
+
+# Sections accounted for in the data size, as loaded in memory.
+DATA_SECTIONS = frozenset([".data", ".data.rel.ro", ".bss", ".tdata", ".tbss"])
+
+
+def measure(path):
+    """Computes the text, data and total sizes from a Bloaty CSV file.
+
+    Args:
+      path: The filepath to the CSV file.
+
+    Returns:
+      A dictionary with the "text", "data" and "total" sizes in bytes.
+    """
+    sizes = {"text": 0, "data": 0, "total": 0}
+    with open(path, newline='') as csv_file:
+        for row in csv.DictReader(csv_file):
+            if row["sections"] in TEXT_SECTIONS:
+                sizes["text"] += int(row["filesize"])
+            if row["sections"] in DATA_SECTIONS:
+                sizes["data"] += int(row["vmsize"])
+            sizes["total"] += int(row["filesize"])
+    return sizes
+
+
+def check_budget(sizes, budget):
+    """Compares the measured sizes to the budget.
+
+    Args:
+      sizes: The measured sizes, as returned by measure.
+      budget: A dictionary of the maximum sizes. Missing or None entries are
+          not checked.
+
+    Returns:
+      A list of error messages, empty if the sizes fit within the budget.
+    """
+    errors = []
+    for kind in ("text", "data", "total"):
+        limit = budget.get(kind)
+        if limit is not None and sizes[kind] > limit:
+            errors.append("%s size %d exceeds budget %d by %d bytes" %
+                          (kind, sizes[kind], limit, sizes[kind] - limit))
+    return errors
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--name", default="", help="Name of the binary.")
+    parser.add_argument("--text", type=int, help="Maximum code size.")
+    parser.add_argument("--data", type=int, help="Maximum data size.")
+    parser.add_argument("--total", type=int, help="Maximum file size.")
+    parser.add_argument("csv", help="Bloaty csv file of the binary.")
+    args = parser.parse_args()
+    budget = {"text": args.text, "data": args.data, "total": args.total}
+    errors = check_budget(measure(args.csv), budget)
+    for error in errors:
+        print("error: %s: size_budget: %s" % (args.name, error), file=sys.stderr)
+    if errors:
+        sys.exit(1)
+
+
+if __name__ == '__main__':
+    main()
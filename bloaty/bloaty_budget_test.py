@@ -0,0 +1,49 @@
+# Copyright 2021 Google Inc. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+import unittest
+
+# pylint: disable=import-error
+from pyfakefs import fake_filesystem_unittest
+
+import bloaty_budget
+
+
+class BloatyBudgetTestCase(fake_filesystem_unittest.TestCase):
+    def setUp(self):
+        self.setUpPyfakefs()
+
+    def test_measure(self):
+        csv_content = ("sections,vmsize,filesize\n.text,10,12\n.data,4,4\n"
+                       ".bss,8,0\n.rodata,6,6\n")
+        self.fs.create_file("file1.csv", contents=csv_content)
+        sizes = bloaty_budget.measure("file1.csv")
+        self.assertEqual(sizes, {"text": 12, "data": 12, "total": 22})
+
+    def test_within_budget(self):
+        sizes = {"text": 12, "data": 12, "total": 22}
+        budget = {"text": 12, "data": None, "total": 100}
+        self.assertEqual(bloaty_budget.check_budget(sizes, budget), [])
+
+    def test_over_budget(self):
+        sizes = {"text": 12, "data": 12, "total": 22}
+        budget = {"text": 10, "data": 20, "total": 20}
+        errors = bloaty_budget.check_budget(sizes, budget)
+        self.assertEqual(len(errors), 2)
+        self.assertIn("text size 12 exceeds budget 10 by 2 bytes", errors)
+        self.assertIn("total size 22 exceeds budget 20 by 2 bytes", errors)
+
+
+if __name__ == '__main__':
+    suite = unittest.TestLoader().loadTestsFromTestCase(BloatyBudgetTestCase)
+    unittest.TextTestRunner(verbosity=2).run(suite)
@@ -0,0 +1,81 @@
+# Copyright 2021 Google Inc. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""Bloaty Size Diff
+
+Compares two protobufs generated by bloaty_merger and reports the files that
+grew the most. For instance:
+
+    $ bloaty_diff --top 20 old/binary_sizes.pb.gz binary_sizes.pb.gz
+
+"""
+
+import argparse
+import gzip
+
+import file_sections_pb2
+
+
+def load_sizes(path):
+    """Loads the file sizes from a FileSizeMetrics protobuf.
+
+    Args:
+      path: The path to the gzipped protobuf.
+
+    Returns:
+      A dictionary from the file path to its size in bytes.
+    """
+    metrics = file_sections_pb2.FileSizeMetrics()
+    with gzip.open(path, "rb") as input_proto:
+        metrics.ParseFromString(input_proto.read())
+    return {f.path: sum(s.file_size for s in f.sections) for f in metrics.files}
+
+
+def top_growers(old_sizes, new_sizes, top):
+    """Computes the files that grew the most.
+
+    Files that are not present in the old sizes are considered to have grown
+    from 0.
+
+    Args:
+      old_sizes: The sizes of the previous build, as returned by load_sizes.
+      new_sizes: The sizes of the current build, as returned by load_sizes.
+      top: The maximum number of files to return.
+
+    Returns:
+      A list of (path, old size, new size) tuples, sorted by decreasing growth.
+    """
+    growers = []
+    for path, new_size in new_sizes.items():
+        old_size = old_sizes.get(path, 0)
+        if new_size > old_size:
+            growers.append((path, old_size, new_size))
+    growers.sort(key=lambda g: (g[1] - g[2], g[0]))
+    return growers[:top]
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--top", type=int, default=50,
+                        help="Number of files to report.")
+    parser.add_argument("old_proto", help="Proto of the previous build.")
+    parser.add_argument("new_proto", help="Proto of the current build.")
+    args = parser.parse_args()
+    growers = top_growers(load_sizes(args.old_proto),
+                          load_sizes(args.new_proto), args.top)
+    for path, old_size, new_size in growers:
+        print("%+d\t%d\t%d\t%s" % (new_size - old_size, old_size, new_size, path))
+
+
+if __name__ == '__main__':
+    main()
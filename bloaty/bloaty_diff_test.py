@@ -0,0 +1,33 @@
+# Copyright 2021 Google Inc. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+import unittest
+
+import bloaty_diff
+
+
+class BloatyDiffTestCase(unittest.TestCase):
+    def test_top_growers(self):
+        old_sizes = {"file1": 10, "file2": 10, "file3": 10}
+        new_sizes = {"file1": 15, "file2": 5, "file3": 30, "file4": 3}
+        growers = bloaty_diff.top_growers(old_sizes, new_sizes, 2)
+        self.assertEqual(growers, [("file3", 10, 30), ("file1", 10, 15)])
+
+    def test_new_files(self):
+        growers = bloaty_diff.top_growers({}, {"file1": 3}, 10)
+        self.assertEqual(growers, [("file1", 0, 3)])
+
+
+if __name__ == '__main__':
+    suite = unittest.TestLoader().loadTestsFromTestCase(BloatyDiffTestCase)
+    unittest.TextTestRunner(verbosity=2).run(suite)
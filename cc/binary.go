@@ -20,6 +20,7 @@ import (
 	"github.com/google/blueprint"
 
 	"android/soong/android"
+	"android/soong/bloaty"
 )
 
 type BinaryLinkerProperties struct {
@@ -401,6 +402,16 @@ func (binary *binaryDecorator) link(ctx ModuleContext,
 		validations = append(validations, verifyFile)
 	}
 
+	if sizeBudgetCheck := bloaty.CheckSizeBudget(ctx, ret, binary.baseLinker.Properties.Size_budget); sizeBudgetCheck != nil {
+		validations = append(validations, sizeBudgetCheck)
+	}
+
+	if Bool(binary.baseLinker.Properties.Check_duplicate_static_symbols) {
+		if check := checkDuplicateStaticSymbolsValidation(ctx, objs.objFiles, deps); check != nil {
+			validations = append(validations, check)
+		}
+	}
+
 	var sharedLibs android.Paths
 	// Ignore shared libs for static executables.
 	if !binary.static() {
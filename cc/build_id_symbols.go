@@ -0,0 +1,147 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// This file collects the debug info of the installed native binaries and shared libraries into a
+// symbol store indexed by GNU build-id, as expected by debuginfod-like crash tooling. The store is
+// a zip file laid out as .build-id/xx/yyyy.debug, where xxyyyy is the build-id of the binary, and
+// comes with a manifest mapping each build-id to the module that produced it. Both are built by
+// the symbols-build-id goal and copied to the dist directory.
+
+func init() {
+	pctx.SourcePathVariable("splitDebugInfoPath", "build/soong/scripts/split_debug_info.sh")
+	android.RegisterSingletonType("build_id_symbols", buildIdSymbolsSingletonFactory)
+}
+
+const (
+	buildIdSymbolsGoal         = "symbols-build-id"
+	buildIdSymbolsZipName      = "symbols-build-id.zip"
+	buildIdSymbolsManifestName = "symbols-build-id-manifest.txt"
+)
+
+var (
+	// Rule to extract the debug info of an unstripped binary into a zip laid out as a .build-id
+	// tree.
+	splitDebugInfo = pctx.AndroidStaticRule("splitDebugInfo",
+		blueprint.RuleParams{
+			Command: "CLANG_BIN=${config.ClangBin} SOONG_ZIP=${SoongZipCmd} $splitDebugInfoPath " +
+				"-i ${in} -o ${out} -m ${manifest} -n ${module} -f ${installed}",
+			CommandDeps: []string{"$splitDebugInfoPath", "${SoongZipCmd}"},
+		},
+		"manifest", "module", "installed")
+
+	BuildIdSymbolsInfoProvider = blueprint.NewProvider(BuildIdSymbolsInfo{})
+)
+
+// BuildIdSymbolsInfo contains the debug info of a binary laid out as a .build-id tree.
+type BuildIdSymbolsInfo struct {
+	// Zip file containing the .build-id/xx/yyyy.debug file of the binary.
+	SymbolsZip android.Path
+
+	// File containing the "<build-id> <module> <installed file>" line of the binary.
+	Manifest android.Path
+}
+
+// SplitDebugInfoByBuildId registers a build statement extracting the debug info of an unstripped
+// binary or shared library into the symbol store indexed by build-id. The manifest records the
+// path the binary is installed to, on the device for device modules. It must only be called once
+// per module, for modules that are installed.
+func SplitDebugInfoByBuildId(ctx android.ModuleContext, unstrippedFile android.Path, installedFile android.InstallPath) {
+	if ctx.Darwin() || ctx.Windows() {
+		return
+	}
+
+	installed := installedFile.String()
+	if ctx.Device() {
+		installed = android.InstallPathToOnDevicePath(ctx, installedFile)
+	}
+
+	symbolsZip := android.PathForModuleOut(ctx, "build_id_symbols", unstrippedFile.Base()+".zip")
+	manifest := android.PathForModuleOut(ctx, "build_id_symbols", unstrippedFile.Base()+".txt")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           splitDebugInfo,
+		Description:    "split debug info " + unstrippedFile.Base(),
+		Input:          unstrippedFile,
+		Output:         symbolsZip,
+		ImplicitOutput: manifest,
+		Args: map[string]string{
+			"manifest":  manifest.String(),
+			"module":    ctx.ModuleName(),
+			"installed": installed,
+		},
+	})
+
+	ctx.SetProvider(BuildIdSymbolsInfoProvider, BuildIdSymbolsInfo{
+		SymbolsZip: symbolsZip,
+		Manifest:   manifest,
+	})
+}
+
+func buildIdSymbolsSingletonFactory() android.Singleton {
+	return &buildIdSymbolsSingleton{}
+}
+
+type buildIdSymbolsSingleton struct {
+	symbolsZip android.WritablePath
+	manifest   android.WritablePath
+}
+
+func (s *buildIdSymbolsSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var symbolsZips, manifests android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled() || !ctx.ModuleHasProvider(module, BuildIdSymbolsInfoProvider) {
+			return
+		}
+		info := ctx.ModuleProvider(module, BuildIdSymbolsInfoProvider).(BuildIdSymbolsInfo)
+		symbolsZips = append(symbolsZips, info.SymbolsZip)
+		manifests = append(manifests, info.Manifest)
+	})
+
+	if len(symbolsZips) == 0 {
+		return
+	}
+
+	s.symbolsZip = android.PathForOutput(ctx, buildIdSymbolsGoal, buildIdSymbolsZipName)
+	s.manifest = android.PathForOutput(ctx, buildIdSymbolsGoal, buildIdSymbolsManifestName)
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	// The same binary may be installed more than once, e.g. in an APEX and in the system
+	// partition, in which case it contributes the same .build-id entry several times.
+	rule.Command().
+		BuiltTool("merge_zips").
+		Flag("--ignore-duplicates").
+		Output(s.symbolsZip).
+		FlagWithRspFileInputList("@", android.PathForOutput(ctx, buildIdSymbolsGoal, "zips.rsp"), symbolsZips)
+	rule.Command().
+		Text("xargs cat <").
+		FlagWithRspFileInputList("", android.PathForOutput(ctx, buildIdSymbolsGoal, "manifests.rsp"), manifests).
+		Text("| sort -u >").Output(s.manifest)
+	rule.Build("build_id_symbols", "build-id symbol store")
+
+	ctx.Phony(buildIdSymbolsGoal, s.symbolsZip, s.manifest)
+}
+
+func (s *buildIdSymbolsSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.symbolsZip == nil {
+		return
+	}
+	ctx.DistForGoal(buildIdSymbolsGoal, s.symbolsZip, s.manifest)
+}
@@ -285,6 +285,25 @@ var (
 		},
 		"extraFlags", "referenceDump", "libName", "arch", "createReferenceDumpFlags")
 
+	// Rule to compare linked sAbi dump files (.ldump) against a reference dump that is checked in
+	// next to the module through header_abi_checker.reference_dump.
+	sAbiDiffModuleRef = pctx.AndroidStaticRule("sAbiDiffModuleRef",
+		blueprint.RuleParams{
+			Command: "($sAbiDiffer ${extraFlags} -lib ${libName} -arch ${arch} -o ${out} -new ${in} -old ${referenceDump})" +
+				" || (echo 'error: Please update ABI references with: m ${updateTarget}'" +
+				" && (mkdir -p $$DIST_DIR/abidiffs && cp ${out} $$DIST_DIR/abidiffs/)" +
+				" && exit 1)",
+			CommandDeps: []string{"$sAbiDiffer"},
+		},
+		"extraFlags", "referenceDump", "libName", "arch", "updateTarget")
+
+	// Rule to overwrite a reference dump checked in next to the module with a linked sAbi dump.
+	updateRefSAbiDump = pctx.AndroidStaticRule("updateRefSAbiDump",
+		blueprint.RuleParams{
+			Command: "mkdir -p $$(dirname ${referenceDump}) && ${writeCmd} $in > ${referenceDump} && touch ${out}",
+		},
+		"referenceDump", "writeCmd")
+
 	// Rule to unzip a reference abi dump.
 	unzipRefSAbiDump = pctx.AndroidStaticRule("unzipRefSAbiDump",
 		blueprint.RuleParams{
@@ -922,6 +941,71 @@ func sourceAbiDiff(ctx android.ModuleContext, inputDump android.Path, referenceD
 	return android.OptionalPathForPath(outputFile)
 }
 
+// sourceAbiDiffWithModuleRefDump registers a build statement to compare a linked sAbi dump file
+// (.ldump) against a reference dump provided by the module's header_abi_checker.reference_dump.
+func sourceAbiDiffWithModuleRefDump(ctx android.ModuleContext, inputDump android.Path, referenceDump android.Path,
+	baseName, exportedHeaderFlags string, checkAllApis bool, diffFlags []string,
+	updateTarget string) android.OptionalPath {
+
+	outputFile := android.PathForModuleOut(ctx, baseName+".abidiff")
+	libName := strings.TrimSuffix(baseName, filepath.Ext(baseName))
+
+	var extraFlags []string
+	if checkAllApis {
+		extraFlags = append(extraFlags, "-check-all-apis")
+	} else {
+		extraFlags = append(extraFlags,
+			"-allow-unreferenced-changes",
+			"-allow-unreferenced-elf-symbol-changes")
+	}
+
+	if exportedHeaderFlags == "" {
+		extraFlags = append(extraFlags, "-advice-only")
+	}
+	extraFlags = append(extraFlags, diffFlags...)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        sAbiDiffModuleRef,
+		Description: "header-abi-diff " + outputFile.Base(),
+		Output:      outputFile,
+		Input:       inputDump,
+		Implicit:    referenceDump,
+		Args: map[string]string{
+			"referenceDump": referenceDump.String(),
+			"libName":       libName,
+			"arch":          ctx.Arch().ArchType.Name,
+			"extraFlags":    strings.Join(extraFlags, " "),
+			"updateTarget":  updateTarget,
+		},
+	})
+	return android.OptionalPathForPath(outputFile)
+}
+
+// updateModuleRefDump registers a build statement to overwrite the reference dump at refDumpPath,
+// relative to the source root, with a linked sAbi dump file. The reference dump is gzipped if
+// refDumpPath ends with ".gz".
+func updateModuleRefDump(ctx android.ModuleContext, inputDump android.Path, refDumpPath,
+	baseName string) android.Path {
+
+	timestampFile := android.PathForModuleOut(ctx, baseName+"_update_ref_dump.timestamp")
+	writeCmd := "cat"
+	if strings.HasSuffix(refDumpPath, ".gz") {
+		// -n leaves the name and the timestamp of the input out of the checked in dump.
+		writeCmd = "gzip -cn"
+	}
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        updateRefSAbiDump,
+		Description: "update reference ABI dump " + refDumpPath,
+		Output:      timestampFile,
+		Input:       inputDump,
+		Args: map[string]string{
+			"referenceDump": refDumpPath,
+			"writeCmd":      writeCmd,
+		},
+	})
+	return timestampFile
+}
+
 // Generate a rule for extracting a table of contents from a shared library (.so)
 func transformSharedObjectToToc(ctx android.ModuleContext, inputFile android.Path,
 	outputFile android.WritablePath, flags builderFlags) {
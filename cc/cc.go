@@ -1889,6 +1889,17 @@ func (c *Module) maybeInstall(ctx ModuleContext, apexInfo android.ApexInfo) {
 		if ctx.Failed() {
 			return
 		}
+
+		// The binaries of cc_test and cc_benchmark are included along with the other binaries.
+		if !c.IsSkipInstall() && !c.IsHideFromMake() && (c.Binary() || c.testBinary() || c.Shared()) {
+			if installer, ok := c.installer.(interface {
+				installedPath() android.InstallPath
+			}); ok && installer.installedPath() != (android.InstallPath{}) {
+				if unstripped := c.UnstrippedOutputFile(); unstripped != nil {
+					SplitDebugInfoByBuildId(ctx, unstripped, installer.installedPath())
+				}
+			}
+		}
 	}
 }
 
@@ -4019,3 +4019,47 @@ func TestIncludeDirectoryOrdering(t *testing.T) {
 
 	android.AssertArrayString(t, "includes", want, includes)
 }
+
+func TestSplitDebugInfoByBuildId(t *testing.T) {
+	ctx := testCc(t, `
+		cc_binary {
+			name: "foo",
+			srcs: ["foo.c"],
+		}
+
+		cc_library_static {
+			name: "libbar",
+			srcs: ["bar.c"],
+		}
+
+		cc_test {
+			name: "footest",
+			srcs: ["foo.c"],
+			gtest: false,
+		}
+
+		cc_benchmark {
+			name: "foobench",
+			srcs: ["foo.c"],
+		}`)
+
+	foo := ctx.ModuleForTests("foo", "android_arm64_armv8-a")
+	symbols := foo.Output("build_id_symbols/foo.zip")
+	android.AssertPathRelativeToTopEquals(t, "unstripped input",
+		"out/soong/.intermediates/foo/android_arm64_armv8-a/unstripped/foo", symbols.Input)
+	android.AssertStringEquals(t, "module name", "foo", symbols.Args["module"])
+	android.AssertStringEquals(t, "installed file", "/system/bin/foo", symbols.Args["installed"])
+
+	footest := ctx.ModuleForTests("footest", "android_arm64_armv8-a").Output("build_id_symbols/footest.zip")
+	android.AssertStringEquals(t, "test installed file", "/data/nativetest64/footest/footest",
+		footest.Args["installed"])
+
+	foobench := ctx.ModuleForTests("foobench", "android_arm64_armv8-a").Output("build_id_symbols/foobench.zip")
+	android.AssertStringEquals(t, "benchmark installed file", "/data/benchmarktest64/foobench/foobench",
+		foobench.Args["installed"])
+
+	libbar := ctx.ModuleForTests("libbar", "android_arm64_armv8-a_static")
+	if libbar.MaybeOutput("build_id_symbols/libbar.a.zip").Rule != nil {
+		t.Errorf("unexpected debug info split for static library")
+	}
+}
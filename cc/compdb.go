@@ -19,6 +19,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"android/soong/android"
@@ -30,6 +31,13 @@ import (
 // at ${OUT_DIR}/soong/development/ide/compdb/compile_commands.json. It will also symlink it
 // to ${SOONG_LINK_COMPDB_TO} if set. In general this should be created by running
 // make SOONG_GEN_COMPDB=1 nothing to get all targets.
+//
+// By default a source file compiled by several variants of a module (arch,
+// image, apex, sanitizer...) is only described once. SOONG_GEN_COMPDB_ARCH and
+// SOONG_GEN_COMPDB_IMAGE restrict the entries to the variants built for the given
+// arch and image, and SOONG_GEN_COMPDB_ALL_VARIANTS keeps one entry per variant.
+// The compdb-generated-sources phony target builds every generated source and
+// header the entries depend on.
 
 func init() {
 	android.RegisterSingletonType("compdb_generator", compDBGeneratorSingleton)
@@ -49,8 +57,36 @@ const (
 	envVariableGenerateCompdb          = "SOONG_GEN_COMPDB"
 	envVariableGenerateCompdbDebugInfo = "SOONG_GEN_COMPDB_DEBUG"
 	envVariableCompdbLink              = "SOONG_LINK_COMPDB_TO"
+	envVariableCompdbArch              = "SOONG_GEN_COMPDB_ARCH"
+	envVariableCompdbImage             = "SOONG_GEN_COMPDB_IMAGE"
+	envVariableCompdbAllVariants       = "SOONG_GEN_COMPDB_ALL_VARIANTS"
+
+	// Phony target that builds the generated sources and headers needed by the compdb entries.
+	CompdbGeneratedSourcesPhony = "compdb-generated-sources"
 )
 
+// CompdbEnabled returns true if the compilation database should be generated.
+func CompdbEnabled(config android.Config) bool {
+	return config.IsEnvTrue(envVariableGenerateCompdb)
+}
+
+// CompdbOutputDir returns the directory the compilation database is written to.
+func CompdbOutputDir(ctx android.PathContext) android.OutputPath {
+	return android.PathForOutput(ctx, compdbOutputProjectsDirectory)
+}
+
+// CompdbVariantSelected returns true if the given module variant matches the arch and image
+// selected through SOONG_GEN_COMPDB_ARCH and SOONG_GEN_COMPDB_IMAGE.
+func CompdbVariantSelected(config android.Config, module LinkableInterface) bool {
+	if arch := config.Getenv(envVariableCompdbArch); arch != "" && module.Target().Arch.ArchType.Name != arch {
+		return false
+	}
+	if image := config.Getenv(envVariableCompdbImage); image != "" && string(GetImageVariantType(module)) != image {
+		return false
+	}
+	return true
+}
+
 // A compdb entry. The compile_commands.json file is a list of these.
 type compDbEntry struct {
 	Directory string   `json:"directory"`
@@ -60,39 +96,58 @@ type compDbEntry struct {
 }
 
 func (c *compdbGeneratorSingleton) GenerateBuildActions(ctx android.SingletonContext) {
-	if !ctx.Config().IsEnvTrue(envVariableGenerateCompdb) {
+	if !CompdbEnabled(ctx.Config()) {
 		return
 	}
 
 	// Instruct the generator to indent the json file for easier debugging.
 	outputCompdbDebugInfo := ctx.Config().IsEnvTrue(envVariableGenerateCompdbDebugInfo)
+	allVariants := ctx.Config().IsEnvTrue(envVariableCompdbAllVariants)
 
-	// We only want one entry per file. We don't care what module/isa it's from
+	// Unless all variants are requested we only want one entry per file. We don't care what
+	// module/isa it's from as long as it matches the selected variant.
 	m := make(map[string]compDbEntry)
+	var generatedDeps android.Paths
 	ctx.VisitAllModules(func(module android.Module) {
 		if ccModule, ok := module.(*Module); ok {
+			if !ccModule.Enabled() || !CompdbVariantSelected(ctx.Config(), ccModule) {
+				return
+			}
 			if compiledModule, ok := ccModule.compiler.(CompiledInterface); ok {
-				generateCompdbProject(compiledModule, ctx, ccModule, m)
+				key := ""
+				if allVariants {
+					key = ctx.ModuleSubDir(module)
+				}
+				if generateCompdbProject(compiledModule, ctx, ccModule, key, m) {
+					if genDeps, ok := ccModule.compiler.(compiledGeneratedDepsInterface); ok {
+						generatedDeps = append(generatedDeps, genDeps.GeneratedDeps()...)
+					}
+				}
 			}
 		}
 	})
 
+	ctx.Phony(CompdbGeneratedSourcesPhony, android.FirstUniquePaths(generatedDeps)...)
+
 	// Create the output file.
-	dir := android.PathForOutput(ctx, compdbOutputProjectsDirectory)
-	os.MkdirAll(filepath.Join(android.AbsSrcDirForExistingUseCases(), dir.String()), 0777)
+	dir := CompdbOutputDir(ctx)
+	if err := android.CreateOutputDirIfNonexistent(dir, 0777); err != nil {
+		log.Fatalf("Could not create directory %s: %s", dir, err)
+	}
 	compDBFile := dir.Join(ctx, compdbFilename)
-	f, err := os.Create(filepath.Join(android.AbsSrcDirForExistingUseCases(), compDBFile.String()))
-	if err != nil {
-		log.Fatalf("Could not create file %s: %s", compDBFile, err)
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	defer f.Close()
+	sort.Strings(keys)
 
 	v := make([]compDbEntry, 0, len(m))
-
-	for _, value := range m {
-		v = append(v, value)
+	for _, key := range keys {
+		v = append(v, m[key])
 	}
 	var dat []byte
+	var err error
 	if outputCompdbDebugInfo {
 		dat, err = json.MarshalIndent(v, "", " ")
 	} else {
@@ -101,7 +156,9 @@ func (c *compdbGeneratorSingleton) GenerateBuildActions(ctx android.SingletonCon
 	if err != nil {
 		log.Fatalf("Failed to marshal: %s", err)
 	}
-	f.Write(dat)
+	if err := android.WriteFileToOutputDir(compDBFile, dat, 0666); err != nil {
+		log.Fatalf("Could not write file %s: %s", compDBFile, err)
+	}
 
 	if finalLinkDir := ctx.Config().Getenv(envVariableCompdbLink); finalLinkDir != "" {
 		finalLinkPath := filepath.Join(finalLinkDir, compdbFilename)
@@ -168,10 +225,21 @@ func getArguments(src android.Path, ctx android.SingletonContext, ccModule *Modu
 	return args
 }
 
-func generateCompdbProject(compiledModule CompiledInterface, ctx android.SingletonContext, ccModule *Module, builds map[string]compDbEntry) {
+// compiledGeneratedDepsInterface is implemented by compilers that can report the generated sources
+// and headers their compile actions depend on.
+type compiledGeneratedDepsInterface interface {
+	GeneratedDeps() android.Paths
+}
+
+// generateCompdbProject adds an entry for each source of the module to builds. Entries are keyed by
+// source file and variantKey, so an existing entry for the same key is kept. It returns true if at
+// least one entry was added.
+func generateCompdbProject(compiledModule CompiledInterface, ctx android.SingletonContext, ccModule *Module,
+	variantKey string, builds map[string]compDbEntry) bool {
+
 	srcs := compiledModule.Srcs()
 	if len(srcs) == 0 {
-		return
+		return false
 	}
 
 	pathToCC, err := ctx.Eval(pctx, "${config.ClangBin}")
@@ -181,15 +249,22 @@ func generateCompdbProject(compiledModule CompiledInterface, ctx android.Singlet
 		ccPath = filepath.Join(pathToCC, "clang")
 		cxxPath = filepath.Join(pathToCC, "clang++")
 	}
+	added := false
 	for _, src := range srcs {
-		if _, ok := builds[src.String()]; !ok {
-			builds[src.String()] = compDbEntry{
+		key := src.String()
+		if variantKey != "" {
+			key += ":" + variantKey
+		}
+		if _, ok := builds[key]; !ok {
+			builds[key] = compDbEntry{
 				Directory: android.AbsSrcDirForExistingUseCases(),
 				Arguments: getArguments(src, ctx, ccModule, ccPath, cxxPath),
 				File:      src.String(),
 			}
+			added = true
 		}
 	}
+	return added
 }
 
 func evalAndSplitVariable(ctx android.SingletonContext, str string) ([]string, error) {
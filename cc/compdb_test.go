@@ -0,0 +1,127 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
+
+const compdbBp = `
+	genrule {
+		name: "gen_header",
+		out: ["gen.h"],
+		cmd: "touch $(out)",
+		host_supported: true,
+		vendor_available: true,
+	}
+
+	cc_library {
+		name: "libfoo",
+		srcs: ["foo.c"],
+		generated_headers: ["gen_header"],
+		host_supported: true,
+		vendor_available: true,
+	}
+`
+
+// testCompdb generates the compilation database with the given environment and returns its
+// entries for foo.c.
+func testCompdb(t *testing.T, env map[string]string) (*android.TestResult, []compDbEntry) {
+	t.Helper()
+	env["SOONG_GEN_COMPDB"] = "1"
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.PrepareForTestWithPhony,
+		android.FixtureRegisterWithContext(func(ctx android.RegistrationContext) {
+			ctx.RegisterSingletonType("compdb_generator", compDBGeneratorSingleton)
+		}),
+		android.FixtureMergeEnv(env),
+	).RunTestWithBp(t, compdbBp)
+
+	// The compilation database is written directly, it won't appear in the outputs of the
+	// singleton.
+	content, err := ioutil.ReadFile(filepath.Join(result.Config.SoongOutDir(),
+		compdbOutputProjectsDirectory, compdbFilename))
+	if err != nil {
+		t.Fatalf("compile_commands.json has not been generated: %s", err)
+	}
+	var entries []compDbEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		t.Fatalf("Unable to parse compile_commands.json: %s", err)
+	}
+
+	var fooEntries []compDbEntry
+	for _, entry := range entries {
+		if entry.File == "foo.c" {
+			fooEntries = append(fooEntries, entry)
+		}
+	}
+	return result, fooEntries
+}
+
+func TestCompdbVariantSelection(t *testing.T) {
+	_, entries := testCompdb(t, map[string]string{
+		"SOONG_GEN_COMPDB_ARCH":  "arm64",
+		"SOONG_GEN_COMPDB_IMAGE": "vendor",
+	})
+
+	if len(entries) != 1 {
+		t.Fatalf("expected a single entry for foo.c, got %d: %v", len(entries), entries)
+	}
+	args := strings.Join(entries[0].Arguments, " ")
+	android.AssertStringDoesContain(t, "arm64 target", args, "aarch64-linux-android")
+	android.AssertStringDoesContain(t, "vendor cflags", args, "-D__ANDROID_VENDOR__")
+}
+
+func TestCompdbAllVariants(t *testing.T) {
+	_, entries := testCompdb(t, map[string]string{})
+	android.AssertIntEquals(t, "entries for foo.c without SOONG_GEN_COMPDB_ALL_VARIANTS", 1, len(entries))
+
+	_, entries = testCompdb(t, map[string]string{
+		"SOONG_GEN_COMPDB_ALL_VARIANTS": "true",
+		"SOONG_GEN_COMPDB_ARCH":         "arm64",
+	})
+	var core, vendor int
+	for _, entry := range entries {
+		args := strings.Join(entry.Arguments, " ")
+		android.AssertStringDoesContain(t, "arm64 target", args, "aarch64-linux-android")
+		if strings.Contains(args, "-D__ANDROID_VENDOR__") {
+			vendor++
+		} else if !strings.Contains(args, "-D__ANDROID_VNDK__") {
+			core++
+		}
+	}
+	// The shared and the static variants of each image have their own entries.
+	android.AssertIntEquals(t, "core entries for foo.c", 2, core)
+	android.AssertIntEquals(t, "vendor entries for foo.c", 2, vendor)
+}
+
+func TestCompdbGeneratedSources(t *testing.T) {
+	result, _ := testCompdb(t, map[string]string{
+		"SOONG_GEN_COMPDB_ARCH":  "arm64",
+		"SOONG_GEN_COMPDB_IMAGE": "vendor",
+	})
+
+	genHeader := result.ModuleForTests("gen_header", "android_vendor.29_arm64_armv8-a").Output("gen.h")
+	phony := result.SingletonForTests("phony").Output(CompdbGeneratedSourcesPhony)
+	android.AssertStringListContains(t, "compdb-generated-sources",
+		android.PathsRelativeToTop(phony.Implicits), genHeader.Output.RelativeToTop().String())
+}
@@ -249,6 +249,18 @@ func (compiler *baseCompiler) Srcs() android.Paths {
 	return append(android.Paths{}, compiler.srcs...)
 }
 
+// GeneratedDeps returns the generated sources and headers the compile actions of the module
+// depend on.
+func (compiler *baseCompiler) GeneratedDeps() android.Paths {
+	var ret android.Paths
+	for _, src := range compiler.srcs {
+		if _, ok := src.(android.WritablePath); ok {
+			ret = append(ret, src)
+		}
+	}
+	return append(ret, compiler.pathDeps...)
+}
+
 func (compiler *baseCompiler) appendCflags(flags []string) {
 	compiler.Properties.Cflags = append(compiler.Properties.Cflags, flags...)
 }
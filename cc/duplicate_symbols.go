@@ -0,0 +1,137 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc
+
+import (
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// This file implements the optional check for strong symbols defined by more than one of the
+// static libraries linked into a binary or shared library. The linker silently uses the definition
+// of the first archive that provides a symbol, so such conflicts usually only show up at runtime.
+// Only the symbols that the link actually pulls in from an archive are checked, and the copies of
+// the objects of whole_static_libs are not reported as conflicting with their original archive.
+
+func init() {
+	pctx.HostBinToolVariable("checkDuplicateStaticSymbolsCmd", "check_duplicate_static_symbols")
+}
+
+var checkDuplicateStaticSymbols = pctx.AndroidStaticRule("checkDuplicateStaticSymbols",
+	blueprint.RuleParams{
+		Command: "$checkDuplicateStaticSymbolsCmd --nm ${config.ClangBin}/llvm-nm " +
+			"--name ${name} --output ${out} ${in}",
+		CommandDeps: []string{"$checkDuplicateStaticSymbolsCmd", "${config.ClangBin}/llvm-nm"},
+	},
+	"name")
+
+// staticLibDependencyPaths returns the dependency path, e.g. "foo -> libbar -> libbaz", through
+// which each static library of the module is linked in, and the archives that the objects of each
+// static library are directly copied into through whole_static_libs, both indexed by the path of
+// the archive.
+func staticLibDependencyPaths(ctx ModuleContext) (map[string]string, map[string][]string) {
+	depPaths := make(map[string]string)
+	includedIn := make(map[string][]string)
+	moduleDepPaths := map[android.Module]string{
+		ctx.Module(): ctx.ModuleName(),
+	}
+	archives := make(map[android.Module]string)
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		depTag := ctx.OtherModuleDependencyTag(child)
+		if !IsStaticDepTag(depTag) {
+			return false
+		}
+		var archive string
+		if ctx.OtherModuleHasProvider(child, StaticLibraryInfoProvider) {
+			info := ctx.OtherModuleProvider(child, StaticLibraryInfoProvider).(StaticLibraryInfo)
+			if info.StaticLibrary != nil {
+				archive = info.StaticLibrary.String()
+			}
+		}
+		// Every edge is visited, even to modules that were already visited, so all the archives
+		// a whole static library is copied into are recorded.
+		if parentArchive, ok := archives[parent]; ok && archive != "" && depTag.(libraryDependencyTag).wholeStatic {
+			includedIn[archive] = append(includedIn[archive], parentArchive)
+		}
+		if _, visited := moduleDepPaths[child]; visited {
+			return false
+		}
+		depPath := moduleDepPaths[parent] + " -> " + ctx.OtherModuleName(child)
+		moduleDepPaths[child] = depPath
+		if archive != "" {
+			archives[child] = archive
+			depPaths[archive] = depPath
+		}
+		return true
+	})
+	return depPaths, includedIn
+}
+
+// checkDuplicateStaticSymbolsValidation registers a build statement verifying that no strong
+// symbol pulled in from the given static libraries is defined by more than one of them, and returns
+// the timestamp file to use as a validation of the link. The object files of the link determine
+// which archive members the linker pulls in. It returns nil if there are no static libraries to
+// check.
+func checkDuplicateStaticSymbolsValidation(ctx ModuleContext, objFiles android.Paths, deps PathDeps) android.WritablePath {
+	var staticLibs android.Paths
+	staticLibs = append(staticLibs, deps.StaticLibs...)
+	staticLibs = append(staticLibs, deps.LateStaticLibs...)
+	staticLibs = android.FirstUniquePaths(staticLibs)
+	if len(staticLibs) == 0 && len(deps.WholeStaticLibs) == 0 {
+		return nil
+	}
+
+	// Each line of the list of link inputs is "<kind>\t<path>\t<dependency path>\t<archives>",
+	// where the archives are the ones the objects of a static library are copied into, separated by
+	// commas. The inputs are listed in the order of the link command line.
+	depPaths, includedIn := staticLibDependencyPaths(ctx)
+	var content strings.Builder
+	writeInputs := func(kind string, paths android.Paths) {
+		for _, path := range paths {
+			depPath, ok := depPaths[path.String()]
+			if !ok {
+				depPath = ctx.ModuleName() + " -> " + path.Base()
+			}
+			content.WriteString(kind + "\t" + path.String() + "\t" + depPath + "\t" +
+				strings.Join(android.SortedUniqueStrings(includedIn[path.String()]), ",") + "\n")
+		}
+	}
+	writeInputs("object", objFiles)
+	writeInputs("whole", deps.WholeStaticLibs)
+	writeInputs("static", staticLibs)
+	linkInputsFile := android.PathForModuleOut(ctx, "duplicate_static_symbols", "link_inputs.txt")
+	android.WriteFileRule(ctx, linkInputsFile, content.String())
+
+	var linkInputs android.Paths
+	linkInputs = append(linkInputs, objFiles...)
+	linkInputs = append(linkInputs, deps.WholeStaticLibs...)
+	linkInputs = append(linkInputs, staticLibs...)
+
+	timestamp := android.PathForModuleOut(ctx, "duplicate_static_symbols", "check.timestamp")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        checkDuplicateStaticSymbols,
+		Description: "check duplicate static symbols " + ctx.ModuleName(),
+		Input:       linkInputsFile,
+		Implicits:   linkInputs,
+		Output:      timestamp,
+		Args: map[string]string{
+			"name": ctx.ModuleName(),
+		},
+	})
+	return timestamp
+}
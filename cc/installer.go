@@ -95,6 +95,11 @@ func (installer *baseInstaller) install(ctx ModuleContext, file android.Path) {
 	installer.path = ctx.InstallFile(installer.installDir(ctx), file.Base(), file)
 }
 
+// installedPath returns the path the module was installed to by install.
+func (installer *baseInstaller) installedPath() android.InstallPath {
+	return installer.path
+}
+
 func (installer *baseInstaller) everInstallable() bool {
 	// Most cc modules are installable.
 	return true
@@ -26,6 +26,7 @@ import (
 	"android/soong/android"
 	"android/soong/bazel"
 	"android/soong/bazel/cquery"
+	"android/soong/bloaty"
 	"android/soong/cc/config"
 
 	"github.com/google/blueprint"
@@ -110,6 +111,18 @@ type LibraryProperties struct {
 		// Run checks on all APIs (in addition to the ones referred by
 		// one of exported ELF symbols.)
 		Check_all_apis *bool
+
+		// Path to a directory, relative to the module directory, containing the checked-in
+		// reference ABI dumps of this library. The dumps are laid out as
+		// <arch>/<library name>.so.lsdump for the core variant and
+		// <vendor|product>/<arch>/<library name>.so.lsdump for the vendor and product variants,
+		// optionally gzipped. If set, ABI checks are enabled and the library is compared against
+		// these dumps instead of the ones in prebuilts/abi-dumps. The dumps can be regenerated with
+		// `m <module name>-update-abi-dump`.
+		Reference_dump *string
+
+		// Extra flags passed to header-abi-diff when comparing against reference_dump.
+		Diff_flags []string
 	}
 
 	// Inject boringssl hash into the shared library.  This is only intended for use by external/boringssl.
@@ -903,7 +916,8 @@ func (library *libraryDecorator) compilerFlags(ctx ModuleContext, flags Flags, d
 }
 
 func (library *libraryDecorator) headerAbiCheckerEnabled() bool {
-	return Bool(library.Properties.Header_abi_checker.Enabled)
+	return Bool(library.Properties.Header_abi_checker.Enabled) ||
+		library.Properties.Header_abi_checker.Reference_dump != nil
 }
 
 func (library *libraryDecorator) headerAbiCheckerExplicitlyDisabled() bool {
@@ -1404,9 +1418,20 @@ func (library *libraryDecorator) linkShared(ctx ModuleContext,
 	linkerDeps = append(linkerDeps, deps.SharedLibsDeps...)
 	linkerDeps = append(linkerDeps, deps.LateSharedLibsDeps...)
 	linkerDeps = append(linkerDeps, objs.tidyFiles...)
+
+	var validations android.WritablePaths
+	if sizeBudgetCheck := bloaty.CheckSizeBudget(ctx, unstrippedOutputFile, library.baseLinker.Properties.Size_budget); sizeBudgetCheck != nil {
+		validations = append(validations, sizeBudgetCheck)
+	}
+	if Bool(library.baseLinker.Properties.Check_duplicate_static_symbols) {
+		if check := checkDuplicateStaticSymbolsValidation(ctx, objs.objFiles, deps); check != nil {
+			validations = append(validations, check)
+		}
+	}
+
 	transformObjToDynamicBinary(ctx, objs.objFiles, sharedLibs,
 		deps.StaticLibs, deps.LateStaticLibs, deps.WholeStaticLibs,
-		linkerDeps, deps.CrtBegin, deps.CrtEnd, false, builderFlags, outputFile, implicitOutputs, nil)
+		linkerDeps, deps.CrtBegin, deps.CrtEnd, false, builderFlags, outputFile, implicitOutputs, validations)
 
 	objs.coverageFiles = append(objs.coverageFiles, deps.StaticLibObjs.coverageFiles...)
 	objs.coverageFiles = append(objs.coverageFiles, deps.WholeStaticLibObjs.coverageFiles...)
@@ -1522,6 +1547,11 @@ func (library *libraryDecorator) linkSAbiDumpFiles(ctx ModuleContext, objs Objec
 
 		addLsdumpPath(classifySourceAbiDump(ctx) + ":" + library.sAbiOutputFile.String())
 
+		if refDumpDir := library.Properties.Header_abi_checker.Reference_dump; refDumpDir != nil {
+			library.linkSAbiDumpFilesForModuleRefDump(ctx, String(refDumpDir), fileName, exportedHeaderFlags)
+			return
+		}
+
 		refAbiDumpFile := getRefAbiDumpFile(ctx, vndkVersion, fileName)
 		if refAbiDumpFile != nil {
 			library.sAbiDiff = sourceAbiDiff(ctx, library.sAbiOutputFile.Path(),
@@ -1532,6 +1562,60 @@ func (library *libraryDecorator) linkSAbiDumpFiles(ctx ModuleContext, objs Objec
 	}
 }
 
+// linkSAbiDumpFilesForModuleRefDump compares the linked ABI dump against the reference dump that
+// is checked in next to the module, and registers the <module>-update-abi-dump phony target that
+// overwrites the reference dump with the linked ABI dump.
+func (library *libraryDecorator) linkSAbiDumpFilesForModuleRefDump(ctx ModuleContext, refDumpDir,
+	fileName, exportedHeaderFlags string) {
+
+	// The vendor and product variants may have a different ABI than the core variant, e.g. with
+	// target.vendor properties, so they have their own reference dumps.
+	var image string
+	if ctx.inVendor() {
+		image = "vendor"
+	} else if ctx.inProduct() {
+		image = "product"
+	}
+	arch := ctx.Arch().ArchType.Name
+	refAbiDumpPath := filepath.Join(ctx.ModuleDir(), refDumpDir, image, arch, fileName+".lsdump")
+	refAbiDumpTextFile := android.ExistentPathForSource(ctx, refAbiDumpPath)
+	refAbiDumpGzipFile := android.ExistentPathForSource(ctx, refAbiDumpPath+".gz")
+
+	var refAbiDumpFile android.Path
+	if refAbiDumpTextFile.Valid() && refAbiDumpGzipFile.Valid() {
+		ctx.PropertyErrorf("header_abi_checker.reference_dump",
+			"Two reference ABI dump files are found: %q and %q. Please delete the stale one.",
+			refAbiDumpTextFile, refAbiDumpGzipFile)
+		return
+	} else if refAbiDumpTextFile.Valid() {
+		refAbiDumpFile = refAbiDumpTextFile.Path()
+	} else if refAbiDumpGzipFile.Valid() {
+		refAbiDumpFile = unzipRefDump(ctx, refAbiDumpGzipFile.Path(), fileName)
+	}
+
+	updateTarget := ctx.ModuleName() + "-update-abi-dump"
+	if refAbiDumpFile != nil {
+		library.sAbiDiff = sourceAbiDiffWithModuleRefDump(ctx, library.sAbiOutputFile.Path(),
+			refAbiDumpFile, fileName, exportedHeaderFlags,
+			Bool(library.Properties.Header_abi_checker.Check_all_apis),
+			library.Properties.Header_abi_checker.Diff_flags, updateTarget)
+	}
+
+	// The APEX variants of a library with stubs are compared against the same reference dump as
+	// the platform variant, so only the platform variant updates it.
+	if !ctx.Provider(android.ApexInfoProvider).(android.ApexInfo).IsForPlatform() {
+		return
+	}
+
+	// Always update the uncompressed dump unless only a gzipped one is checked in.
+	dest := refAbiDumpPath
+	if refAbiDumpGzipFile.Valid() {
+		dest = refAbiDumpGzipFile.String()
+	}
+	updateTimestamp := updateModuleRefDump(ctx, library.sAbiOutputFile.Path(), dest, fileName)
+	ctx.Phony(updateTarget, updateTimestamp)
+}
+
 func processLLNDKHeaders(ctx ModuleContext, srcHeaderDir string, outDir android.ModuleGenPath) (timestamp android.Path, installPaths android.WritablePaths) {
 	srcDir := android.PathForModuleSrc(ctx, srcHeaderDir)
 	srcFiles := ctx.GlobFiles(filepath.Join(srcDir.String(), "**/*.h"), nil)
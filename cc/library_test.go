@@ -320,3 +320,144 @@ func TestLibraryDynamicList(t *testing.T) {
 		libfoo.Args["ldFlags"], "-Wl,--dynamic-list,foo.dynamic.txt")
 
 }
+
+func TestLibraryHeaderAbiCheckerReferenceDump(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForIntegrationTestWithCc,
+		android.FixtureAddFile("abi-dumps/arm64/libfoo.so.lsdump", nil),
+	).RunTestWithBp(t, `
+		cc_library {
+			name: "libfoo",
+			srcs: ["foo.c"],
+			header_abi_checker: {
+				reference_dump: "abi-dumps",
+				diff_flags: ["-allow-extensions"],
+			},
+		}`)
+
+	libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+	abiDiff := libfoo.Output("libfoo.so.abidiff")
+	android.AssertStringEquals(t, "reference dump",
+		"abi-dumps/arm64/libfoo.so.lsdump", abiDiff.Args["referenceDump"])
+	android.AssertStringDoesContain(t, "missing diff_flags",
+		abiDiff.Args["extraFlags"], "-allow-extensions")
+	android.AssertStringEquals(t, "update target",
+		"libfoo-update-abi-dump", abiDiff.Args["updateTarget"])
+
+	updateRefDump := libfoo.Output("libfoo.so_update_ref_dump.timestamp")
+	android.AssertStringEquals(t, "updated reference dump",
+		"abi-dumps/arm64/libfoo.so.lsdump", updateRefDump.Args["referenceDump"])
+}
+
+func TestLibraryHeaderAbiCheckerReferenceDumpVendorAvailable(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForCcTest,
+		android.FixtureAddFile("abi-dumps/arm64/libfoo.so.lsdump", nil),
+		android.FixtureAddFile("abi-dumps/vendor/arm64/libfoo.so.lsdump", nil),
+		android.FixtureAddFile("abi-dumps/product/arm64/libfoo.so.lsdump.gz", nil),
+	).RunTestWithBp(t, `
+		cc_library {
+			name: "libfoo",
+			srcs: ["foo.c"],
+			vendor_available: true,
+			product_available: true,
+			header_abi_checker: {
+				reference_dump: "abi-dumps",
+			},
+		}`)
+
+	for _, tc := range []struct {
+		variant       string
+		referenceDump string
+		updatedDump   string
+	}{
+		{coreVariant, "abi-dumps/arm64/libfoo.so.lsdump", "abi-dumps/arm64/libfoo.so.lsdump"},
+		{vendorVariant, "abi-dumps/vendor/arm64/libfoo.so.lsdump", "abi-dumps/vendor/arm64/libfoo.so.lsdump"},
+		{productVariant, "out/soong/.intermediates/libfoo/" + productVariant + "/libfoo.so_ref.lsdump",
+			"abi-dumps/product/arm64/libfoo.so.lsdump.gz"},
+	} {
+		t.Run(tc.variant, func(t *testing.T) {
+			libfoo := result.ModuleForTests("libfoo", tc.variant)
+
+			abiDiff := libfoo.Output("libfoo.so.abidiff")
+			android.AssertPathRelativeToTopEquals(t, "reference dump",
+				tc.referenceDump, abiDiff.Implicit)
+
+			updateRefDump := libfoo.Output("libfoo.so_update_ref_dump.timestamp")
+			android.AssertStringEquals(t, "updated reference dump",
+				tc.updatedDump, updateRefDump.Args["referenceDump"])
+		})
+	}
+}
+
+func TestLibrarySizeBudget(t *testing.T) {
+	result := PrepareForIntegrationTestWithCc.RunTestWithBp(t, `
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.c"],
+			size_budget: {
+				text: 4096,
+				total: 8192,
+			},
+		}`)
+
+	libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+	budget := libfoo.Output("size_budget/libfoo.so.timestamp")
+	android.AssertStringEquals(t, "budget flags", "--text 4096 --total 8192", budget.Args["budgetFlags"])
+	android.AssertPathRelativeToTopEquals(t, "measured file",
+		"out/soong/.intermediates/libfoo/android_arm64_armv8-a_shared/libfoo.so", budget.Input)
+
+	android.AssertPathsRelativeToTopEquals(t, "link validations",
+		[]string{budget.Output.String()}, libfoo.Rule("ld").Validations)
+}
+
+func TestLibraryCheckDuplicateStaticSymbols(t *testing.T) {
+	result := PrepareForIntegrationTestWithCc.RunTestWithBp(t, `
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.c"],
+			static_libs: [
+				"libbar",
+				"libbaz",
+			],
+			check_duplicate_static_symbols: true,
+		}
+
+		cc_library_static {
+			name: "libbar",
+			srcs: ["bar.c"],
+			whole_static_libs: ["libbaz"],
+		}
+
+		cc_library_static {
+			name: "libbaz",
+			srcs: ["baz.c"],
+		}`)
+
+	libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_shared")
+
+	check := libfoo.Output("duplicate_static_symbols/check.timestamp")
+	android.AssertStringEquals(t, "name", "libfoo", check.Args["name"])
+	android.AssertStringDoesContain(t, "command", check.RuleParams.Command, "--nm ${config.ClangBin}/llvm-nm")
+	android.AssertStringListContains(t, "command deps", check.RuleParams.CommandDeps, "${config.ClangBin}/llvm-nm")
+	android.AssertPathsRelativeToTopEquals(t, "link inputs", []string{
+		"out/soong/.intermediates/libfoo/android_arm64_armv8-a_shared/obj/foo.o",
+		"out/soong/.intermediates/libbar/android_arm64_armv8-a_static/libbar.a",
+		"out/soong/.intermediates/libbaz/android_arm64_armv8-a_static/libbaz.a",
+	}, check.Implicits)
+
+	linkInputs := android.StringRelativeToTop(result.Config,
+		android.ContentFromFileRuleForTests(t, libfoo.Output("duplicate_static_symbols/link_inputs.txt")))
+	android.AssertStringDoesContain(t, "object", linkInputs,
+		"object\tout/soong/.intermediates/libfoo/android_arm64_armv8-a_shared/obj/foo.o\tlibfoo -> foo.o\t\n")
+	android.AssertStringDoesContain(t, "static library", linkInputs,
+		"static\tout/soong/.intermediates/libbar/android_arm64_armv8-a_static/libbar.a\tlibfoo -> libbar\t\n")
+	android.AssertStringDoesContain(t, "whole static library copied into libbar", linkInputs,
+		"static\tout/soong/.intermediates/libbaz/android_arm64_armv8-a_static/libbaz.a\tlibfoo -> libbaz\t"+
+			"out/soong/.intermediates/libbar/android_arm64_armv8-a_static/libbar.a\n")
+
+	android.AssertPathsRelativeToTopEquals(t, "link validations",
+		[]string{check.Output.String()}, libfoo.Rule("ld").Validations)
+}
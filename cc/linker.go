@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"android/soong/android"
+	"android/soong/bloaty"
 	"android/soong/cc/config"
 
 	"github.com/google/blueprint"
@@ -229,6 +230,13 @@ type BaseLinkerProperties struct {
 
 	// list of shared libs that should not be used to build this module
 	Exclude_shared_libs []string `android:"arch_variant"`
+
+	// maximum section sizes of the binary or shared library, verified with bloaty when it is built
+	Size_budget bloaty.SizeBudget `android:"arch_variant"`
+
+	// if set, fail the build when a strong symbol is defined by more than one of the static
+	// libraries linked into the binary or shared library.
+	Check_duplicate_static_symbols *bool
 }
 
 func invertBoolPtr(value *bool) *bool {
@@ -0,0 +1,611 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/bpfix/bpfix"
+)
+
+type RewriteNames []RewriteName
+type RewriteName struct {
+	regexp *regexp.Regexp
+	repl   string
+}
+
+func (r *RewriteNames) String() string {
+	return ""
+}
+
+func (r *RewriteNames) Set(v string) error {
+	split := strings.SplitN(v, "=", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("Must be in the form of <regex>=<replace>")
+	}
+	regex, err := regexp.Compile(split[0])
+	if err != nil {
+		return err
+	}
+	*r = append(*r, RewriteName{
+		regexp: regex,
+		repl:   split[1],
+	})
+	return nil
+}
+
+// CrateToBp returns the name of the Android.bp library module for a crate, which is lib<crate_name>
+// unless one of the rewrites matches the name of the crate's package.
+func (r *RewriteNames) CrateToBp(pkgName string, crateName string) string {
+	for _, r := range *r {
+		if r.regexp.MatchString(pkgName) {
+			return r.regexp.ReplaceAllString(pkgName, r.repl)
+		}
+	}
+	return "lib" + crateName
+}
+
+var rewriteNames = RewriteNames{}
+
+type CrateValues map[string][]string
+
+func (c CrateValues) String() string {
+	return ""
+}
+
+func (c CrateValues) Set(v string) error {
+	split := strings.SplitN(v, "=", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("Must be in the form of <crate>=<value>[,<value>]")
+	}
+	c[split[0]] = append(c[split[0]], strings.Split(split[1], ",")...)
+	return nil
+}
+
+var extraRustlibs = make(CrateValues)
+var extraCfgs = make(CrateValues)
+
+type Exclude map[string]bool
+
+func (e Exclude) String() string {
+	return ""
+}
+
+func (e Exclude) Set(v string) error {
+	e[v] = true
+	return nil
+}
+
+var excludes = make(Exclude)
+
+var hostSupported bool
+var tests bool
+
+// The subset of the output of cargo metadata --format-version 1 used by cargo2bp.
+type CargoMetadata struct {
+	Packages         []*CargoPackage `json:"packages"`
+	WorkspaceMembers []string        `json:"workspace_members"`
+	WorkspaceRoot    string          `json:"workspace_root"`
+	Resolve          *CargoResolve   `json:"resolve"`
+}
+
+type CargoPackage struct {
+	Id           string         `json:"id"`
+	Name         string         `json:"name"`
+	Version      string         `json:"version"`
+	Edition      string         `json:"edition"`
+	ManifestPath string         `json:"manifest_path"`
+	Targets      []*CargoTarget `json:"targets"`
+}
+
+type CargoTarget struct {
+	Name    string   `json:"name"`
+	Kind    []string `json:"kind"`
+	SrcPath string   `json:"src_path"`
+	Edition string   `json:"edition"`
+	Test    bool     `json:"test"`
+}
+
+func (t *CargoTarget) HasKind(kind string) bool {
+	for _, k := range t.Kind {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *CargoTarget) IsLib() bool {
+	return t.HasKind("lib") || t.HasKind("rlib") || t.HasKind("dylib") || t.HasKind("proc-macro")
+}
+
+func (t *CargoTarget) CrateName() string {
+	return strings.ReplaceAll(t.Name, "-", "_")
+}
+
+type CargoResolve struct {
+	Nodes []*CargoNode `json:"nodes"`
+}
+
+type CargoNode struct {
+	Id       string         `json:"id"`
+	Deps     []CargoNodeDep `json:"deps"`
+	Features []string       `json:"features"`
+}
+
+type CargoNodeDep struct {
+	// The name of the dependency as used in the code of the dependent crate, which differs from the
+	// crate name of the dependency if the dependency is renamed in Cargo.toml.
+	Name     string         `json:"name"`
+	Pkg      string         `json:"pkg"`
+	DepKinds []CargoDepKind `json:"dep_kinds"`
+}
+
+type CargoDepKind struct {
+	// nil for normal dependencies, "dev" or "build".
+	Kind *string `json:"kind"`
+	// nil unless the dependency is platform specific.
+	Target *string `json:"target"`
+}
+
+type BpModule struct {
+	ModuleType    string
+	Name          string
+	CrateName     string
+	Src           string
+	Edition       string
+	HostSupported bool
+	Features      []string
+	Cfgs          []string
+	Rustlibs      []string
+	ProcMacros    []string
+	Test          bool
+
+	// Notes about parts of the crate that need manual handling.
+	Notes []string
+}
+
+var bpTemplate = template.Must(template.New("bp").Parse(`
+{{- range .Notes}}
+// {{.}}
+{{- end}}
+{{.ModuleType}} {
+    name: "{{.Name}}",
+    {{- if .HostSupported}}
+    host_supported: true,
+    {{- end}}
+    crate_name: "{{.CrateName}}",
+    srcs: ["{{.Src}}"],
+    edition: "{{.Edition}}",
+    {{- if .Features}}
+    features: [
+        {{- range .Features}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Cfgs}}
+    cfgs: [
+        {{- range .Cfgs}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Rustlibs}}
+    rustlibs: [
+        {{- range .Rustlibs}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .ProcMacros}}
+    proc_macros: [
+        {{- range .ProcMacros}}
+        "{{.}}",
+        {{- end}}
+    ],
+    {{- end}}
+    {{- if .Test}}
+    test_suites: ["general-tests"],
+    auto_gen_config: true,
+    {{- end}}
+}
+`))
+
+type converter struct {
+	metadata *CargoMetadata
+	packages map[string]*CargoPackage
+	nodes    map[string]*CargoNode
+}
+
+func newConverter(metadata *CargoMetadata) (*converter, error) {
+	if metadata.Resolve == nil {
+		return nil, fmt.Errorf("metadata has no dependency resolution, run cargo metadata without --no-deps")
+	}
+	c := &converter{
+		metadata: metadata,
+		packages: make(map[string]*CargoPackage),
+		nodes:    make(map[string]*CargoNode),
+	}
+	for _, pkg := range metadata.Packages {
+		c.packages[pkg.Id] = pkg
+	}
+	for _, node := range metadata.Resolve.Nodes {
+		c.nodes[node.Id] = node
+	}
+	return c, nil
+}
+
+// libTarget returns the library target of a package, or nil if it has none.
+func libTarget(pkg *CargoPackage) *CargoTarget {
+	for _, t := range pkg.Targets {
+		if t.IsLib() {
+			return t
+		}
+	}
+	return nil
+}
+
+// src returns the path to the root source file of a target relative to the workspace root, which
+// is where the generated Android.bp file is expected to be.
+func (c *converter) src(target *CargoTarget) string {
+	if rel, err := filepath.Rel(c.metadata.WorkspaceRoot, target.SrcPath); err == nil {
+		return rel
+	}
+	return target.SrcPath
+}
+
+func edition(pkg *CargoPackage, target *CargoTarget) string {
+	if target.Edition != "" {
+		return target.Edition
+	}
+	if pkg.Edition != "" {
+		return pkg.Edition
+	}
+	return "2015"
+}
+
+// deps returns the Android.bp rustlibs and proc_macros of a package, and notes about the
+// dependencies that need manual handling.  Dev dependencies are included when dev is true, build
+// dependencies are only used by build scripts and are never included.
+func (c *converter) deps(pkg *CargoPackage, dev bool) (rustlibs, procMacros, notes []string) {
+	for _, dep := range c.nodes[pkg.Id].Deps {
+		depPkg := c.packages[dep.Pkg]
+		if depPkg == nil || excludes[depPkg.Name] {
+			continue
+		}
+		normal, devOnly, platform := false, false, ""
+		for _, kind := range dep.DepKinds {
+			if kind.Target != nil {
+				platform = *kind.Target
+				continue
+			}
+			if kind.Kind == nil {
+				normal = true
+			} else if *kind.Kind == "dev" {
+				devOnly = true
+			}
+		}
+		// Versions of cargo before 1.41 don't report the kinds of the dependencies.
+		if len(dep.DepKinds) == 0 {
+			normal = true
+		}
+		if platform != "" && !normal && !devOnly {
+			notes = append(notes, fmt.Sprintf("TODO: dependency on %s is only for %s, add it manually if needed.",
+				depPkg.Name, platform))
+			continue
+		}
+		if !normal && !(dev && devOnly) {
+			continue
+		}
+
+		target := libTarget(depPkg)
+		if target == nil {
+			continue
+		}
+		if dep.Name != target.CrateName() {
+			notes = append(notes, fmt.Sprintf("TODO: %s is renamed to %s in Cargo.toml, which is not supported.",
+				depPkg.Name, dep.Name))
+		}
+		name := rewriteNames.CrateToBp(depPkg.Name, target.CrateName())
+		if target.HasKind("proc-macro") {
+			procMacros = append(procMacros, name)
+		} else {
+			rustlibs = append(rustlibs, name)
+		}
+	}
+	sort.Strings(rustlibs)
+	sort.Strings(procMacros)
+	return rustlibs, procMacros, notes
+}
+
+// testName returns the name of the rust_test module for a target, e.g. foo_test_src_lib for the
+// unit tests of the library of the foo package.
+func (c *converter) testName(pkg *CargoPackage, target *CargoTarget) string {
+	rel, err := filepath.Rel(filepath.Dir(pkg.ManifestPath), target.SrcPath)
+	if err != nil {
+		rel = filepath.Base(target.SrcPath)
+	}
+	rel = strings.TrimSuffix(rel, ".rs")
+	return pkg.Name + "_test_" + strings.NewReplacer("/", "_", "-", "_").Replace(rel)
+}
+
+// convert returns the Android.bp modules for the targets of a package.
+func (c *converter) convert(pkg *CargoPackage) []*BpModule {
+	var modules []*BpModule
+	var notes []string
+
+	node := c.nodes[pkg.Id]
+	features := append([]string(nil), node.Features...)
+	sort.Strings(features)
+
+	rustlibs, procMacros, depNotes := c.deps(pkg, false)
+	notes = append(notes, depNotes...)
+	rustlibs = append(rustlibs, extraRustlibs[pkg.Name]...)
+
+	lib := libTarget(pkg)
+
+	newModule := func(moduleType, name string, target *CargoTarget) *BpModule {
+		return &BpModule{
+			ModuleType:    moduleType,
+			Name:          name,
+			CrateName:     target.CrateName(),
+			Src:           c.src(target),
+			Edition:       edition(pkg, target),
+			HostSupported: hostSupported && moduleType != "rust_proc_macro",
+			Features:      features,
+			Cfgs:          extraCfgs[pkg.Name],
+			Rustlibs:      rustlibs,
+			ProcMacros:    procMacros,
+		}
+	}
+
+	for _, target := range pkg.Targets {
+		switch {
+		case target.HasKind("custom-build"):
+			note := fmt.Sprintf("TODO: %s has a build script, %s, that Soong does not run. "+
+				"The cfgs, environment variables and generated sources it provides must be added manually.",
+				pkg.Name, c.src(target))
+			notes = append(notes, note)
+			fmt.Fprintln(os.Stderr, "warning:", note)
+		case target.HasKind("proc-macro"):
+			modules = append(modules, newModule("rust_proc_macro",
+				rewriteNames.CrateToBp(pkg.Name, target.CrateName()), target))
+		case target.IsLib():
+			modules = append(modules, newModule("rust_library",
+				rewriteNames.CrateToBp(pkg.Name, target.CrateName()), target))
+		case target.HasKind("bin"):
+			m := newModule("rust_binary", target.Name, target)
+			// Binaries use the library of the package like any other crate.
+			if lib != nil && !lib.HasKind("proc-macro") {
+				m.Rustlibs = append(append([]string(nil), rustlibs...),
+					rewriteNames.CrateToBp(pkg.Name, lib.CrateName()))
+			}
+			modules = append(modules, m)
+		}
+	}
+
+	if tests {
+		testRustlibs, testProcMacros, _ := c.deps(pkg, true)
+		testRustlibs = append(testRustlibs, extraRustlibs[pkg.Name]...)
+		for _, target := range pkg.Targets {
+			isTest := target.HasKind("test")
+			if !isTest && !(target.Test && target.IsLib() && !target.HasKind("proc-macro")) {
+				continue
+			}
+			m := newModule("rust_test", c.testName(pkg, target), target)
+			m.Test = true
+			m.Rustlibs = testRustlibs
+			m.ProcMacros = testProcMacros
+			// Integration tests use the library of the package like any other crate.
+			if isTest && lib != nil && !lib.HasKind("proc-macro") {
+				m.Rustlibs = append(append([]string(nil), testRustlibs...),
+					rewriteNames.CrateToBp(pkg.Name, lib.CrateName()))
+			}
+			modules = append(modules, m)
+		}
+	}
+
+	if len(modules) > 0 {
+		modules[0].Notes = append(modules[0].Notes, notes...)
+	}
+	return modules
+}
+
+// bpModules returns the Android.bp modules for the workspace members of the metadata.
+func (c *converter) bpModules() []*BpModule {
+	var modules []*BpModule
+	members := append([]string(nil), c.metadata.WorkspaceMembers...)
+	sort.Strings(members)
+	for _, id := range members {
+		pkg := c.packages[id]
+		if pkg == nil || excludes[pkg.Name] || c.nodes[id] == nil {
+			continue
+		}
+		modules = append(modules, c.convert(pkg)...)
+	}
+	return modules
+}
+
+func rerunForRegen(filename string) error {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(buf))
+
+	// Skip the first line in the file
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			if scanner.Err() != nil {
+				return scanner.Err()
+			} else {
+				return fmt.Errorf("unexpected EOF")
+			}
+		}
+	}
+
+	// Extract the old args from the file
+	line := scanner.Text()
+	if strings.HasPrefix(line, "// cargo2bp ") {
+		line = strings.TrimPrefix(line, "// cargo2bp ")
+	} else {
+		return fmt.Errorf("unexpected second line: %q", line)
+	}
+	args := strings.Split(line, " ")
+	lastArg := args[len(args)-1]
+	args = args[:len(args)-1]
+
+	// Append all current command line args except -regen <file> to the ones from the file
+	for i := 1; i < len(os.Args); i++ {
+		if os.Args[i] == "-regen" || os.Args[i] == "--regen" {
+			i++
+		} else {
+			args = append(args, os.Args[i])
+		}
+	}
+	args = append(args, lastArg)
+
+	cmd := os.Args[0] + " " + strings.Join(args, " ")
+	// Re-exec cargo2bp with the new arguments
+	output, err := exec.Command("/bin/sh", "-c", cmd).Output()
+	if exitErr, _ := err.(*exec.ExitError); exitErr != nil {
+		return fmt.Errorf("failed to run %s\n%s", cmd, string(exitErr.Stderr))
+	} else if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, output, 0666)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `cargo2bp, a tool to create Android.bp files from Cargo metadata
+
+The tool converts the packages of a Cargo workspace into rust_library, rust_proc_macro,
+rust_binary and rust_test modules, using the output of
+cargo metadata --format-version 1 --offline saved to a file, so that no network access is needed.
+The features of each crate are the ones resolved by Cargo.  The srcs are relative to the workspace
+root, where the output is expected to be put (often as Android.bp).
+
+Usage: %s [--rewrite <regex>=<replace>] [-exclude <crate>] [-extra-rustlibs <crate>=<module>[,<module>]] [-cfgs <crate>=<cfg>[,<cfg>]] [-host-supported] [-tests] <metadata.json> [-regen <file>]
+
+  -rewrite <regex>=<replace>
+     rewrite can be used to specify mappings between crates and Android.bp library modules. The
+     -rewrite option can be specified multiple times. When determining the Android.bp module for a
+     given crate, mappings are searched in the order they were specified. The first <regex>
+     matching the package name of the crate will be used to generate the Android.bp module name
+     using <replace>. If no matches are found, lib<crate_name> is used.
+  -exclude <crate>
+     Don't put the specified crate in the Android.bp file or in the dependencies of other crates.
+  -extra-rustlibs <crate>=<module>[,<module>]
+     Add rustlibs to the modules of the specified crate, e.g. to replace the dependencies of a
+     crate that are not in the metadata.  This may be specified multiple times.
+  -cfgs <crate>=<cfg>[,<cfg>]
+     Add cfgs to the modules of the specified crate, e.g. the cfgs set by its build script.  This
+     may be specified multiple times.
+  -host-supported
+     Sets host_supported: true on all modules.
+  -tests
+     Also write rust_test modules for the unit tests of the libraries and the integration tests.
+  <metadata.json>
+     The output of cargo metadata.
+     The contents are written to stdout.
+  -regen <file>
+     Read arguments from <file> and overwrite it.
+
+Build scripts are not run by Soong: a TODO is written in the output and a warning printed for each
+crate that has one.
+`, os.Args[0])
+	}
+
+	var regen string
+
+	flag.Var(&excludes, "exclude", "Exclude crate")
+	flag.Var(&extraRustlibs, "extra-rustlibs", "Extra rustlibs of a crate")
+	flag.Var(&extraCfgs, "cfgs", "Extra cfgs of a crate")
+	flag.Var(&rewriteNames, "rewrite", "Regex(es) to rewrite crate names")
+	flag.BoolVar(&hostSupported, "host-supported", false, "Sets host_supported: true on all modules")
+	flag.BoolVar(&tests, "tests", false, "Whether to write rust_test modules")
+	flag.StringVar(&regen, "regen", "", "Rewrite specified file")
+	flag.Parse()
+
+	if regen != "" {
+		err := rerunForRegen(regen)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Exactly one metadata file argument is required")
+		os.Exit(1)
+	}
+
+	data, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read metadata:", err)
+		os.Exit(1)
+	}
+	metadata := &CargoMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse json: %v\n", err)
+		os.Exit(1)
+	}
+
+	c, err := newConverter(metadata)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintln(buf, "// Automatically generated with:")
+	fmt.Fprintln(buf, "// cargo2bp", strings.Join(proptools.ShellEscapeList(os.Args[1:]), " "))
+
+	for _, m := range c.bpModules() {
+		err := bpTemplate.Execute(buf, m)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing", m.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	out, err := bpfix.Reformat(buf.String())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error formatting output", err)
+		os.Exit(1)
+	}
+
+	os.Stdout.WriteString(out)
+}
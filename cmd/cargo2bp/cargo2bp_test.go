@@ -0,0 +1,412 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMetadata is the output of cargo metadata --format-version 1 for a workspace containing the
+// foo package, trimmed to the fields read by cargo2bp.  foo has a library, a binary, an
+// integration test and a build script, and depends on:
+//   - log, a normal dependency
+//   - serde_derive, a proc macro
+//   - tempfile, a dev dependency
+//   - cc, a build dependency
+//   - winapi, a dependency only on windows
+//   - rand_core, renamed to rand_core_old in Cargo.toml
+//   - libc, a dependency on unix and on all platforms
+const testMetadata = `
+{
+  "packages": [
+    {
+      "id": "foo 0.1.0 (path+file:///work/foo)",
+      "name": "foo",
+      "version": "0.1.0",
+      "edition": "2018",
+      "manifest_path": "/work/foo/Cargo.toml",
+      "targets": [
+        {"name": "foo", "kind": ["lib"], "src_path": "/work/foo/src/lib.rs", "edition": "2018", "test": true},
+        {"name": "foo-cli", "kind": ["bin"], "src_path": "/work/foo/src/bin/foo-cli.rs", "edition": "2018", "test": true},
+        {"name": "integration", "kind": ["test"], "src_path": "/work/foo/tests/integration.rs", "edition": "2018", "test": true},
+        {"name": "build-script-build", "kind": ["custom-build"], "src_path": "/work/foo/build.rs", "edition": "2018", "test": false}
+      ]
+    },
+    {
+      "id": "log 0.4.14 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "log",
+      "version": "0.4.14",
+      "edition": "2015",
+      "manifest_path": "/cargo/registry/log-0.4.14/Cargo.toml",
+      "targets": [
+        {"name": "log", "kind": ["lib"], "src_path": "/cargo/registry/log-0.4.14/src/lib.rs", "edition": "2015", "test": true}
+      ]
+    },
+    {
+      "id": "serde_derive 1.0.130 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "serde_derive",
+      "version": "1.0.130",
+      "edition": "2015",
+      "manifest_path": "/cargo/registry/serde_derive-1.0.130/Cargo.toml",
+      "targets": [
+        {"name": "serde_derive", "kind": ["proc-macro"], "src_path": "/cargo/registry/serde_derive-1.0.130/src/lib.rs", "edition": "2015", "test": true}
+      ]
+    },
+    {
+      "id": "tempfile 3.2.0 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "tempfile",
+      "version": "3.2.0",
+      "edition": "2018",
+      "manifest_path": "/cargo/registry/tempfile-3.2.0/Cargo.toml",
+      "targets": [
+        {"name": "tempfile", "kind": ["lib"], "src_path": "/cargo/registry/tempfile-3.2.0/src/lib.rs", "edition": "2018", "test": true}
+      ]
+    },
+    {
+      "id": "cc 1.0.70 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "cc",
+      "version": "1.0.70",
+      "edition": "2018",
+      "manifest_path": "/cargo/registry/cc-1.0.70/Cargo.toml",
+      "targets": [
+        {"name": "cc", "kind": ["lib"], "src_path": "/cargo/registry/cc-1.0.70/src/lib.rs", "edition": "2018", "test": true}
+      ]
+    },
+    {
+      "id": "winapi 0.3.9 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "winapi",
+      "version": "0.3.9",
+      "edition": "2015",
+      "manifest_path": "/cargo/registry/winapi-0.3.9/Cargo.toml",
+      "targets": [
+        {"name": "winapi", "kind": ["lib"], "src_path": "/cargo/registry/winapi-0.3.9/src/lib.rs", "edition": "2015", "test": true}
+      ]
+    },
+    {
+      "id": "rand_core 0.5.1 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "rand_core",
+      "version": "0.5.1",
+      "edition": "2018",
+      "manifest_path": "/cargo/registry/rand_core-0.5.1/Cargo.toml",
+      "targets": [
+        {"name": "rand_core", "kind": ["lib"], "src_path": "/cargo/registry/rand_core-0.5.1/src/lib.rs", "edition": "2018", "test": true}
+      ]
+    },
+    {
+      "id": "libc 0.2.103 (registry+https://github.com/rust-lang/crates.io-index)",
+      "name": "libc",
+      "version": "0.2.103",
+      "edition": "2015",
+      "manifest_path": "/cargo/registry/libc-0.2.103/Cargo.toml",
+      "targets": [
+        {"name": "libc", "kind": ["lib"], "src_path": "/cargo/registry/libc-0.2.103/src/lib.rs", "edition": "2015", "test": true}
+      ]
+    }
+  ],
+  "workspace_members": [
+    "foo 0.1.0 (path+file:///work/foo)"
+  ],
+  "workspace_root": "/work",
+  "resolve": {
+    "nodes": [
+      {
+        "id": "foo 0.1.0 (path+file:///work/foo)",
+        "features": ["std", "default"],
+        "deps": [
+          {
+            "name": "log",
+            "pkg": "log 0.4.14 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": null, "target": null}]
+          },
+          {
+            "name": "serde_derive",
+            "pkg": "serde_derive 1.0.130 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": null, "target": null}]
+          },
+          {
+            "name": "tempfile",
+            "pkg": "tempfile 3.2.0 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": "dev", "target": null}]
+          },
+          {
+            "name": "cc",
+            "pkg": "cc 1.0.70 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": "build", "target": null}]
+          },
+          {
+            "name": "winapi",
+            "pkg": "winapi 0.3.9 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": null, "target": "cfg(windows)"}]
+          },
+          {
+            "name": "rand_core_old",
+            "pkg": "rand_core 0.5.1 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": null, "target": null}]
+          },
+          {
+            "name": "libc",
+            "pkg": "libc 0.2.103 (registry+https://github.com/rust-lang/crates.io-index)",
+            "dep_kinds": [{"kind": null, "target": "cfg(unix)"}, {"kind": null, "target": null}]
+          }
+        ]
+      },
+      {"id": "log 0.4.14 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "serde_derive 1.0.130 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "tempfile 3.2.0 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "cc 1.0.70 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "winapi 0.3.9 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "rand_core 0.5.1 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []},
+      {"id": "libc 0.2.103 (registry+https://github.com/rust-lang/crates.io-index)", "features": [], "deps": []}
+    ]
+  }
+}
+`
+
+// testBpModules converts testMetadata with the given rewrites and tests flag.
+func testBpModules(t *testing.T, rewrites []string, withTests bool) []*BpModule {
+	t.Helper()
+
+	oldRewriteNames, oldTests := rewriteNames, tests
+	defer func() {
+		rewriteNames, tests = oldRewriteNames, oldTests
+	}()
+	rewriteNames = RewriteNames{}
+	for _, rewrite := range rewrites {
+		if err := rewriteNames.Set(rewrite); err != nil {
+			t.Fatalf("invalid rewrite %q: %s", rewrite, err)
+		}
+	}
+	tests = withTests
+
+	metadata := &CargoMetadata{}
+	if err := json.Unmarshal([]byte(testMetadata), metadata); err != nil {
+		t.Fatalf("failed to parse the metadata: %s", err)
+	}
+	c, err := newConverter(metadata)
+	if err != nil {
+		t.Fatalf("failed to create the converter: %s", err)
+	}
+	return c.bpModules()
+}
+
+func moduleNames(modules []*BpModule) []string {
+	var names []string
+	for _, m := range modules {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func findModule(t *testing.T, modules []*BpModule, name string) *BpModule {
+	t.Helper()
+	for _, m := range modules {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("module %q not found in %q", name, moduleNames(modules))
+	return nil
+}
+
+func TestDependencyKinds(t *testing.T) {
+	modules := testBpModules(t, nil, false)
+
+	if g, w := moduleNames(modules), []string{"libfoo", "foo-cli"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected modules %q, got %q", w, g)
+	}
+
+	libfoo := findModule(t, modules, "libfoo")
+	// The dev dependency tempfile, the build dependency cc and the windows only winapi are not
+	// included, the dependency on libc on all platforms is.
+	if g, w := libfoo.Rustlibs, []string{"liblibc", "liblog", "librand_core"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected rustlibs %q, got %q", w, g)
+	}
+	if g, w := libfoo.ProcMacros, []string{"libserde_derive"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected proc_macros %q, got %q", w, g)
+	}
+	if g, w := libfoo.Features, []string{"default", "std"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected features %q, got %q", w, g)
+	}
+
+	// The binary uses the library of the package.
+	cli := findModule(t, modules, "foo-cli")
+	if g, w := cli.Rustlibs, []string{"liblibc", "liblog", "librand_core", "libfoo"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected binary rustlibs %q, got %q", w, g)
+	}
+	if g, w := cli.CrateName, "foo_cli"; g != w {
+		t.Errorf("expected binary crate name %q, got %q", w, g)
+	}
+}
+
+func TestPlatformSpecificDependencies(t *testing.T) {
+	libfoo := findModule(t, testBpModules(t, nil, false), "libfoo")
+
+	note := "TODO: dependency on winapi is only for cfg(windows), add it manually if needed."
+	if !containsString(libfoo.Notes, note) {
+		t.Errorf("expected note %q, got %q", note, libfoo.Notes)
+	}
+	for _, n := range libfoo.Notes {
+		if strings.Contains(n, "libc") {
+			t.Errorf("unexpected note for libc, which is also a dependency on all platforms: %q", n)
+		}
+	}
+}
+
+func TestRenamedDependencies(t *testing.T) {
+	libfoo := findModule(t, testBpModules(t, nil, false), "libfoo")
+
+	note := "TODO: rand_core is renamed to rand_core_old in Cargo.toml, which is not supported."
+	if !containsString(libfoo.Notes, note) {
+		t.Errorf("expected note %q, got %q", note, libfoo.Notes)
+	}
+	// The module of the renamed dependency is still named after its crate.
+	if !containsString(libfoo.Rustlibs, "librand_core") {
+		t.Errorf("expected librand_core in rustlibs, got %q", libfoo.Rustlibs)
+	}
+}
+
+func TestBuildScript(t *testing.T) {
+	libfoo := findModule(t, testBpModules(t, nil, false), "libfoo")
+
+	note := "TODO: foo has a build script, foo/build.rs, that Soong does not run. " +
+		"The cfgs, environment variables and generated sources it provides must be added manually."
+	if g := libfoo.Notes[len(libfoo.Notes)-1]; g != note {
+		t.Errorf("expected last note %q, got %q", note, g)
+	}
+}
+
+func TestRewriteNames(t *testing.T) {
+	modules := testBpModules(t, []string{"^log$=liblog_rust", "^foo$=libfoo_android"}, false)
+
+	if g, w := moduleNames(modules), []string{"libfoo_android", "foo-cli"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected modules %q, got %q", w, g)
+	}
+
+	libfoo := findModule(t, modules, "libfoo_android")
+	if g, w := libfoo.CrateName, "foo"; g != w {
+		t.Errorf("expected the crate name %q to be kept, got %q", w, g)
+	}
+	if g, w := libfoo.Rustlibs, []string{"liblibc", "liblog_rust", "librand_core"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected rustlibs %q, got %q", w, g)
+	}
+
+	cli := findModule(t, modules, "foo-cli")
+	if !containsString(cli.Rustlibs, "libfoo_android") {
+		t.Errorf("expected the binary to use the rewritten library, got %q", cli.Rustlibs)
+	}
+}
+
+func TestTestModules(t *testing.T) {
+	modules := testBpModules(t, nil, true)
+
+	w := []string{"libfoo", "foo-cli", "foo_test_src_lib", "foo_test_tests_integration"}
+	if g := moduleNames(modules); !reflect.DeepEqual(g, w) {
+		t.Errorf("expected modules %q, got %q", w, g)
+	}
+
+	// The unit tests of the library also use the dev dependencies.
+	unitTest := findModule(t, modules, "foo_test_src_lib")
+	if g, w := unitTest.Rustlibs, []string{"liblibc", "liblog", "librand_core", "libtempfile"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected unit test rustlibs %q, got %q", w, g)
+	}
+	if g, w := unitTest.Src, "foo/src/lib.rs"; g != w {
+		t.Errorf("expected unit test src %q, got %q", w, g)
+	}
+	if !unitTest.Test {
+		t.Errorf("expected the unit test to be a test")
+	}
+
+	// Integration tests also use the library of the package.
+	integrationTest := findModule(t, modules, "foo_test_tests_integration")
+	if g, w := integrationTest.Rustlibs, []string{"liblibc", "liblog", "librand_core", "libtempfile", "libfoo"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected integration test rustlibs %q, got %q", w, g)
+	}
+	if g, w := integrationTest.CrateName, "integration"; g != w {
+		t.Errorf("expected integration test crate name %q, got %q", w, g)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	modules := testBpModules(t, []string{"^log$=liblog_rust"}, true)
+
+	buf := &bytes.Buffer{}
+	for _, m := range []*BpModule{findModule(t, modules, "libfoo"), findModule(t, modules, "foo_test_src_lib")} {
+		if err := bpTemplate.Execute(buf, m); err != nil {
+			t.Fatalf("failed to write %s: %s", m.Name, err)
+		}
+	}
+
+	expected := `
+// TODO: dependency on winapi is only for cfg(windows), add it manually if needed.
+// TODO: rand_core is renamed to rand_core_old in Cargo.toml, which is not supported.
+// TODO: foo has a build script, foo/build.rs, that Soong does not run. The cfgs, environment variables and generated sources it provides must be added manually.
+rust_library {
+    name: "libfoo",
+    crate_name: "foo",
+    srcs: ["foo/src/lib.rs"],
+    edition: "2018",
+    features: [
+        "default",
+        "std",
+    ],
+    rustlibs: [
+        "liblibc",
+        "liblog_rust",
+        "librand_core",
+    ],
+    proc_macros: [
+        "libserde_derive",
+    ],
+}
+
+rust_test {
+    name: "foo_test_src_lib",
+    crate_name: "foo",
+    srcs: ["foo/src/lib.rs"],
+    edition: "2018",
+    features: [
+        "default",
+        "std",
+    ],
+    rustlibs: [
+        "liblibc",
+        "liblog_rust",
+        "librand_core",
+        "libtempfile",
+    ],
+    proc_macros: [
+        "libserde_derive",
+    ],
+    test_suites: ["general-tests"],
+    auto_gen_config: true,
+}
+`
+	if g := buf.String(); g != expected {
+		t.Errorf("unexpected Android.bp output\nexpected:\n%s\ngot:\n%s", expected, g)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// This file extracts the public API of a jar: its public and protected classes, fields and
+// methods.  The API is written with one line per class or member, sorted, so that API files can
+// be compared line by line.  Types are written in their erased form, e.g. java.util.List for
+// List<String>.
+
+// javaName converts an internal class name like foo/Foo$Bar into foo.Foo.Bar.
+func javaName(internalName string) string {
+	return strings.NewReplacer("/", ".", "$", ".").Replace(internalName)
+}
+
+// parseType converts the field descriptor at the start of descriptor into a Java type, and returns
+// it with the rest of the descriptor.
+func parseType(descriptor string) (string, string, error) {
+	arrays := ""
+	for strings.HasPrefix(descriptor, "[") {
+		arrays += "[]"
+		descriptor = descriptor[1:]
+	}
+	if descriptor == "" {
+		return "", "", fmt.Errorf("truncated descriptor")
+	}
+	primitives := map[byte]string{
+		'B': "byte", 'C': "char", 'D': "double", 'F': "float", 'I': "int",
+		'J': "long", 'S': "short", 'Z': "boolean", 'V': "void",
+	}
+	if t, ok := primitives[descriptor[0]]; ok {
+		return t + arrays, descriptor[1:], nil
+	}
+	if descriptor[0] == 'L' {
+		end := strings.IndexByte(descriptor, ';')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated class type in descriptor")
+		}
+		return javaName(descriptor[1:end]) + arrays, descriptor[end+1:], nil
+	}
+	return "", "", fmt.Errorf("unknown type %q in descriptor", descriptor[0])
+}
+
+// parseMethodDescriptor converts a method descriptor into the Java types of its parameters and of
+// its return value.
+func parseMethodDescriptor(descriptor string) ([]string, string, error) {
+	if !strings.HasPrefix(descriptor, "(") {
+		return nil, "", fmt.Errorf("invalid method descriptor %q", descriptor)
+	}
+	rest := descriptor[1:]
+	var params []string
+	for !strings.HasPrefix(rest, ")") {
+		var param string
+		var err error
+		if param, rest, err = parseType(rest); err != nil {
+			return nil, "", fmt.Errorf("invalid method descriptor %q: %w", descriptor, err)
+		}
+		params = append(params, param)
+	}
+	ret, _, err := parseType(rest[1:])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid method descriptor %q: %w", descriptor, err)
+	}
+	return params, ret, nil
+}
+
+type innerClass struct {
+	outer  string
+	access int
+}
+
+// innerClasses returns the entries of the InnerClasses attribute of the class, indexed by the name
+// of the inner class.
+func (c *classFile) innerClasses() map[string]innerClass {
+	ret := make(map[string]innerClass)
+	data := findAttribute(c.attributes, "InnerClasses")
+	if data == nil {
+		return ret
+	}
+	r := &classReader{data: data}
+	entries := r.u2()
+	for i := 0; i < entries && r.err == nil; i++ {
+		inner := c.cp.resolve(r.u2())
+		outer := c.cp.resolve(r.u2())
+		r.u2() // inner name
+		ret[inner] = innerClass{outer, r.u2()}
+	}
+	return ret
+}
+
+type apiWriter struct {
+	classes map[string]*classFile
+	lines   []string
+}
+
+// classAccess returns the access flags of a class as declared in the sources, which for nested
+// classes are only recorded in the InnerClasses attribute, and the name of the enclosing class.
+func (w *apiWriter) classAccess(c *classFile) (int, string) {
+	if inner, ok := c.innerClasses()[c.name]; ok && inner.outer != "" {
+		return inner.access, inner.outer
+	}
+	return c.access, ""
+}
+
+// isApi returns true if the class is visible outside of its package.
+func (w *apiWriter) isApi(c *classFile) bool {
+	access, outer := w.classAccess(c)
+	if access&(accPublic|accProtected) == 0 || access&accSynthetic != 0 {
+		return false
+	}
+	if outerClass, ok := w.classes[outer]; ok {
+		return w.isApi(outerClass)
+	}
+	return true
+}
+
+func modifiers(access int, deprecated bool, extra ...string) string {
+	var mods []string
+	if access&accPublic != 0 {
+		mods = append(mods, "public")
+	} else if access&accProtected != 0 {
+		mods = append(mods, "protected")
+	}
+	if deprecated {
+		mods = append(mods, "deprecated")
+	}
+	if access&accStatic != 0 {
+		mods = append(mods, "static")
+	}
+	if access&accFinal != 0 {
+		mods = append(mods, "final")
+	}
+	if access&accAbstract != 0 {
+		mods = append(mods, "abstract")
+	}
+	return strings.Join(append(mods, extra...), " ")
+}
+
+func (w *apiWriter) class(c *classFile) error {
+	access, _ := w.classAccess(c)
+	deprecated := findAttribute(c.attributes, "Deprecated") != nil
+	name := javaName(c.name)
+
+	var interfaces []string
+	for _, i := range c.interfaces {
+		interfaces = append(interfaces, javaName(i))
+	}
+
+	switch {
+	case access&accAnnotation != 0:
+		w.lines = append(w.lines, fmt.Sprintf("@interface %s %s",
+			modifiers(access&^(accAbstract|accInterface), deprecated), name))
+	case access&accInterface != 0:
+		line := fmt.Sprintf("interface %s %s", modifiers(access&^accAbstract, deprecated), name)
+		if len(interfaces) > 0 {
+			line += " extends " + strings.Join(interfaces, ", ")
+		}
+		w.lines = append(w.lines, line)
+	case access&accEnum != 0:
+		line := fmt.Sprintf("enum %s %s", modifiers(access, deprecated), name)
+		if len(interfaces) > 0 {
+			line += " implements " + strings.Join(interfaces, ", ")
+		}
+		w.lines = append(w.lines, line)
+	default:
+		line := fmt.Sprintf("class %s %s", modifiers(access, deprecated), name)
+		if c.superName != "" && c.superName != "java/lang/Object" {
+			line += " extends " + javaName(c.superName)
+		}
+		if len(interfaces) > 0 {
+			line += " implements " + strings.Join(interfaces, ", ")
+		}
+		w.lines = append(w.lines, line)
+	}
+
+	for _, f := range c.fields {
+		if f.access&(accPublic|accProtected) == 0 || f.access&accSynthetic != 0 {
+			continue
+		}
+		fieldType, _, err := parseType(f.descriptor)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		deprecated := findAttribute(f.attributes, "Deprecated") != nil
+		line := fmt.Sprintf("field %s %s %s.%s", modifiers(f.access, deprecated), fieldType, name, f.name)
+		if value := findAttribute(f.attributes, "ConstantValue"); value != nil {
+			r := &classReader{data: value}
+			line += " = " + c.cp.resolve(r.u2())
+		}
+		w.lines = append(w.lines, line)
+	}
+
+	for _, m := range c.methods {
+		if m.access&(accPublic|accProtected) == 0 || m.access&(accSynthetic|accBridge) != 0 ||
+			m.name == "<clinit>" {
+			continue
+		}
+		params, ret, err := parseMethodDescriptor(m.descriptor)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", m.name, err)
+		}
+		if m.access&accVarargs != 0 && len(params) > 0 {
+			last := params[len(params)-1]
+			params[len(params)-1] = strings.TrimSuffix(last, "[]") + "..."
+		}
+
+		var extra []string
+		if access&accInterface != 0 && m.access&(accAbstract|accStatic) == 0 {
+			extra = append(extra, "default")
+		}
+		deprecated := findAttribute(m.attributes, "Deprecated") != nil
+		mods := modifiers(m.access, deprecated, extra...)
+
+		var line string
+		if m.name == "<init>" {
+			line = fmt.Sprintf("ctor %s %s(%s)", mods, name, strings.Join(params, ", "))
+		} else {
+			line = fmt.Sprintf("method %s %s %s.%s(%s)", mods, ret, name, m.name, strings.Join(params, ", "))
+		}
+		if exceptions := findAttribute(m.attributes, "Exceptions"); exceptions != nil {
+			r := &classReader{data: exceptions}
+			count := r.u2()
+			var throws []string
+			for i := 0; i < count; i++ {
+				throws = append(throws, javaName(c.cp.resolve(r.u2())))
+			}
+			sort.Strings(throws)
+			line += " throws " + strings.Join(throws, ", ")
+		}
+		w.lines = append(w.lines, line)
+	}
+	return nil
+}
+
+// jarApi returns the public API of the classes of a jar.  The classes under META-INF, like the
+// transitive dependencies recorded by turbine, are not part of the API.
+func jarApi(reader *zip.Reader) ([]byte, error) {
+	w := &apiWriter{classes: make(map[string]*classFile)}
+	for _, f := range reader.File {
+		if !strings.HasSuffix(f.Name, ".class") || strings.HasPrefix(f.Name, "META-INF/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		c, err := parseClassFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		w.classes[c.name] = c
+	}
+
+	for _, c := range w.classes {
+		if !w.isApi(c) {
+			continue
+		}
+		if err := w.class(c); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+
+	sort.Strings(w.lines)
+	var api strings.Builder
+	for _, line := range w.lines {
+		api.WriteString(line)
+		api.WriteString("\n")
+	}
+	return []byte(api.String()), nil
+}
@@ -0,0 +1,437 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	classFileMagic = 0xCAFEBABE
+
+	accPublic     = 0x0001
+	accPrivate    = 0x0002
+	accProtected  = 0x0004
+	accStatic     = 0x0008
+	accFinal      = 0x0010
+	accBridge     = 0x0040
+	accVarargs    = 0x0080
+	accInterface  = 0x0200
+	accAbstract   = 0x0400
+	accSynthetic  = 0x1000
+	accAnnotation = 0x2000
+	accEnum       = 0x4000
+
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+// classReader reads the big-endian items of a class file.
+type classReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *classReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of class file at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *classReader) u1() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *classReader) u2() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (r *classReader) u4() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+type constant struct {
+	tag  int
+	data []byte
+}
+
+// constantPool resolves constant pool indices into strings that do not depend on the layout of
+// the pool, so that adding or removing unrelated constants does not change the output.
+type constantPool []constant
+
+func (cp constantPool) resolve(index int) string {
+	if index == 0 {
+		return ""
+	}
+	if index < 0 || index >= len(cp) || cp[index].data == nil {
+		return fmt.Sprintf("<invalid constant %d>", index)
+	}
+	c := cp[index]
+	u2 := func(i int) int { return int(binary.BigEndian.Uint16(c.data[i:])) }
+	switch c.tag {
+	case constantUtf8:
+		return string(c.data)
+	case constantInteger:
+		return strconv.Itoa(int(int32(binary.BigEndian.Uint32(c.data))))
+	case constantFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(c.data))), 'g', -1, 32) + "f"
+	case constantLong:
+		return strconv.FormatInt(int64(binary.BigEndian.Uint64(c.data)), 10) + "L"
+	case constantDouble:
+		return strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(c.data)), 'g', -1, 64) + "d"
+	case constantClass, constantModule, constantPackage:
+		return cp.resolve(u2(0))
+	case constantString:
+		return strconv.Quote(cp.resolve(u2(0)))
+	case constantMethodType:
+		return "methodtype " + cp.resolve(u2(0))
+	case constantMethodHandle:
+		return fmt.Sprintf("methodhandle %d %s", c.data[0], cp.resolve(u2(1)))
+	default:
+		// The remaining constants are all made of two indices.
+		return cp.resolve(u2(0)) + " " + cp.resolve(u2(2))
+	}
+}
+
+func readConstantPool(r *classReader) constantPool {
+	count := r.u2()
+	cp := make(constantPool, count)
+	for i := 1; i < count && r.err == nil; i++ {
+		tag := r.u1()
+		var size int
+		switch tag {
+		case constantUtf8:
+			size = r.u2()
+		case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+			size = 2
+		case constantMethodHandle:
+			size = 3
+		case constantInteger, constantFloat, constantFieldref, constantMethodref,
+			constantInterfaceMethodref, constantNameAndType, constantDynamic, constantInvokeDynamic:
+			size = 4
+		case constantLong, constantDouble:
+			size = 8
+		default:
+			r.err = fmt.Errorf("unknown constant pool tag %d at index %d", tag, i)
+			return nil
+		}
+		cp[i] = constant{tag, r.bytes(size)}
+		if tag == constantLong || tag == constantDouble {
+			// Long and double constants take two entries in the constant pool.
+			i++
+		}
+	}
+	return cp
+}
+
+// abiWriter writes the normalized description of a class file.
+type abiWriter struct {
+	cp constantPool
+	sb strings.Builder
+}
+
+func (w *abiWriter) line(indent int, format string, args ...interface{}) {
+	w.sb.WriteString(strings.Repeat("  ", indent))
+	fmt.Fprintf(&w.sb, format, args...)
+	w.sb.WriteString("\n")
+}
+
+func (w *abiWriter) indexList(r *classReader, count int) string {
+	var list []string
+	for i := 0; i < count; i++ {
+		list = append(list, w.cp.resolve(r.u2()))
+	}
+	return strings.Join(list, ", ")
+}
+
+func (w *abiWriter) elementValue(r *classReader) string {
+	tag := r.u1()
+	switch tag {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 's', 'c':
+		return string(rune(tag)) + ":" + w.cp.resolve(r.u2())
+	case 'e':
+		typeName := w.cp.resolve(r.u2())
+		return "e:" + typeName + "." + w.cp.resolve(r.u2())
+	case '@':
+		return "@" + w.annotation(r)
+	case '[':
+		count := r.u2()
+		var values []string
+		for i := 0; i < count; i++ {
+			values = append(values, w.elementValue(r))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("unknown annotation element value tag %q", rune(tag))
+		}
+		return ""
+	}
+}
+
+func (w *abiWriter) annotation(r *classReader) string {
+	typeName := w.cp.resolve(r.u2())
+	count := r.u2()
+	var pairs []string
+	for i := 0; i < count; i++ {
+		name := w.cp.resolve(r.u2())
+		pairs = append(pairs, name+"="+w.elementValue(r))
+	}
+	return typeName + "(" + strings.Join(pairs, ", ") + ")"
+}
+
+func (w *abiWriter) annotations(r *classReader) string {
+	count := r.u2()
+	var annotations []string
+	for i := 0; i < count; i++ {
+		annotations = append(annotations, w.annotation(r))
+	}
+	return strings.Join(annotations, " ")
+}
+
+// attributes writes the given attributes.  Attributes that are not known to reference the constant
+// pool in a structured way are written as hex, which can only cause spurious differences, never
+// hide real ones.
+func (w *abiWriter) attributes(attributes []attribute, indent int) error {
+	var lines []string
+	for _, attr := range attributes {
+		name := attr.name
+		body := &classReader{data: attr.data}
+		sub := &abiWriter{cp: w.cp}
+		switch name {
+		case "ConstantValue", "Signature", "SourceFile", "NestHost":
+			sub.line(indent, "%s %s", name, w.cp.resolve(body.u2()))
+		case "Deprecated", "Synthetic":
+			sub.line(indent, "%s", name)
+		case "Exceptions", "NestMembers", "PermittedSubclasses":
+			sub.line(indent, "%s %s", name, sub.indexList(body, body.u2()))
+		case "EnclosingMethod":
+			sub.line(indent, "%s %s", name, sub.indexList(body, 2))
+		case "InnerClasses":
+			entries := body.u2()
+			for j := 0; j < entries; j++ {
+				classes := sub.indexList(body, 3)
+				sub.line(indent, "%s %s 0x%04x", name, classes, body.u2())
+			}
+		case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+			sub.line(indent, "%s %s", name, sub.annotations(body))
+		case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+			params := body.u1()
+			for j := 0; j < params; j++ {
+				sub.line(indent, "%s %d %s", name, j, sub.annotations(body))
+			}
+		case "AnnotationDefault":
+			sub.line(indent, "%s %s", name, sub.elementValue(body))
+		case "MethodParameters":
+			params := body.u1()
+			for j := 0; j < params; j++ {
+				param := w.cp.resolve(body.u2())
+				sub.line(indent, "%s %s 0x%04x", name, param, body.u2())
+			}
+		case "Record":
+			components := body.u2()
+			for j := 0; j < components && body.err == nil; j++ {
+				sub.line(indent, "%s %s", name, sub.indexList(body, 2))
+				if err := sub.attributes(readAttributes(body, w.cp), indent+1); err != nil {
+					return err
+				}
+			}
+		default:
+			sub.line(indent, "%s %s", name, hex.EncodeToString(body.data))
+		}
+		if body.err != nil {
+			return fmt.Errorf("attribute %s: %w", name, body.err)
+		}
+		lines = append(lines, sub.sb.String())
+	}
+	// The order of attributes is not significant.
+	sort.Strings(lines)
+	for _, line := range lines {
+		w.sb.WriteString(line)
+	}
+	return nil
+}
+
+// members writes the non-private fields or methods, sorted so that reordering the declarations in
+// the sources does not change the output.
+func (w *abiWriter) members(members []member, kind string) error {
+	var lines []string
+	for _, m := range members {
+		if m.access&accPrivate != 0 {
+			continue
+		}
+		sub := &abiWriter{cp: w.cp}
+		sub.line(1, "%s 0x%04x %s %s", kind, m.access, m.name, m.descriptor)
+		if err := sub.attributes(m.attributes, 2); err != nil {
+			return fmt.Errorf("%s %s: %w", kind, m.name, err)
+		}
+		lines = append(lines, sub.sb.String())
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		w.sb.WriteString(line)
+	}
+	return nil
+}
+
+type attribute struct {
+	name string
+	data []byte
+}
+
+// member is a field or a method of a class.
+type member struct {
+	access     int
+	name       string
+	descriptor string
+	attributes []attribute
+}
+
+// classFile is a parsed class file.  Names are kept in their internal form, e.g. java/lang/Object.
+type classFile struct {
+	cp           constantPool
+	major, minor int
+	access       int
+	name         string
+	superName    string
+	interfaces   []string
+	fields       []member
+	methods      []member
+	attributes   []attribute
+}
+
+func readAttributes(r *classReader, cp constantPool) []attribute {
+	count := r.u2()
+	var attributes []attribute
+	for i := 0; i < count && r.err == nil; i++ {
+		name := cp.resolve(r.u2())
+		attributes = append(attributes, attribute{name, r.bytes(int(r.u4()))})
+	}
+	return attributes
+}
+
+func readMembers(r *classReader, cp constantPool) []member {
+	count := r.u2()
+	var members []member
+	for i := 0; i < count && r.err == nil; i++ {
+		m := member{
+			access:     r.u2(),
+			name:       cp.resolve(r.u2()),
+			descriptor: cp.resolve(r.u2()),
+		}
+		m.attributes = readAttributes(r, cp)
+		members = append(members, m)
+	}
+	return members
+}
+
+func parseClassFile(data []byte) (*classFile, error) {
+	r := &classReader{data: data}
+	if magic := r.u4(); r.err == nil && magic != classFileMagic {
+		return nil, fmt.Errorf("bad class file magic 0x%08x", magic)
+	}
+	c := &classFile{}
+	c.minor = r.u2()
+	c.major = r.u2()
+	c.cp = readConstantPool(r)
+	c.access = r.u2()
+	c.name = c.cp.resolve(r.u2())
+	c.superName = c.cp.resolve(r.u2())
+	interfaces := r.u2()
+	for i := 0; i < interfaces && r.err == nil; i++ {
+		c.interfaces = append(c.interfaces, c.cp.resolve(r.u2()))
+	}
+	c.fields = readMembers(r, c.cp)
+	c.methods = readMembers(r, c.cp)
+	c.attributes = readAttributes(r, c.cp)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return c, nil
+}
+
+// findAttribute returns the contents of the attribute with the given name, or nil if there is none.
+func findAttribute(attributes []attribute, name string) []byte {
+	for _, attr := range attributes {
+		if attr.name == name {
+			return attr.data
+		}
+	}
+	return nil
+}
+
+// classAbi returns a description of the class file that only contains the parts visible to the
+// classes compiled against it.  Private fields and methods are dropped, and references to the
+// constant pool are replaced with the constants they point to.
+func classAbi(data []byte) (string, error) {
+	c, err := parseClassFile(data)
+	if err != nil {
+		return "", err
+	}
+	w := &abiWriter{cp: c.cp}
+	w.line(0, "class 0x%04x %s version=%d.%d super=%s interfaces=[%s]",
+		c.access, c.name, c.major, c.minor, c.superName, strings.Join(c.interfaces, ", "))
+	if err := w.members(c.fields, "field"); err != nil {
+		return "", err
+	}
+	if err := w.members(c.methods, "method"); err != nil {
+		return "", err
+	}
+	if err := w.attributes(c.attributes, 1); err != nil {
+		return "", err
+	}
+	return w.sb.String(), nil
+}
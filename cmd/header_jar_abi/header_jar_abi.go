@@ -0,0 +1,106 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// header_jar_abi writes a normalized description of the ABI of a header jar: the signatures of
+// the non-private members of its classes and the hashes of its other files, sorted by name and
+// independent of timestamps and of the layout of the class files.  Two header jars with the same
+// description can be used interchangeably to compile against, which allows the build to only
+// update a header jar when its description changes.
+//
+// With -api, it writes the public API of the jar instead, see api.go.
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	outputFile = flag.String("o", "", "output file")
+	api        = flag.Bool("api", false, "write the public API of the jar instead of its ABI")
+)
+
+func jarAbi(reader *zip.Reader) ([]byte, error) {
+	files := append([]*zip.File(nil), reader.File...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var buf bytes.Buffer
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		if strings.HasSuffix(f.Name, ".class") {
+			abi, err := classAbi(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			fmt.Fprintf(&buf, "file %s\n%s", f.Name, abi)
+		} else {
+			fmt.Fprintf(&buf, "file %s %x\n", f.Name, sha256.Sum256(data))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: header_jar_abi [-api] -o <output file> <input jar>")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *outputFile == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	reader, err := zip.OpenReader(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	write := jarAbi
+	if *api {
+		write = jarApi
+	}
+	output, err := write(&reader.Reader)
+	if err != nil {
+		log.Fatalf("%s: %s", flag.Arg(0), err)
+	}
+
+	if err := ioutil.WriteFile(*outputFile, output, 0666); err != nil {
+		log.Fatal(err)
+	}
+}
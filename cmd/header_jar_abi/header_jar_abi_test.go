@@ -0,0 +1,321 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+type testMember struct {
+	access     int
+	name, desc string
+	signature  string
+}
+
+// testClass describes a class file to be generated by build.
+type testClass struct {
+	name string
+	// access defaults to public.
+	access  int
+	members []testMember
+	// unused constants are added to the start of the constant pool to shift the indices of the
+	// other constants.
+	unused []string
+}
+
+func (c testClass) build() []byte {
+	var pool bytes.Buffer
+	poolCount := 1
+	utf8 := func(s string) int {
+		pool.WriteByte(constantUtf8)
+		binary.Write(&pool, binary.BigEndian, uint16(len(s)))
+		pool.WriteString(s)
+		poolCount++
+		return poolCount - 1
+	}
+	class := func(s string) int {
+		nameIndex := utf8(s)
+		pool.WriteByte(constantClass)
+		binary.Write(&pool, binary.BigEndian, uint16(nameIndex))
+		poolCount++
+		return poolCount - 1
+	}
+
+	for _, s := range c.unused {
+		utf8(s)
+	}
+	thisClass := class(c.name)
+	superClass := class("java/lang/Object")
+
+	var members bytes.Buffer
+	for _, m := range c.members {
+		binary.Write(&members, binary.BigEndian, []uint16{
+			uint16(m.access), uint16(utf8(m.name)), uint16(utf8(m.desc))})
+		if m.signature != "" {
+			binary.Write(&members, binary.BigEndian, []uint16{1, uint16(utf8("Signature"))})
+			binary.Write(&members, binary.BigEndian, uint32(2))
+			binary.Write(&members, binary.BigEndian, uint16(utf8(m.signature)))
+		} else {
+			binary.Write(&members, binary.BigEndian, uint16(0))
+		}
+	}
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint32(classFileMagic))
+	binary.Write(&out, binary.BigEndian, []uint16{0, 52, uint16(poolCount)})
+	out.Write(pool.Bytes())
+	access := c.access
+	if access == 0 {
+		access = 0x0021
+	}
+	binary.Write(&out, binary.BigEndian, []uint16{uint16(access), uint16(thisClass), uint16(superClass), 0})
+	// No fields, the methods, no class attributes.
+	binary.Write(&out, binary.BigEndian, []uint16{0, uint16(len(c.members))})
+	out.Write(members.Bytes())
+	binary.Write(&out, binary.BigEndian, uint16(0))
+	return out.Bytes()
+}
+
+func TestClassAbi(t *testing.T) {
+	base := testClass{
+		name: "foo/Foo",
+		members: []testMember{
+			{access: 0x0001, name: "foo", desc: "()V"},
+			{access: 0x0001, name: "bar", desc: "(Ljava/util/List;)V", signature: "(Ljava/util/List<Ljava/lang/String;>;)V"},
+			{access: 0x0002, name: "secret", desc: "()I"},
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		class   testClass
+		changed bool
+	}{
+		{
+			name:    "unchanged",
+			class:   base,
+			changed: false,
+		},
+		{
+			name: "shifted constant pool",
+			class: testClass{
+				name:    base.name,
+				members: base.members,
+				unused:  []string{"unused1", "unused2"},
+			},
+			changed: false,
+		},
+		{
+			name: "reordered members",
+			class: testClass{
+				name:    base.name,
+				members: []testMember{base.members[2], base.members[1], base.members[0]},
+			},
+			changed: false,
+		},
+		{
+			name: "changed private member",
+			class: testClass{
+				name: base.name,
+				members: []testMember{base.members[0], base.members[1],
+					{access: 0x0002, name: "otherSecret", desc: "(J)Ljava/lang/String;"}},
+			},
+			changed: false,
+		},
+		{
+			name: "changed public member",
+			class: testClass{
+				name: base.name,
+				members: []testMember{{access: 0x0001, name: "foo", desc: "(I)V"},
+					base.members[1], base.members[2]},
+			},
+			changed: true,
+		},
+		{
+			name: "changed signature",
+			class: testClass{
+				name: base.name,
+				members: []testMember{base.members[0],
+					{access: 0x0001, name: "bar", desc: "(Ljava/util/List;)V", signature: "(Ljava/util/List<Ljava/lang/Integer;>;)V"},
+					base.members[2]},
+			},
+			changed: true,
+		},
+		{
+			name: "private member made public",
+			class: testClass{
+				name: base.name,
+				members: []testMember{base.members[0], base.members[1],
+					{access: 0x0001, name: "secret", desc: "()I"}},
+			},
+			changed: true,
+		},
+	}
+
+	expected, err := classAbi(base.build())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := classAbi(testCase.class.build())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := actual != expected; changed != testCase.changed {
+				t.Errorf("expected changed=%v, got %v:\nbase:\n%s\nactual:\n%s",
+					testCase.changed, changed, expected, actual)
+			}
+		})
+	}
+}
+
+func TestClassAbiBadMagic(t *testing.T) {
+	if _, err := classAbi([]byte{0xCA, 0xFE, 0xD0, 0x0D, 0, 0, 0, 0}); err == nil {
+		t.Error("expected error for bad magic")
+	}
+	if _, err := classAbi([]byte{0xCA, 0xFE}); err == nil {
+		t.Error("expected error for truncated class")
+	}
+}
+
+func TestJarAbi(t *testing.T) {
+	class := testClass{
+		name:    "foo/Foo",
+		members: []testMember{{access: 0x0001, name: "foo", desc: "()V"}},
+	}.build()
+
+	type entry struct {
+		name    string
+		data    []byte
+		modTime time.Time
+	}
+	writeJar := func(entries []entry) *zip.Reader {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for _, e := range entries {
+			f, err := w.CreateHeader(&zip.FileHeader{Name: e.name, Modified: e.modTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(e.data)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	old := time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	first, err := jarAbi(writeJar([]entry{
+		{"foo/", nil, old},
+		{"foo/Foo.class", class, old},
+		{"META-INF/TRANSITIVE/bar/Bar.class", class, old},
+		{"res.txt", []byte("resource"), old},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := jarAbi(writeJar([]entry{
+		{"res.txt", []byte("resource"), now},
+		{"META-INF/TRANSITIVE/bar/Bar.class", class, now},
+		{"foo/Foo.class", class, now},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected reordered jar with new timestamps to have the same abi:\n%s\n%s", first, second)
+	}
+
+	third, err := jarAbi(writeJar([]entry{
+		{"foo/Foo.class", class, old},
+		{"META-INF/TRANSITIVE/bar/Bar.class", class, old},
+		{"res.txt", []byte("changed resource"), old},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, third) {
+		t.Errorf("expected changed resource to change the abi")
+	}
+}
+
+func TestJarApi(t *testing.T) {
+	foo := testClass{
+		name: "foo/Foo",
+		members: []testMember{
+			{access: 0x0004, name: "<init>", desc: "(I)V"},
+			{access: 0x0001, name: "foo", desc: "(Ljava/util/List;[[J)Ljava/lang/String;", signature: "(Ljava/util/List<Ljava/lang/String;>;[[J)Ljava/lang/String;"},
+			{access: 0x0089, name: "format", desc: "(Ljava/lang/String;[Ljava/lang/Object;)V"},
+			{access: 0x0002, name: "secret", desc: "()I"},
+			{access: 0x0008, name: "<clinit>", desc: "()V"},
+			{access: 0x1041, name: "bridge", desc: "()Ljava/lang/Object;"},
+		},
+	}.build()
+	hidden := testClass{
+		name:    "foo/Hidden",
+		access:  0x0020,
+		members: []testMember{{access: 0x0001, name: "foo", desc: "()V"}},
+	}.build()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{
+		{"foo/Foo.class", foo},
+		{"foo/Hidden.class", hidden},
+		{"META-INF/TRANSITIVE/bar/Bar.class", foo},
+	} {
+		f, err := w.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := jarApi(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "" +
+		"class public foo.Foo\n" +
+		"ctor protected foo.Foo(int)\n" +
+		"method public java.lang.String foo.Foo.foo(java.util.List, long[][])\n" +
+		"method public static void foo.Foo.format(java.lang.String, java.lang.Object...)\n"
+	if string(api) != expected {
+		t.Errorf("expected api:\n%s\ngot:\n%s", expected, api)
+	}
+}
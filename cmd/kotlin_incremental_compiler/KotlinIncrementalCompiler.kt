@@ -0,0 +1,208 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+@file:OptIn(ExperimentalBuildToolsApi::class)
+
+// kotlin-incremental-compiler runs kotlinc with the incremental compilation of the Kotlin build
+// tools API, keeping the incremental caches in a directory between builds.  It is built by the
+// kotlin_incremental_compiler singleton of build/soong/java/kotlin.go, and run with the jars of the
+// Kotlin build tools API and of the compiler on the classpath.
+//
+// Usage: kotlin-incremental-compiler --caches_dir <dir> -- <kotlinc arguments>
+//
+// The kotlinc arguments must contain -Xbuild-file=<module.xml>, as written by
+// gen-kotlin-build-file.py.  The sources, the classpath and the output directory of the module are
+// read from it.  The hashes of the sources are saved in the caches directory after each successful
+// compilation, and compared on the next one to find the added, modified and removed sources, so the
+// caches are kept when sources are added or removed.  The caches don't track changes to the
+// classpath: the kotlincIncremental rule deletes them when it changes.
+package com.android.soong.kotlin
+
+import java.io.File
+import java.security.MessageDigest
+import java.util.UUID
+import javax.xml.parsers.DocumentBuilderFactory
+import kotlin.system.exitProcess
+import org.jetbrains.kotlin.buildtools.api.CompilationResult
+import org.jetbrains.kotlin.buildtools.api.CompilationService
+import org.jetbrains.kotlin.buildtools.api.ExperimentalBuildToolsApi
+import org.jetbrains.kotlin.buildtools.api.KotlinLogger
+import org.jetbrains.kotlin.buildtools.api.ProjectId
+import org.jetbrains.kotlin.buildtools.api.SourcesChanges
+import org.jetbrains.kotlin.buildtools.api.jvm.ClasspathSnapshotBasedIncrementalCompilationApproachParameters
+
+private const val BUILD_FILE_FLAG = "-Xbuild-file="
+private const val SOURCES_STATE = "sources.txt"
+
+private class Module(
+    val name: String,
+    val outputDir: File,
+    val sources: List<File>,
+    val commonSources: List<File>,
+    val javaSourceRoots: List<File>,
+    val classpath: List<File>,
+)
+
+private fun usage(msg: String): Nothing {
+    System.err.println("kotlin-incremental-compiler: $msg")
+    System.err.println("usage: kotlin-incremental-compiler --caches_dir <dir> -- <kotlinc arguments>")
+    exitProcess(2)
+}
+
+// readBuildFile reads the module from a module.xml file written by gen-kotlin-build-file.py.
+private fun readBuildFile(buildFile: File): Module {
+    val doc = DocumentBuilderFactory.newInstance().newDocumentBuilder().parse(buildFile)
+    val modules = doc.getElementsByTagName("module")
+    if (modules.length != 1) {
+        usage("expected a single module in $buildFile, found ${modules.length}")
+    }
+    val module = modules.item(0) as org.w3c.dom.Element
+    fun paths(tag: String): List<File> {
+        val elements = module.getElementsByTagName(tag)
+        return (0 until elements.length).map {
+            File((elements.item(it) as org.w3c.dom.Element).getAttribute("path"))
+        }
+    }
+    return Module(
+        name = module.getAttribute("name"),
+        outputDir = File(module.getAttribute("outputDir")),
+        sources = paths("sources"),
+        commonSources = paths("commonSources"),
+        javaSourceRoots = paths("javaSourceRoots"),
+        classpath = paths("classpath"),
+    )
+}
+
+private fun sha256(file: File): String =
+    MessageDigest.getInstance("SHA-256").digest(file.readBytes()).joinToString("") { "%02x".format(it) }
+
+// readSourcesState returns the hashes of the sources of the last successful compilation, or null if
+// there was none.
+private fun readSourcesState(cachesDir: File): Map<File, String>? {
+    val state = File(cachesDir, SOURCES_STATE)
+    if (!state.exists()) {
+        return null
+    }
+    return state.readLines().filter { it.isNotEmpty() }.associate {
+        val (hash, path) = it.split(" ", limit = 2)
+        File(path) to hash
+    }
+}
+
+private fun writeSourcesState(cachesDir: File, hashes: Map<File, String>) {
+    val tmp = File(cachesDir, "$SOURCES_STATE.tmp")
+    tmp.writeText(hashes.entries.joinToString("") { "${it.value} ${it.key.path}\n" })
+    if (!tmp.renameTo(File(cachesDir, SOURCES_STATE))) {
+        throw RuntimeException("failed to rename $tmp")
+    }
+}
+
+private object StderrLogger : KotlinLogger {
+    override val isDebugEnabled = false
+
+    override fun error(msg: String, throwable: Throwable?) {
+        System.err.println(msg)
+        throwable?.printStackTrace()
+    }
+
+    override fun warn(msg: String) = System.err.println(msg)
+
+    override fun info(msg: String) {}
+
+    override fun debug(msg: String) {}
+
+    override fun lifecycle(msg: String) {}
+}
+
+fun main(args: Array<String>) {
+    val separator = args.indexOf("--")
+    if (separator < 0) {
+        usage("missing -- before the kotlinc arguments")
+    }
+    var cachesDir: File? = null
+    var i = 0
+    while (i < separator) {
+        when (args[i]) {
+            "--caches_dir" -> {
+                if (i + 1 >= separator) {
+                    usage("--caches_dir requires an argument")
+                }
+                cachesDir = File(args[++i])
+            }
+            else -> usage("unknown argument ${args[i]}")
+        }
+        i++
+    }
+    if (cachesDir == null) {
+        usage("--caches_dir is required")
+    }
+
+    // The build tools API takes the sources and the output directory directly instead of a
+    // module.xml file, so turn the module into the equivalent kotlinc arguments.
+    val kotlincArgs = args.drop(separator + 1)
+    val buildFileArg = kotlincArgs.firstOrNull { it.startsWith(BUILD_FILE_FLAG) }
+        ?: usage("missing $BUILD_FILE_FLAG in the kotlinc arguments")
+    val module = readBuildFile(File(buildFileArg.removePrefix(BUILD_FILE_FLAG)))
+    val compilerArgs = kotlincArgs.filter { it != buildFileArg }.toMutableList()
+    compilerArgs += listOf("-module-name", module.name, "-d", module.outputDir.path)
+    if (module.classpath.isNotEmpty()) {
+        compilerArgs += listOf("-classpath", module.classpath.joinToString(File.pathSeparator))
+    }
+    if (module.commonSources.isNotEmpty()) {
+        compilerArgs += "-Xcommon-sources=" + module.commonSources.joinToString(",")
+    }
+
+    // The .java sources are passed as sources too, so that changes to them also invalidate the
+    // Kotlin sources that use them.
+    val sources = (module.sources + module.javaSourceRoots).distinct()
+    val hashes = sources.associateWith { sha256(it) }
+    val previous = readSourcesState(cachesDir)
+    val changes = if (previous == null) {
+        SourcesChanges.Unknown
+    } else {
+        SourcesChanges.Known(
+            modifiedFiles = hashes.filter { previous[it.key] != it.value }.keys.toList(),
+            removedFiles = previous.keys.filter { it !in hashes },
+        )
+    }
+
+    val service = CompilationService.loadImplementation(CompilationService::class.java.classLoader)
+    val strategy = service.makeCompilerExecutionStrategyConfiguration().useInProcessStrategy()
+    val config = service.makeJvmCompilationConfiguration().useLogger(StderrLogger)
+    val icOptions = config.makeClasspathSnapshotBasedIncrementalCompilationConfiguration()
+        .setRootProjectDir(File(".").absoluteFile)
+        .setBuildDir(cachesDir.absoluteFile)
+        .useOutputDirs(listOf(module.outputDir.absoluteFile, cachesDir.absoluteFile))
+        // The classpath is not snapshotted, the caches are deleted when it changes instead.
+        .assureNoClasspathSnapshotsChanges(true)
+    config.useIncrementalCompilation(
+        cachesDir,
+        changes,
+        ClasspathSnapshotBasedIncrementalCompilationApproachParameters(
+            newClasspathSnapshotFiles = emptyList(),
+            shrunkClasspathSnapshot = File(cachesDir, "shrunk-classpath-snapshot.bin"),
+        ),
+        icOptions,
+    )
+
+    val projectId = ProjectId.ProjectUUID(UUID.nameUUIDFromBytes(module.outputDir.absolutePath.toByteArray()))
+    val result = service.compileJvm(projectId, strategy, config, sources, compilerArgs)
+    service.finishProjectCompilation(projectId)
+    if (result != CompilationResult.COMPILATION_SUCCESS) {
+        // Drop the state so that the next build recompiles every source.
+        File(cachesDir, SOURCES_STATE).delete()
+        exitProcess(1)
+    }
+    writeSourcesState(cachesDir, hashes)
+}
@@ -29,10 +29,41 @@ import (
 var (
 	outputDir  = flag.String("d", "", "output dir")
 	outputFile = flag.String("l", "", "output list file")
-	filter     = flag.String("f", "", "optional filter pattern")
 	zipPrefix  = flag.String("zip-prefix", "", "optional prefix within the zip file to extract, stripping the prefix")
+	filters    multiFlag
 )
 
+func init() {
+	flag.Var(&filters, "f", "optional filter pattern, may be repeated to extract the files matching any of the patterns")
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, " ")
+}
+
+func (m *multiFlag) Set(s string) error {
+	*m = append(*m, s)
+	return nil
+}
+
+// matchesFilters returns true if the base name of the file matches one of the filters, or if there
+// are no filters.
+func matchesFilters(name string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if match, err := filepath.Match(filter, filepath.Base(name)); err != nil {
+			log.Fatal(err)
+		} else if match {
+			return true
+		}
+	}
+	return false
+}
+
 func must(err error) {
 	if err != nil {
 		log.Fatal(err)
@@ -65,7 +96,7 @@ func writeSymlink(filename string, in io.Reader) error {
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "usage: zipsync -d <output dir> [-l <output file>] [-f <pattern>] [zip]...")
+		fmt.Fprintln(os.Stderr, "usage: zipsync -d <output dir> [-l <output file>] [-f <pattern>]... [zip]...")
 		flag.PrintDefaults()
 	}
 
@@ -107,12 +138,8 @@ func main() {
 				}
 				name = strings.TrimPrefix(name, *zipPrefix)
 			}
-			if *filter != "" {
-				if match, err := filepath.Match(*filter, filepath.Base(name)); err != nil {
-					log.Fatal(err)
-				} else if !match {
-					continue
-				}
+			if !matchesFilters(name) {
+				continue
 			}
 			if filepath.IsAbs(name) {
 				log.Fatalf("%q in %q is an absolute path", name, input)
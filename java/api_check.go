@@ -0,0 +1,131 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+
+	"android/soong/android"
+)
+
+// This file implements a lightweight API check for java_library modules.  Unlike droidstubs, which
+// runs metalava over the sources, the API is extracted from the classes compiled from the sources
+// of the library, without its static_libs, with header_jar_abi -api, one line per public or
+// protected class and member.  Removing or changing a line of the checked-in API file is an
+// incompatible change, adding a line is a compatible change that still requires the file to be
+// updated with m <module>-update-current-api.
+
+type apiCheckProperties struct {
+	Api_check struct {
+		// Path to the checked-in file listing the public API of the library, e.g.
+		// "api/current.txt".  The file is compared against the API extracted from the classes of
+		// the library on every build, and can be updated with m <module>-update-current-api.
+		Current *string `android:"path"`
+	}
+}
+
+// apiCheck builds the rules that extract the API of the library from its classes, check it
+// against the checked-in API file and update the checked-in API file.
+func (j *Library) apiCheck(ctx android.ModuleContext) {
+	if j.apiCheckProperties.Api_check.Current == nil {
+		return
+	}
+
+	// All the variants of the library have the same API, only check it once.
+	apexInfo := ctx.Provider(android.ApexInfoProvider).(android.ApexInfo)
+	if ctx.PrimaryModule() != ctx.Module() || !apexInfo.IsForPlatform() {
+		return
+	}
+
+	apiFile := android.PathForModuleSrc(ctx, String(j.apiCheckProperties.Api_check.Current))
+	// The API is extracted from the classes compiled from the sources of the library only, the
+	// header jar of the library also contains the classes of its static_libs.
+	var classesJar android.Path
+	switch len(j.localClassesJars) {
+	case 0:
+		ctx.PropertyErrorf("api_check.current", "module has no classes to extract an API from")
+		return
+	case 1:
+		classesJar = j.localClassesJars[0]
+	default:
+		combinedJar := android.PathForModuleOut(ctx, "api_check", "classes.jar")
+		TransformJarsToJar(ctx, combinedJar, "for API check", j.localClassesJars,
+			android.OptionalPath{}, false, nil, nil)
+		classesJar = combinedJar
+	}
+
+	generatedApiFile := android.PathForModuleOut(ctx, "api_check", "current.txt")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("header_jar_abi").
+		Flag("-api").
+		FlagWithOutput("-o ", generatedApiFile).
+		Input(classesJar)
+	rule.Build("apiCheckExtract", "extract API")
+
+	checkTimestamp := android.PathForModuleOut(ctx, "api_check", "check_current_api.timestamp")
+	diffFile := android.PathForModuleOut(ctx, "api_check", "current.diff")
+
+	msg := fmt.Sprintf(`\n******************************\n`+
+		`You have tried to change the API of %[1]s from what has been previously approved.\n\n`+
+		`To make these errors go away, you have two choices:\n`+
+		`   1. You can make the new classes, methods, etc. shown in the above diff\n`+
+		`      package private.\n\n`+
+		`   2. You can update %[2]s by executing the following command:\n`+
+		`         m %[1]s-update-current-api\n`+
+		`******************************\n`, ctx.ModuleName(), apiFile)
+
+	// Lines removed from the checked-in API file are classes or members that were removed or
+	// changed, which breaks the users of the library.
+	incompatibleMsg := fmt.Sprintf(`\n******************************\n`+
+		`You have made an incompatible change to the API of %[1]s: the lines removed in the\n`+
+		`above diff are classes, methods, etc. that its users may depend on.\n\n`+
+		`If the change is intended and all the users of the library are updated with it,\n`+
+		`update %[2]s by executing the following command:\n`+
+		`         m %[1]s-update-current-api\n`+
+		`******************************\n`, ctx.ModuleName(), apiFile)
+
+	rule = android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("(").
+		Text("diff -u").Input(apiFile).Input(generatedApiFile).
+		Text(">").Output(diffFile).
+		Text("&&").
+		Text("touch").Output(checkTimestamp).
+		Text(") || (").
+		Text("cat").Text(diffFile.String()).
+		Text("; if grep -q '^-[^-]'").Text(diffFile.String()).Text("; then").
+		Text("echo").Flag("-e").Flag(`"` + incompatibleMsg + `"`).
+		Text("; else").
+		Text("echo").Flag("-e").Flag(`"` + msg + `"`).
+		Text("; fi; exit 38").
+		Text(")")
+	rule.Build("apiCheckCurrent", "check current API")
+
+	updateTimestamp := android.PathForModuleOut(ctx, "api_check", "update_current_api.timestamp")
+	rule = android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("cp").Flag("-f").
+		Input(generatedApiFile).Flag(apiFile.String()).
+		Text("&&").
+		Text("touch").Output(updateTimestamp)
+	rule.Build("apiCheckUpdate", "update current API")
+
+	ctx.Phony(ctx.ModuleName()+"-check-current-api", checkTimestamp)
+	ctx.Phony("checkapi", checkTimestamp)
+	ctx.Phony("droidcore", android.PathForPhony(ctx, "checkapi"))
+
+	ctx.Phony(ctx.ModuleName()+"-update-current-api", updateTimestamp)
+	ctx.Phony("update-api", updateTimestamp)
+}
@@ -107,6 +107,20 @@ type appProperties struct {
 	// it in the APK as an asset.
 	Embed_notices *bool
 
+	Baseline_profile struct {
+		// Path to a human-readable ART baseline profile, like the baseline-prof.txt files used by
+		// Gradle.  The profile is compiled with profman against the dex files of the app and stored
+		// in the APK as assets/dexopt/baseline.prof, where the profile installer library expects it.
+		// profman does not generate the assets/dexopt/baseline.profm metadata file, without which
+		// the profile installer library does not install the profile on Android 12 and later; use
+		// dexpreopt to apply the profile on those releases.
+		Src *string `android:"path"`
+
+		// If true, also use the baseline profile to guide dexpreopt of the app when
+		// dex_preopt.profile is not set.  Defaults to false.
+		Dexpreopt *bool
+	}
+
 	// cc.Coverage related properties
 	PreventInstall    bool `blueprint:"mutated"`
 	HideFromMake      bool `blueprint:"mutated"`
@@ -156,6 +170,9 @@ type AndroidApp struct {
 
 	bundleFile android.Path
 
+	// the size report of the APK, only built when requested through the ".size_report" output tag.
+	apkSizeReport android.Path
+
 	// the install APK name is normally the same as the module name, but can be overridden with PRODUCT_PACKAGE_NAME_OVERRIDES.
 	installApkName string
 
@@ -444,6 +461,45 @@ func (a *AndroidApp) proguardBuildActions(ctx android.ModuleContext) {
 
 	a.Module.extraProguardFlagFiles = append(a.Module.extraProguardFlagFiles, staticLibProguardFlagFiles...)
 	a.Module.extraProguardFlagFiles = append(a.Module.extraProguardFlagFiles, a.proguardOptionsFile)
+	a.Module.proguardFlagFileOrigins = staticLibProguardFlagFileOrigins(ctx)
+}
+
+// staticLibProguardFlagFileOrigins returns the name of the static android library that contributed
+// each proguard flag file exported by the transitive static library dependencies of the module.  The
+// flag files exported by a library include the ones of its own static libraries, so a flag file is
+// attributed to the library that exports it without getting it from one of its static libraries.
+func staticLibProguardFlagFileOrigins(ctx android.ModuleContext) map[string]string {
+	exported := make(map[android.Module]android.Paths)
+	staticLibs := make(map[android.Module][]android.Module)
+	var libs []android.Module
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		lib, ok := child.(AndroidLibraryDependency)
+		if !ok || ctx.OtherModuleDependencyTag(child) != staticLibTag {
+			return false
+		}
+		staticLibs[parent] = append(staticLibs[parent], child)
+		if _, visited := exported[child]; !visited {
+			exported[child] = lib.ExportedProguardFlagFiles()
+			libs = append(libs, child)
+		}
+		return true
+	})
+
+	origins := make(map[string]string)
+	for _, lib := range libs {
+		fromStaticLibs := make(map[string]bool)
+		for _, staticLib := range staticLibs[lib] {
+			for _, flagFile := range exported[staticLib] {
+				fromStaticLibs[flagFile.String()] = true
+			}
+		}
+		for _, flagFile := range exported[lib] {
+			if _, exists := origins[flagFile.String()]; !exists && !fromStaticLibs[flagFile.String()] {
+				origins[flagFile.String()] = ctx.OtherModuleName(lib)
+			}
+		}
+	}
+	return origins
 }
 
 func (a *AndroidApp) installPath(ctx android.ModuleContext) android.InstallPath {
@@ -472,6 +528,10 @@ func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	a.dexpreopter.classLoaderContexts = a.classLoaderContexts
 	a.dexpreopter.manifestFile = a.mergedManifestFile
 
+	if Bool(a.appProperties.Baseline_profile.Dexpreopt) {
+		a.dexpreopter.defaultProfile = String(a.appProperties.Baseline_profile.Src)
+	}
+
 	if ctx.ModuleName() != "framework-res" {
 		a.Module.compile(ctx, a.aaptSrcJar)
 	}
@@ -479,6 +539,45 @@ func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	return a.dexJarFile
 }
 
+// baselineProfileBuildActions compiles the baseline profile of the app against its dex jar, and
+// returns a zip containing the compiled profile at the location where the profile installer library
+// looks for it in the APK, or nil if the app has no baseline profile.  Only baseline.prof is
+// generated, the baseline.profm metadata file that Gradle adds for Android 12 and later is not
+// supported by profman.
+func (a *AndroidApp) baselineProfileBuildActions(ctx android.ModuleContext, dexJarFile android.Path) android.Path {
+	if a.appProperties.Baseline_profile.Src == nil {
+		return nil
+	}
+	if dexJarFile == nil {
+		ctx.PropertyErrorf("baseline_profile.src", "app has no dex files to compile the profile against")
+		return nil
+	}
+
+	profile := android.PathForModuleOut(ctx, "baseline_profile", "baseline.prof")
+	profileZip := android.PathForModuleOut(ctx, "baseline_profile.zip")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	// The dex location is the name of the APK once installed, which profman uses to compute the
+	// profile keys of the dex files.
+	rule.Command().
+		Text(`ANDROID_LOG_TAGS="*:e"`).
+		BuiltTool("profman").
+		FlagWithInput("--create-profile-from=", android.PathForModuleSrc(ctx, *a.appProperties.Baseline_profile.Src)).
+		FlagWithInput("--apk=", dexJarFile).
+		Flag("--dex-location=base.apk").
+		Flag("--output-profile-type=app").
+		FlagWithOutput("--reference-profile-file=", profile)
+	rule.Command().
+		BuiltTool("soong_zip").
+		FlagWithOutput("-o ", profileZip).
+		FlagWithArg("-P ", "assets/dexopt").
+		FlagWithArg("-C ", profile.Dir().String()).
+		FlagWithInput("-f ", profile)
+	rule.Build("baseline_profile", "compile baseline profile")
+
+	return profileZip
+}
+
 func (a *AndroidApp) jniBuildActions(jniLibs []jniLib, ctx android.ModuleContext) android.WritablePath {
 	var jniJarFile android.WritablePath
 	if len(jniLibs) > 0 {
@@ -693,8 +792,12 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 	if lineage := String(a.overridableAppProperties.Lineage); lineage != "" {
 		lineageFile = android.PathForModuleSrc(ctx, lineage)
 	}
-	CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, dexJarFile, certificates, apkDeps, v4SignatureFile, lineageFile)
+	profileZip := a.baselineProfileBuildActions(ctx, dexJarFile)
+	CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, dexJarFile, profileZip, certificates, apkDeps, v4SignatureFile, lineageFile)
 	a.outputFile = packageFile
+	apkSizeReport := android.PathForModuleOut(ctx, a.installApkName+"-size.json")
+	BuildApkSizeReport(ctx, apkSizeReport, packageFile)
+	a.apkSizeReport = apkSizeReport
 	if v4SigningRequested {
 		a.extraOutputFiles = append(a.extraOutputFiles, v4SignatureFile)
 	}
@@ -705,7 +808,7 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 		if v4SigningRequested {
 			v4SignatureFile = android.PathForModuleOut(ctx, a.installApkName+"_"+split.suffix+".apk.idsig")
 		}
-		CreateAndSignAppPackage(ctx, packageFile, split.path, nil, nil, certificates, apkDeps, v4SignatureFile, lineageFile)
+		CreateAndSignAppPackage(ctx, packageFile, split.path, nil, nil, nil, certificates, apkDeps, v4SignatureFile, lineageFile)
 		a.extraOutputFiles = append(a.extraOutputFiles, packageFile)
 		if v4SigningRequested {
 			a.extraOutputFiles = append(a.extraOutputFiles, v4SignatureFile)
@@ -888,6 +991,8 @@ func (a *AndroidApp) OutputFiles(tag string) (android.Paths, error) {
 		return []android.Path{a.aaptSrcJar}, nil
 	case ".export-package.apk":
 		return []android.Path{a.exportPackage}, nil
+	case ".size_report":
+		return []android.Path{a.apkSizeReport}, nil
 	}
 	return a.Library.OutputFiles(tag)
 }
@@ -52,7 +52,7 @@ var combineApk = pctx.AndroidStaticRule("combineApk",
 	})
 
 func CreateAndSignAppPackage(ctx android.ModuleContext, outputFile android.WritablePath,
-	packageFile, jniJarFile, dexJarFile android.Path, certificates []Certificate, deps android.Paths, v4SignatureFile android.WritablePath, lineageFile android.Path) {
+	packageFile, jniJarFile, dexJarFile, profileZip android.Path, certificates []Certificate, deps android.Paths, v4SignatureFile android.WritablePath, lineageFile android.Path) {
 
 	unsignedApkName := strings.TrimSuffix(outputFile.Base(), ".apk") + "-unsigned.apk"
 	unsignedApk := android.PathForModuleOut(ctx, unsignedApkName)
@@ -65,6 +65,9 @@ func CreateAndSignAppPackage(ctx android.ModuleContext, outputFile android.Writa
 	if jniJarFile != nil {
 		inputs = append(inputs, jniJarFile)
 	}
+	if profileZip != nil {
+		inputs = append(inputs, profileZip)
+	}
 
 	ctx.Build(pctx, android.BuildParams{
 		Rule:      combineApk,
@@ -117,6 +120,27 @@ func SignAppPackage(ctx android.ModuleContext, signedApk android.WritablePath, u
 	})
 }
 
+var apkSizeReport = pctx.AndroidStaticRule("apkSizeReport",
+	blueprint.RuleParams{
+		Command:     `${config.ApkSizeReportCmd} --name ${name} --output $out $in`,
+		CommandDeps: []string{"${config.ApkSizeReportCmd}"},
+	},
+	"name")
+
+// BuildApkSizeReport writes a JSON report of the size of the dex code, resources, native libraries
+// and assets of an APK.  Reports of two builds of an APK can be compared with apk_size_diff.
+func BuildApkSizeReport(ctx android.ModuleContext, outputFile android.WritablePath, apk android.Path) {
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        apkSizeReport,
+		Description: "apk size report",
+		Input:       apk,
+		Output:      outputFile,
+		Args: map[string]string{
+			"name": ctx.ModuleName(),
+		},
+	})
+}
+
 var buildAAR = pctx.AndroidStaticRule("buildAAR",
 	blueprint.RuleParams{
 		Command: `rm -rf ${outDir} && mkdir -p ${outDir} && ` +
@@ -2873,3 +2873,136 @@ func TestExportedProguardFlagFiles(t *testing.T) {
 		t.Errorf("App does not use library proguard config")
 	}
 }
+
+func TestBaselineProfile(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			baseline_profile: {
+				src: "baseline-prof.txt",
+				dexpreopt: true,
+			},
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			baseline_profile: {
+				src: "baseline-prof.txt",
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	profman := foo.Rule("baseline_profile")
+	android.AssertStringDoesContain(t, "profman command", profman.RuleParams.Command,
+		"--create-profile-from=baseline-prof.txt")
+	android.AssertStringListContains(t, "profman inputs", profman.Implicits.Strings(),
+		foo.Module().(*AndroidApp).dexJarFile.RelativeToTop().String())
+	android.AssertStringDoesContain(t, "soong_zip command", profman.RuleParams.Command,
+		"-P assets/dexopt -C out/soong/.intermediates/foo/android_common/baseline_profile")
+
+	apk := foo.Output("foo-unsigned.apk")
+	android.AssertStringListContains(t, "apk inputs", apk.Inputs.Strings(),
+		"out/soong/.intermediates/foo/android_common/baseline_profile.zip")
+
+	android.AssertStringDoesContain(t, "dexpreopt command", foo.Rule("dexpreopt").RuleParams.Command,
+		"--create-profile-from=baseline-prof.txt")
+	if profile := foo.Module().(*AndroidApp).dexpreoptProperties.Dex_preopt.Profile; profile != nil {
+		t.Errorf("expected dex_preopt.profile to be left unset, got %q", *profile)
+	}
+
+	bar := result.ModuleForTests("bar", "android_common")
+	android.AssertStringListContains(t, "apk inputs", bar.Output("bar-unsigned.apk").Inputs.Strings(),
+		"out/soong/.intermediates/bar/android_common/baseline_profile.zip")
+	android.AssertStringDoesNotContain(t, "dexpreopt command", bar.Rule("dexpreopt").RuleParams.Command,
+		"--create-profile-from")
+}
+
+func TestApkSizeReport(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	report := foo.Output("foo-size.json")
+	android.AssertPathRelativeToTopEquals(t, "size report input",
+		"out/soong/.intermediates/foo/android_common/foo.apk", report.Input)
+	android.AssertStringEquals(t, "size report name", "foo", report.Args["name"])
+
+	android.AssertPathsRelativeToTopEquals(t, ".size_report",
+		[]string{"out/soong/.intermediates/foo/android_common/foo-size.json"},
+		foo.OutputFiles(t, ".size_report"))
+}
+
+func TestProguardMergedConfig(t *testing.T) {
+	result := PrepareForTestWithJavaDefaultModules.RunTestWithBp(t, `
+		android_app {
+			name: "foo",
+			sdk_version: "current",
+			static_libs: ["lib1"],
+			optimize: {
+				shrink: true,
+				proguard_flags: ["-keep class foo.Foo"],
+				proguard_flags_files: ["fooproguard.cfg"],
+			},
+		}
+
+		android_library {
+			name: "lib1",
+			sdk_version: "current",
+			static_libs: ["lib2"],
+			optimize: {
+				proguard_flags_files: ["lib1proguard.cfg"],
+			},
+		}
+
+		android_library {
+			name: "lib2",
+			sdk_version: "current",
+			optimize: {
+				proguard_flags_files: ["lib2proguard.cfg"],
+			},
+		}
+	`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	sources := android.ContentFromFileRuleForTests(t, foo.Output("proguard_merged_config.sources"))
+	android.AssertStringDoesContain(t, "build flags", sources, "file\tbuild/make/core\tbuild/make/core/proguard.flags\n")
+	android.AssertStringDoesContain(t, "lib1 flags", sources, "file\tlib1\tlib1proguard.cfg\n")
+	android.AssertStringDoesContain(t, "lib2 flags", sources, "file\tlib2\tlib2proguard.cfg\n")
+	android.AssertStringDoesContain(t, "foo flags", sources, "file\tfoo\tfooproguard.cfg\n")
+	android.AssertStringDoesContain(t, "inline flags", sources, "flag\tfoo\t-keep class foo.Foo\n")
+	android.AssertStringDoesContain(t, "optimize flags", sources, "flag\tfoo (optimize properties)\t-dontoptimize\n")
+	android.AssertStringDoesNotContain(t, "optimize flags", sources, "-dontshrink")
+
+	mergedConfig := foo.Output("proguard_merged_config.txt")
+	android.AssertStringListContains(t, "merged config inputs", mergedConfig.Implicits.Strings(), "lib2proguard.cfg")
+	android.AssertPathRelativeToTopEquals(t, "merged config depfile",
+		"out/soong/.intermediates/foo/android_common/proguard_merged_config.d", mergedConfig.Depfile)
+
+	r8 := foo.Rule("java.r8")
+	android.AssertStringDoesContain(t, "r8 command", r8.RuleParams.Command, "-printseeds ${outSeeds}")
+	android.AssertStringEquals(t, "seeds", "out/soong/.intermediates/foo/android_common/proguard_seeds.txt",
+		r8.Args["outSeeds"])
+
+	android.AssertPathsRelativeToTopEquals(t, ".proguard_config",
+		[]string{"out/soong/.intermediates/foo/android_common/proguard_merged_config.txt"},
+		foo.OutputFiles(t, ".proguard_config"))
+	android.AssertPathsRelativeToTopEquals(t, ".proguard_usage",
+		[]string{"out/soong/.intermediates/foo/android_common/proguard_usage.zip"},
+		foo.OutputFiles(t, ".proguard_usage"))
+	android.AssertPathsRelativeToTopEquals(t, ".proguard_seeds",
+		[]string{"out/soong/.intermediates/foo/android_common/proguard_seeds.txt"},
+		foo.OutputFiles(t, ".proguard_seeds"))
+}
@@ -17,6 +17,7 @@ package java
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -108,7 +109,8 @@ type CommonProperties struct {
 	// more recompilation.
 	Exported_plugins []string
 
-	// The number of Java source entries each Javac instance can process
+	// The number of Java source entries each Javac instance can process.  If unset, modules with
+	// many sources are sharded automatically, set to 0 to disable sharding.
 	Javac_shard_size *int64
 
 	// Add host jdk tools.jar to bootclasspath
@@ -162,6 +164,12 @@ type CommonProperties struct {
 		// environment variable is true. Setting this to false will improve build
 		// performance more than adding -XepDisableAllChecks in javacflags.
 		Enabled *bool
+
+		// List of "<check>:<count>" entries, the number of findings of an Error Prone check
+		// that the module is allowed to have when Error Prone findings are reported as SARIF
+		// with ERROR_PRONE_SARIF=true.  The build fails if a check has more findings, which
+		// allows reducing the findings of a check over time without making it an error.
+		Allowed_warnings []string
 	}
 
 	Proto struct {
@@ -177,6 +185,10 @@ type CommonProperties struct {
 	// If true, package the kotlin stdlib into the jar.  Defaults to true.
 	Static_kotlin_stdlib *bool `android:"arch_variant"`
 
+	// The version of the Kotlin language of the kotlin sources, e.g. "1.9" or "2.0".  Versions 2.0
+	// and above are compiled with the K2 compiler front end.  Defaults to the version of kotlinc.
+	Kotlin_lang_version *string
+
 	// A list of java_library instances that provide additional hiddenapi annotations for the library.
 	Hiddenapi_additional_annotations []string
 }
@@ -298,6 +310,10 @@ type Module struct {
 	// resources
 	implementationJarFile android.Path
 
+	// jar files containing the classes compiled from the sources of the module, without its static
+	// library dependencies, used to extract its API
+	localClassesJars android.Paths
+
 	// jar file containing only resources including from static library dependencies
 	resourceJar android.Path
 
@@ -367,6 +383,9 @@ type Module struct {
 	// list of the xref extraction files
 	kytheFiles android.Paths
 
+	// SARIF file containing the Error Prone findings of the module
+	errorProneSarif android.Path
+
 	// Collect the module directory for IDE info in java/jdeps.go.
 	modulePaths []string
 
@@ -463,6 +482,24 @@ func (j *Module) OutputFiles(tag string) (android.Paths, error) {
 			return android.Paths{j.dexer.proguardDictionary.Path()}, nil
 		}
 		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".proguard_config":
+		// The R8 configuration of the module with the origin of each rule.
+		if j.dexer.proguardMergedConfig.Valid() {
+			return android.Paths{j.dexer.proguardMergedConfig.Path()}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".proguard_usage":
+		// A zip of the code removed by R8.
+		if j.dexer.proguardUsageZip.Valid() {
+			return android.Paths{j.dexer.proguardUsageZip.Path()}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
+	case ".proguard_seeds":
+		// The classes and members matched by the keep rules of the module.
+		if j.dexer.proguardSeeds.Valid() {
+			return android.Paths{j.dexer.proguardSeeds.Path()}, nil
+		}
+		return nil, fmt.Errorf("%q was requested, but no output file was found.", tag)
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -733,6 +770,7 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 	flags.classpath = append(flags.classpath, deps.classpath...)
 	flags.java9Classpath = append(flags.java9Classpath, deps.java9Classpath...)
 	flags.processorPath = append(flags.processorPath, deps.processorPath...)
+	flags.kspProcessorPath = append(flags.kspProcessorPath, deps.kspProcessorPath...)
 	flags.errorProneProcessorPath = append(flags.errorProneProcessorPath, deps.errorProneProcessorPath...)
 
 	flags.processors = append(flags.processors, deps.processorClasses...)
@@ -911,6 +949,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		if ctx.Device() {
 			kotlincFlags = append(kotlincFlags, "-no-jdk")
 		}
+		if langVersion := j.kotlinLangVersion(ctx); langVersion != "" {
+			kotlincFlags = append(kotlincFlags, "-language-version", langVersion)
+		}
 		if len(kotlincFlags) > 0 {
 			// optimization.
 			ctx.Variable(pctx, "kotlincFlags", strings.Join(kotlincFlags, " "))
@@ -931,6 +972,22 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		flags.kotlincClasspath = append(flags.kotlincClasspath, flags.bootClasspath...)
 		flags.kotlincClasspath = append(flags.kotlincClasspath, flags.classpath...)
 
+		if len(flags.kspProcessorPath) > 0 {
+			// Use KSP for the processors that support it
+			for _, jar := range config.KotlinKspJars {
+				if !android.ExistentPathForSource(ctx, jar).Valid() {
+					ctx.PropertyErrorf("plugins", "cannot use KSP plugins, missing %s?", jar)
+				}
+			}
+			kspSrcJar := android.PathForModuleOut(ctx, "ksp", "ksp-sources.jar")
+			kspResJar := android.PathForModuleOut(ctx, "ksp", "ksp-res.jar")
+			kotlinKsp(ctx, kspSrcJar, kspResJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
+			srcJars = append(srcJars, kspSrcJar)
+			kotlinJars = append(kotlinJars, kspResJar)
+			flags.kspProcessorPath = nil
+			flags.kotlincSrcJarsHaveKotlin = true
+		}
+
 		if len(flags.processorPath) > 0 {
 			// Use kapt for annotation processing
 			kaptSrcJar := android.PathForModuleOut(ctx, "kapt", "kapt-sources.jar")
@@ -953,12 +1010,17 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		flags.classpath = append(flags.classpath, kotlinJar)
 
 		kotlinJars = append(kotlinJars, kotlinJar)
+		j.localClassesJars = append(j.localClassesJars, kotlinJar)
 		// Jar kotlin classes into the final jar after javac
 		if BoolDefault(j.properties.Static_kotlin_stdlib, true) {
 			kotlinJars = append(kotlinJars, deps.kotlinStdlib...)
 		}
 	}
 
+	if len(flags.kspProcessorPath) > 0 {
+		ctx.PropertyErrorf("plugins", "KSP plugins can only be used by modules with kotlin sources")
+	}
+
 	jars := append(android.Paths(nil), kotlinJars...)
 
 	// Store the list of .java files that was passed to javac
@@ -966,9 +1028,10 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	j.compiledSrcJars = srcJars
 
 	enableSharding := false
+	shardSize := 0
 	var headerJarFileWithoutJarjar android.Path
 	if ctx.Device() && !ctx.Config().IsEnvFalse("TURBINE_ENABLED") && !deps.disableTurbine {
-		if j.properties.Javac_shard_size != nil && *(j.properties.Javac_shard_size) > 0 {
+		if shardSize = j.javacShardSize(ctx, len(uniqueSrcFiles), flags); shardSize > 0 {
 			enableSharding = true
 			// Formerly, there was a check here that prevented annotation processors
 			// from being used when sharding was enabled, as some annotation processors
@@ -981,6 +1044,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		if ctx.Failed() {
 			return
 		}
+		if len(uniqueSrcFiles) > 0 || len(srcJars) > 0 {
+			j.localClassesJars = append(j.localClassesJars, android.PathForModuleOut(ctx, "turbine", jarName))
+		}
 	}
 	if len(uniqueSrcFiles) > 0 || len(srcJars) > 0 {
 		var extraJarDeps android.Paths
@@ -997,16 +1063,23 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 			// this module, or else we could have duplicated errorprone messages.
 			errorproneFlags := enableErrorproneFlags(flags)
 			errorprone := android.PathForModuleOut(ctx, "errorprone", jarName)
+			if errorProneSarifEnabled(ctx.Config()) {
+				errorproneFlags.javacLog = android.PathForModuleOut(ctx, "errorprone", "errorprone.log")
+			}
 
 			transformJavaToClasses(ctx, errorprone, -1, uniqueSrcFiles, srcJars, errorproneFlags, nil,
 				"errorprone", "errorprone")
 
 			extraJarDeps = append(extraJarDeps, errorprone)
+
+			if errorproneFlags.javacLog != nil {
+				j.errorProneSarif = j.errorProneReport(ctx, errorproneFlags.javacLog)
+				extraJarDeps = append(extraJarDeps, j.errorProneSarif)
+			}
 		}
 
 		if enableSharding {
 			flags.classpath = append(flags.classpath, headerJarFileWithoutJarjar)
-			shardSize := int(*(j.properties.Javac_shard_size))
 			var shardSrcs []android.Paths
 			if len(uniqueSrcFiles) > 0 {
 				shardSrcs = android.ShardPaths(uniqueSrcFiles, shardSize)
@@ -1028,6 +1101,10 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		if ctx.Failed() {
 			return
 		}
+		if j.headerJarFile == nil {
+			// Without turbine, the classes of the module are the javac jars, after the kotlin jars.
+			j.localClassesJars = append(j.localClassesJars, jars[len(kotlinJars):]...)
+		}
 	}
 
 	j.srcJarArgs, j.srcJarDeps = resourcePathsToJarArgs(srcFiles), srcFiles
@@ -1299,6 +1376,9 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		j.linter.compileSdkKind = j.SdkVersion(ctx).Kind
 		j.linter.javaLanguageLevel = flags.javaVersion.String()
 		j.linter.kotlinLanguageLevel = "1.3"
+		if langVersion := String(j.properties.Kotlin_lang_version); kotlinLangVersionRegexp.MatchString(langVersion) {
+			j.linter.kotlinLanguageLevel = langVersion
+		}
 		if !apexInfo.IsForPlatform() && ctx.Config().UnbundledBuildApps() {
 			j.linter.buildModuleReportZip = true
 		}
@@ -1361,6 +1441,27 @@ func (j *Module) compileJavaClasses(ctx android.ModuleContext, jarName string, i
 	return classes
 }
 
+var kotlinLangVersionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// kotlinLangVersion returns the value of the kotlin_lang_version property, or an empty string if it
+// is not set or invalid.
+func (j *Module) kotlinLangVersion(ctx android.ModuleContext) string {
+	langVersion := String(j.properties.Kotlin_lang_version)
+	if langVersion == "" {
+		return ""
+	}
+	if !kotlinLangVersionRegexp.MatchString(langVersion) {
+		ctx.PropertyErrorf("kotlin_lang_version", "expected a version like \"1.9\", got %q", langVersion)
+		return ""
+	}
+	for _, flag := range j.properties.Kotlincflags {
+		if strings.HasPrefix(flag, "-language-version") {
+			ctx.PropertyErrorf("kotlincflags", "use kotlin_lang_version instead of -language-version")
+		}
+	}
+	return langVersion
+}
+
 // Check for invalid kotlinc flags. Only use this for flags explicitly passed by the user,
 // since some of these flags may be used internally.
 func CheckKotlincFlags(ctx android.ModuleContext, flags []string) {
@@ -1720,7 +1821,9 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.disableTurbine = deps.disableTurbine || dep.ExportedPluginDisableTurbine
 			case pluginTag:
 				if plugin, ok := module.(*Plugin); ok {
-					if plugin.pluginProperties.Processor_class != nil {
+					if Bool(plugin.pluginProperties.Ksp) {
+						deps.kspProcessorPath = append(deps.kspProcessorPath, dep.ImplementationAndResourcesJars...)
+					} else if plugin.pluginProperties.Processor_class != nil {
 						addPlugins(&deps, dep.ImplementationAndResourcesJars, *plugin.pluginProperties.Processor_class)
 					} else {
 						addPlugins(&deps, dep.ImplementationAndResourcesJars)
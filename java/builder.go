@@ -49,7 +49,7 @@ var (
 				`${config.JavacHeapFlags} ${config.JavacVmFlags} ${config.CommonJdkFlags} ` +
 				`$processorpath $processor $javacFlags $bootClasspath $classpath ` +
 				`-source $javaVersion -target $javaVersion ` +
-				`-d $outDir -s $annoDir @$out.rsp @$srcJarDir/list ; fi ) && ` +
+				`-d $outDir -s $annoDir @$out.rsp @$srcJarDir/list $javacLogOnError ; fi ) && ` +
 				`$zipTemplate${config.SoongZipCmd} -jar -o $out -C $outDir -D $outDir && ` +
 				`rm -rf "$srcJarDir"`,
 			CommandDeps: []string{
@@ -74,7 +74,7 @@ var (
 				Platform:     map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
 			},
 		}, []string{"javacFlags", "bootClasspath", "classpath", "processorpath", "processor", "srcJars", "srcJarDir",
-			"outDir", "annoDir", "javaVersion"}, nil)
+			"outDir", "annoDir", "javaVersion", "javacLogOnError"}, nil)
 
 	_ = pctx.VariableFunc("kytheCorpus",
 		func(ctx android.PackageVarContext) string { return ctx.Config().XrefCorpusName() })
@@ -137,11 +137,17 @@ var (
 				`--javacopts ${config.CommonJdkFlags} ` +
 				`$javacFlags -source $javaVersion -target $javaVersion -- $bootClasspath $classpath && ` +
 				`${config.Ziptime} $out.tmp && ` +
-				`(if cmp -s $out.tmp $out ; then rm $out.tmp ; else mv $out.tmp $out ; fi )`,
+				// Only update the header jar when its ABI changes, so that changes to method
+				// bodies or private members don't cause the modules compiled against it to be
+				// rebuilt.
+				`${config.HeaderJarAbiCmd} -o $abi.tmp $out.tmp && ` +
+				`(if [ -f $out ] && cmp -s $abi.tmp $abi ; then rm $out.tmp $abi.tmp ; ` +
+				`else mv $out.tmp $out && mv $abi.tmp $abi ; fi )`,
 			CommandDeps: []string{
 				"${config.TurbineJar}",
 				"${config.JavaCmd}",
 				"${config.Ziptime}",
+				"${config.HeaderJarAbiCmd}",
 			},
 			Rspfile:        "$out.rsp",
 			RspfileContent: "$in",
@@ -155,7 +161,7 @@ var (
 			OutputDirectories: []string{"$outDir"},
 			ToolchainInputs:   []string{"${config.JavaCmd}"},
 			Platform:          map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
-		}, []string{"javacFlags", "bootClasspath", "classpath", "srcJars", "outDir", "javaVersion"}, []string{"implicits"})
+		}, []string{"javacFlags", "bootClasspath", "classpath", "srcJars", "outDir", "javaVersion", "abi"}, []string{"implicits"})
 
 	jar, jarRE = pctx.RemoteStaticRules("jar",
 		blueprint.RuleParams{
@@ -261,8 +267,14 @@ type javaBuilderFlags struct {
 	errorProneExtraJavacFlags string
 	errorProneProcessorPath   classpath
 
+	// If set, javac writes its diagnostics to this file instead of stderr.
+	javacLog android.WritablePath
+
 	kotlincFlags     string
 	kotlincClasspath classpath
+	kspProcessorPath classpath
+	// If true, kotlinc also compiles the .kt files of the srcjars, which are generated by KSP.
+	kotlincSrcJarsHaveKotlin bool
 
 	proto android.ProtoFlags
 }
@@ -368,8 +380,12 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 	deps = append(deps, classpath...)
 	deps = append(deps, flags.processorPath...)
 
+	// The ABI of the header jar, used to decide whether the header jar needs to be updated.
+	abiFile := outputFile.ReplaceExtension(ctx, "abi")
+
 	rule := turbine
 	args := map[string]string{
+		"abi":           abiFile.String(),
 		"javacFlags":    flags.javacFlags,
 		"bootClasspath": bootClasspath,
 		"srcJars":       strings.Join(srcJars.Strings(), " "),
@@ -382,12 +398,13 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 		args["implicits"] = strings.Join(deps.Strings(), ",")
 	}
 	ctx.Build(pctx, android.BuildParams{
-		Rule:        rule,
-		Description: "turbine",
-		Output:      outputFile,
-		Inputs:      srcFiles,
-		Implicits:   deps,
-		Args:        args,
+		Rule:           rule,
+		Description:    "turbine",
+		Output:         outputFile,
+		ImplicitOutput: abiFile,
+		Inputs:         srcFiles,
+		Implicits:      deps,
+		Args:           args,
 	})
 }
 
@@ -443,27 +460,40 @@ func transformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 		outDir = filepath.Join(shardDir, outDir)
 		annoDir = filepath.Join(shardDir, annoDir)
 	}
+	javacFlags := flags.javacFlags
+	javacLogOnError := ""
+	var implicitOutputs android.WritablePaths
+	if flags.javacLog != nil {
+		// Don't limit the number of warnings so that the log contains all of them.
+		javacFlags += " -Xstdout " + flags.javacLog.String() + " -Xmaxwarns 1000000"
+		// The errors are in the log too, print it when javac fails.
+		javacLogOnError = "|| (cat " + flags.javacLog.String() + "; exit 1)"
+		implicitOutputs = append(implicitOutputs, flags.javacLog)
+	}
+
 	rule := javac
 	if ctx.Config().UseRBE() && ctx.Config().IsEnvTrue("RBE_JAVAC") {
 		rule = javacRE
 	}
 	ctx.Build(pctx, android.BuildParams{
-		Rule:        rule,
-		Description: desc,
-		Output:      outputFile,
-		Inputs:      srcFiles,
-		Implicits:   deps,
+		Rule:            rule,
+		Description:     desc,
+		Output:          outputFile,
+		ImplicitOutputs: implicitOutputs,
+		Inputs:          srcFiles,
+		Implicits:       deps,
 		Args: map[string]string{
-			"javacFlags":    flags.javacFlags,
-			"bootClasspath": bootClasspath,
-			"classpath":     classpath.FormJavaClassPath("-classpath"),
-			"processorpath": flags.processorPath.FormJavaClassPath("-processorpath"),
-			"processor":     processor,
-			"srcJars":       strings.Join(srcJars.Strings(), " "),
-			"srcJarDir":     android.PathForModuleOut(ctx, intermediatesDir, srcJarDir).String(),
-			"outDir":        android.PathForModuleOut(ctx, intermediatesDir, outDir).String(),
-			"annoDir":       android.PathForModuleOut(ctx, intermediatesDir, annoDir).String(),
-			"javaVersion":   flags.javaVersion.String(),
+			"javacFlags":      javacFlags,
+			"bootClasspath":   bootClasspath,
+			"classpath":       classpath.FormJavaClassPath("-classpath"),
+			"processorpath":   flags.processorPath.FormJavaClassPath("-processorpath"),
+			"processor":       processor,
+			"srcJars":         strings.Join(srcJars.Strings(), " "),
+			"srcJarDir":       android.PathForModuleOut(ctx, intermediatesDir, srcJarDir).String(),
+			"outDir":          android.PathForModuleOut(ctx, intermediatesDir, outDir).String(),
+			"annoDir":         android.PathForModuleOut(ctx, intermediatesDir, annoDir).String(),
+			"javaVersion":     flags.javaVersion.String(),
+			"javacLogOnError": javacLogOnError,
 		},
 	})
 }
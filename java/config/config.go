@@ -119,6 +119,9 @@ func init() {
 	pctx.SourcePathVariable("JarArgsCmd", "build/soong/scripts/jar-args.sh")
 	pctx.SourcePathVariable("PackageCheckCmd", "build/soong/scripts/package-check.sh")
 	pctx.HostBinToolVariable("ExtractJarPackagesCmd", "extract_jar_packages")
+	pctx.HostBinToolVariable("HeaderJarAbiCmd", "header_jar_abi")
+	pctx.HostBinToolVariable("ErrorProneReportCmd", "errorprone_report")
+	pctx.HostBinToolVariable("ApkSizeReportCmd", "apk_size_report")
 	pctx.HostBinToolVariable("SoongZipCmd", "soong_zip")
 	pctx.HostBinToolVariable("MergeZipsCmd", "merge_zips")
 	pctx.HostBinToolVariable("Zip2ZipCmd", "zip2zip")
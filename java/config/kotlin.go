@@ -14,7 +14,11 @@
 
 package config
 
-import "strings"
+import (
+	"strings"
+
+	"android/soong/android"
+)
 
 var (
 	KotlinStdlibJar     = "external/kotlinc/lib/kotlin-stdlib.jar"
@@ -22,6 +26,17 @@ var (
 		"-no-jdk",
 		"-no-stdlib",
 	}
+
+	// The jars of KSP and of the Kotlin build tools API are not in every checkout of
+	// external/kotlinc, so the modules that need them check that they exist.
+	KotlinKspJars = []string{
+		"external/kotlinc/lib/symbol-processing-cmdline.jar",
+		"external/kotlinc/lib/symbol-processing-api.jar",
+	}
+	KotlinBuildToolsJars = []string{
+		"external/kotlinc/lib/kotlin-build-tools-api.jar",
+		"external/kotlinc/lib/kotlin-build-tools-impl.jar",
+	}
 )
 
 func init() {
@@ -34,6 +49,18 @@ func init() {
 	pctx.SourcePathVariable("KotlinKaptJar", "external/kotlinc/lib/kotlin-annotation-processing.jar")
 	pctx.SourcePathVariable("KotlinAnnotationJar", "external/kotlinc/lib/annotations-13.0.jar")
 	pctx.SourcePathVariable("KotlinStdlibJar", KotlinStdlibJar)
+	pctx.SourcePathVariable("KotlinKspJar", KotlinKspJars[0])
+	pctx.SourcePathVariable("KotlinKspApiJar", KotlinKspJars[1])
+	pctx.SourcePathVariable("KotlinBuildToolsApiJar", KotlinBuildToolsJars[0])
+	pctx.SourcePathVariable("KotlinBuildToolsImplJar", KotlinBuildToolsJars[1])
+
+	// Driver for kotlinc's incremental compilation, used when KOTLIN_INCREMENTAL=true.  It takes
+	// the directory of the incremental caches with --caches_dir, followed by -- and the kotlinc
+	// arguments.  It is built from build/soong/cmd/kotlin_incremental_compiler by the
+	// kotlin_incremental_compiler singleton, as it needs the Kotlin build tools API jars.
+	pctx.VariableFunc("KotlinIncrementalCompilerJar", func(ctx android.PackageVarContext) string {
+		return KotlinIncrementalCompilerJar(ctx).String()
+	})
 
 	// These flags silence "Illegal reflective access" warnings when running kapt in OpenJDK9+
 	pctx.StaticVariable("KaptSuppressJDK9Warnings", strings.Join([]string{
@@ -48,3 +75,8 @@ func init() {
 		"-J--add-opens=java.base/java.util=ALL-UNNAMED", // https://youtrack.jetbrains.com/issue/KT-43704
 	}, " "))
 }
+
+// KotlinIncrementalCompilerJar returns the path of the driver of kotlinc's incremental compilation.
+func KotlinIncrementalCompilerJar(ctx android.PathContext) android.OutputPath {
+	return android.PathForOutput(ctx, "kotlin-incremental-compiler", "kotlin-incremental-compiler.jar")
+}
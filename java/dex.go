@@ -15,6 +15,7 @@
 package java
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -76,8 +77,14 @@ type dexer struct {
 
 	// list of extra proguard flag files
 	extraProguardFlagFiles android.Paths
-	proguardDictionary     android.OptionalPath
-	proguardUsageZip       android.OptionalPath
+	// names of the modules that contributed extra proguard flag files, indexed by the path of
+	// the flag file.  Flag files without an entry are attributed to the module itself.
+	proguardFlagFileOrigins map[string]string
+
+	proguardDictionary   android.OptionalPath
+	proguardUsageZip     android.OptionalPath
+	proguardSeeds        android.OptionalPath
+	proguardMergedConfig android.OptionalPath
 }
 
 func (d *dexer) effectiveOptimizeEnabled() bool {
@@ -118,7 +125,7 @@ var d8, d8RE = pctx.MultiCommandRemoteStaticRules("d8",
 var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 	blueprint.RuleParams{
 		Command: `rm -rf "$outDir" && mkdir -p "$outDir" && ` +
-			`rm -f "$outDict" && rm -rf "${outUsageDir}" && ` +
+			`rm -f "$outDict" "$outSeeds" && rm -rf "${outUsageDir}" && ` +
 			`mkdir -p $$(dirname ${outUsage}) && ` +
 			`mkdir -p $$(dirname $tmpJar) && ` +
 			`${config.Zip2ZipCmd} -i $in -o $tmpJar -x '**/*.dex' && ` +
@@ -126,8 +133,9 @@ var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 			`--no-data-resources ` +
 			`-printmapping ${outDict} ` +
 			`-printusage ${outUsage} ` +
+			`-printseeds ${outSeeds} ` +
 			`$r8Flags && ` +
-			`touch "${outDict}" "${outUsage}" && ` +
+			`touch "${outDict}" "${outUsage}" "${outSeeds}" && ` +
 			`${config.SoongZipCmd} -o ${outUsageZip} -C ${outUsageDir} -f ${outUsage} && ` +
 			`rm -rf ${outUsageDir} && ` +
 			`$zipTemplate${config.SoongZipCmd} $zipFlags -o $outDir/classes.dex.jar -C $outDir -f "$outDir/classes*.dex" && ` +
@@ -142,7 +150,7 @@ var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 		"$r8Template": &remoteexec.REParams{
 			Labels:          map[string]string{"type": "compile", "compiler": "r8"},
 			Inputs:          []string{"$implicits", "${config.R8Jar}"},
-			OutputFiles:     []string{"${outUsage}"},
+			OutputFiles:     []string{"${outUsage}", "${outSeeds}"},
 			ExecStrategy:    "${config.RER8ExecStrategy}",
 			ToolchainInputs: []string{"${config.JavaCmd}"},
 			Platform:        map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
@@ -161,7 +169,7 @@ var r8, r8RE = pctx.MultiCommandRemoteStaticRules("r8",
 			ExecStrategy: "${config.RER8ExecStrategy}",
 			Platform:     map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
 		},
-	}, []string{"outDir", "outDict", "outUsage", "outUsageZip", "outUsageDir",
+	}, []string{"outDir", "outDict", "outUsage", "outUsageZip", "outUsageDir", "outSeeds",
 		"r8Flags", "zipFlags", "tmpJar"}, []string{"implicits"})
 
 func (d *dexer) dexCommonFlags(ctx android.ModuleContext, minSdkVersion android.SdkSpec) []string {
@@ -200,6 +208,77 @@ func d8Flags(flags javaBuilderFlags) (d8Flags []string, d8Deps android.Paths) {
 	return d8Flags, d8Deps
 }
 
+// proguardFlagFiles returns the proguard flag files of the module in the order they are passed to R8.
+func (d *dexer) proguardFlagFiles(ctx android.ModuleContext) android.Paths {
+	flagFiles := android.Paths{
+		android.PathForSource(ctx, "build/make/core/proguard.flags"),
+	}
+
+	flagFiles = append(flagFiles, d.extraProguardFlagFiles...)
+
+	flagFiles = append(flagFiles, android.PathsForModuleSrc(ctx, d.dexProperties.Optimize.Proguard_flags_files)...)
+
+	return flagFiles
+}
+
+// optimizeFlags returns the R8 flags that implement the shrink, optimize and obfuscate properties.
+func (d *dexer) optimizeFlags() []string {
+	opt := d.dexProperties.Optimize
+	var flags []string
+
+	// TODO(ccross): Don't shrink app instrumentation tests by default.
+	if !Bool(opt.Shrink) {
+		flags = append(flags, "-dontshrink")
+	}
+
+	if !Bool(opt.Optimize) {
+		flags = append(flags, "-dontoptimize")
+	}
+
+	// TODO(ccross): error if obufscation + app instrumentation test.
+	if !Bool(opt.Obfuscate) {
+		flags = append(flags, "-dontobfuscate")
+	}
+
+	return flags
+}
+
+// proguardMergedConfigRule builds a rule that merges the R8 configuration of the module into a
+// single file, with each rule annotated by the module and the flag file it comes from.  The files
+// included by the flag files are listed in the depfile of the rule.
+func (d *dexer) proguardMergedConfigRule(ctx android.ModuleContext, mergedConfig android.WritablePath) {
+	var sources strings.Builder
+	flagFiles := d.proguardFlagFiles(ctx)
+	for _, flagFile := range flagFiles {
+		origin := ctx.ModuleName()
+		if o, ok := d.proguardFlagFileOrigins[flagFile.String()]; ok {
+			origin = o
+		} else if strings.HasPrefix(flagFile.String(), "build/make/core/") {
+			origin = "build/make/core"
+		}
+		fmt.Fprintf(&sources, "file\t%s\t%s\n", origin, flagFile)
+	}
+	for _, flag := range d.dexProperties.Optimize.Proguard_flags {
+		fmt.Fprintf(&sources, "flag\t%s\t%s\n", ctx.ModuleName(), flag)
+	}
+	for _, flag := range d.optimizeFlags() {
+		fmt.Fprintf(&sources, "flag\t%s (optimize properties)\t%s\n", ctx.ModuleName(), flag)
+	}
+
+	sourcesFile := android.PathForModuleOut(ctx, "proguard_merged_config.sources")
+	android.WriteFileRule(ctx, sourcesFile, sources.String())
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("proguard_config_origins").
+		FlagWithArg("--name ", ctx.ModuleName()).
+		FlagWithInput("--sources ", sourcesFile).
+		FlagWithOutput("--output ", mergedConfig).
+		FlagWithDepFile("--depfile ", android.PathForModuleOut(ctx, "proguard_merged_config.d")).
+		Implicits(flagFiles).
+		Implicit(android.PathForSource(ctx, "build/make/core/proguard_basic_keeps.flags"))
+	rule.Build("proguardMergedConfig", "merge proguard flags")
+}
+
 func (d *dexer) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8Flags []string, r8Deps android.Paths) {
 	opt := d.dexProperties.Optimize
 
@@ -224,15 +303,7 @@ func (d *dexer) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8Fl
 	r8Deps = append(r8Deps, flags.bootClasspath...)
 	r8Deps = append(r8Deps, flags.classpath...)
 
-	flagFiles := android.Paths{
-		android.PathForSource(ctx, "build/make/core/proguard.flags"),
-	}
-
-	flagFiles = append(flagFiles, d.extraProguardFlagFiles...)
-	// TODO(ccross): static android library proguard files
-
-	flagFiles = append(flagFiles, android.PathsForModuleSrc(ctx, opt.Proguard_flags_files)...)
-
+	flagFiles := d.proguardFlagFiles(ctx)
 	r8Flags = append(r8Flags, android.JoinWithPrefix(flagFiles.Strings(), "-include "))
 	r8Deps = append(r8Deps, flagFiles...)
 
@@ -246,19 +317,7 @@ func (d *dexer) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8Fl
 		r8Flags = append(r8Flags, "--force-proguard-compatibility")
 	}
 
-	// TODO(ccross): Don't shrink app instrumentation tests by default.
-	if !Bool(opt.Shrink) {
-		r8Flags = append(r8Flags, "-dontshrink")
-	}
-
-	if !Bool(opt.Optimize) {
-		r8Flags = append(r8Flags, "-dontoptimize")
-	}
-
-	// TODO(ccross): error if obufscation + app instrumentation test.
-	if !Bool(opt.Obfuscate) {
-		r8Flags = append(r8Flags, "-dontobfuscate")
-	}
+	r8Flags = append(r8Flags, d.optimizeFlags()...)
 	// TODO(ccross): if this is an instrumentation test of an obfuscated app, use the
 	// dictionary of the app and move the app from libraryjars to injars.
 
@@ -297,6 +356,11 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 			android.ModuleNameWithPossibleOverride(ctx), "unused.txt")
 		proguardUsageZip := android.PathForModuleOut(ctx, "proguard_usage.zip")
 		d.proguardUsageZip = android.OptionalPathForPath(proguardUsageZip)
+		proguardSeeds := android.PathForModuleOut(ctx, "proguard_seeds.txt")
+		d.proguardSeeds = android.OptionalPathForPath(proguardSeeds)
+		proguardMergedConfig := android.PathForModuleOut(ctx, "proguard_merged_config.txt")
+		d.proguardMergedConfig = android.OptionalPathForPath(proguardMergedConfig)
+		d.proguardMergedConfigRule(ctx, proguardMergedConfig)
 		r8Flags, r8Deps := d.r8Flags(ctx, flags)
 		rule := r8
 		args := map[string]string{
@@ -306,6 +370,7 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 			"outUsageDir": proguardUsageDir.String(),
 			"outUsage":    proguardUsage.String(),
 			"outUsageZip": proguardUsageZip.String(),
+			"outSeeds":    proguardSeeds.String(),
 			"outDir":      outDir.String(),
 			"tmpJar":      tmpJar.String(),
 		}
@@ -317,7 +382,7 @@ func (d *dexer) compileDex(ctx android.ModuleContext, flags javaBuilderFlags, mi
 			Rule:            rule,
 			Description:     "r8",
 			Output:          javalibJar,
-			ImplicitOutputs: android.WritablePaths{proguardDictionary, proguardUsageZip},
+			ImplicitOutputs: android.WritablePaths{proguardDictionary, proguardUsageZip, proguardSeeds},
 			Input:           classesJar,
 			Implicits:       r8Deps,
 			Args:            args,
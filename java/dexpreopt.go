@@ -35,6 +35,7 @@ type dexpreopter struct {
 	isPresignedPrebuilt bool
 
 	manifestFile        android.Path
+	defaultProfile      string
 	statusFile          android.WritablePath
 	enforceUsesLibs     bool
 	classLoaderContexts dexpreopt.ClassLoaderContextMap
@@ -189,13 +190,18 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Wr
 	var profileBootListing android.OptionalPath
 	profileIsTextListing := false
 	if BoolDefault(d.dexpreoptProperties.Dex_preopt.Profile_guided, true) {
+		// The module can provide a profile to use when dex_preopt.profile is not set, like the
+		// baseline profile of an app.
+		profile := String(d.dexpreoptProperties.Dex_preopt.Profile)
+		if profile == "" {
+			profile = d.defaultProfile
+		}
+
 		// If dex_preopt.profile_guided is not set, default it based on the existence of the
 		// dexprepot.profile option or the profile class listing.
-		if String(d.dexpreoptProperties.Dex_preopt.Profile) != "" {
-			profileClassListing = android.OptionalPathForPath(
-				android.PathForModuleSrc(ctx, String(d.dexpreoptProperties.Dex_preopt.Profile)))
-			profileBootListing = android.ExistentPathForSource(ctx,
-				ctx.ModuleDir(), String(d.dexpreoptProperties.Dex_preopt.Profile)+"-boot")
+		if profile != "" {
+			profileClassListing = android.OptionalPathForPath(android.PathForModuleSrc(ctx, profile))
+			profileBootListing = android.ExistentPathForSource(ctx, ctx.ModuleDir(), profile+"-boot")
 			profileIsTextListing = true
 		} else if global.ProfileDir != "" {
 			profileClassListing = android.ExistentPathForSource(ctx,
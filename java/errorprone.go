@@ -0,0 +1,120 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+// This file reports the Error Prone findings of modules as SARIF.  When ERROR_PRONE_SARIF=true
+// is set along with RUN_ERROR_PRONE=true, the separate errorprone compilation of each module
+// writes its diagnostics to a log, which is printed if the compilation fails.  The log is converted
+// to SARIF by build/soong/scripts/errorprone_report.py, which fails the build if a check has more
+// findings than errorprone.allowed_warnings allows.  The SARIF files of all modules are collected
+// in errorprone-sarif.zip by m errorprone-sarif.
+
+var errorProneReport = pctx.AndroidStaticRule("errorProneReport",
+	blueprint.RuleParams{
+		Command: `rm -f $out && ${config.ErrorProneReportCmd} --name $name --log $in --output $out ` +
+			`$allowedWarnings`,
+		CommandDeps: []string{"${config.ErrorProneReportCmd}"},
+	},
+	"name", "allowedWarnings")
+
+func errorProneSarifEnabled(config android.Config) bool {
+	return config.IsEnvTrue("ERROR_PRONE_SARIF")
+}
+
+// errorProneReport builds a rule that converts the javac log of the errorprone compilation of the
+// module to SARIF and checks the number of findings of each check, and returns the path to the
+// SARIF file.
+func (j *Module) errorProneReport(ctx android.ModuleContext, log android.Path) android.Path {
+	var allowedWarnings []string
+	for _, allowed := range j.properties.Errorprone.Allowed_warnings {
+		i := strings.LastIndex(allowed, ":")
+		if count, err := strconv.Atoi(allowed[i+1:]); i <= 0 || err != nil || count < 0 {
+			ctx.PropertyErrorf("errorprone.allowed_warnings",
+				"invalid value %q, expected \"<check>:<count>\"", allowed)
+			continue
+		}
+		allowedWarnings = append(allowedWarnings, "--allowed_warnings "+proptools.ShellEscape(allowed))
+	}
+
+	sarif := android.PathForModuleOut(ctx, "errorprone", "errorprone.sarif")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        errorProneReport,
+		Description: "errorprone report",
+		Input:       log,
+		Output:      sarif,
+		Args: map[string]string{
+			"name":            ctx.ModuleName(),
+			"allowedWarnings": strings.Join(allowedWarnings, " "),
+		},
+	})
+	return sarif
+}
+
+type errorProneSarifProvider interface {
+	errorProneSarifReport() android.Path
+}
+
+func (j *Module) errorProneSarifReport() android.Path {
+	return j.errorProneSarif
+}
+
+var _ errorProneSarifProvider = (*Module)(nil)
+
+func errorProneSarifSingletonFactory() android.Singleton {
+	return &errorProneSarifSingleton{}
+}
+
+type errorProneSarifSingleton struct {
+	sarifZip android.WritablePath
+}
+
+func (s *errorProneSarifSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !errorProneSarifEnabled(ctx.Config()) {
+		return
+	}
+
+	var reports android.Paths
+	ctx.VisitAllModules(func(m android.Module) {
+		if ctx.Config().KatiEnabled() && !m.ExportedToMake() {
+			return
+		}
+		if p, ok := m.(errorProneSarifProvider); ok && p.errorProneSarifReport() != nil {
+			reports = append(reports, p.errorProneSarifReport())
+		}
+	})
+
+	s.sarifZip = android.PathForOutput(ctx, "errorprone-sarif.zip")
+	lintZip(ctx, reports, s.sarifZip)
+
+	ctx.Phony("errorprone-sarif", s.sarifZip)
+}
+
+func (s *errorProneSarifSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.sarifZip != nil {
+		ctx.DistForGoal("errorprone-sarif", s.sarifZip)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*errorProneSarifSingleton)(nil)
@@ -15,6 +15,7 @@
 package java
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -1313,3 +1314,92 @@ func extractEncodedDexJarsFromModules(ctx android.ModuleContext, contents []andr
 	}
 	return encodedDexJarsByModuleName
 }
+
+// hiddenAPIExplainManifest describes the intermediate files of the monolithic hidden API processing
+// to the explain_hiddenapi_flags tool, which uses them to explain why a member signature ended up
+// with its flags.
+type hiddenAPIExplainManifest struct {
+	// The path to the monolithic stub flags file, which records the API scopes exposing each member.
+	StubFlags string `json:"stub_flags"`
+
+	// The path to the monolithic flags file, which contains the final flags of each member.
+	Flags string `json:"flags"`
+
+	// The paths to the annotation flags files.
+	AnnotationFlags []string `json:"annotation_flags"`
+
+	// The flag files, in the order they are passed to generate_hiddenapi_lists.
+	FlagFiles []hiddenAPIExplainFlagFile `json:"flag_files"`
+
+	// The modules on the bootclasspath.
+	Modules []hiddenAPIExplainModule `json:"modules"`
+}
+
+type hiddenAPIExplainFlagFile struct {
+	// The name of the property in HiddenAPIFlagFileProperties the file was listed in.
+	Category string `json:"category"`
+	Path     string `json:"path"`
+}
+
+type hiddenAPIExplainModule struct {
+	Name string `json:"name"`
+
+	// The name of the bootclasspath_fragment that contains the module, or empty if the module is
+	// not part of a fragment.
+	Fragment string `json:"fragment,omitempty"`
+
+	ClassesJars []string `json:"classes_jars"`
+}
+
+// buildRuleToGenerateHiddenAPIExplainManifest creates a rule to write the manifest used by the
+// explain_hiddenapi_flags tool, and a hiddenapi-explain phony target that builds it along with all
+// the files it references.
+func buildRuleToGenerateHiddenAPIExplainManifest(ctx android.ModuleContext, manifestPath android.WritablePath,
+	stubFlags, flags android.Path, annotationFlags android.Paths, flagFilesByCategory FlagFilesByCategory,
+	classpathElements ClasspathElements) {
+
+	manifest := hiddenAPIExplainManifest{
+		StubFlags:       stubFlags.String(),
+		Flags:           flags.String(),
+		AnnotationFlags: annotationFlags.Strings(),
+	}
+	deps := android.Paths{stubFlags, flags}
+	deps = append(deps, annotationFlags...)
+
+	for _, category := range HiddenAPIFlagFileCategories {
+		for _, path := range flagFilesByCategory[category] {
+			manifest.FlagFiles = append(manifest.FlagFiles, hiddenAPIExplainFlagFile{category.PropertyName, path.String()})
+			deps = append(deps, path)
+		}
+	}
+
+	addModule := func(module android.Module, fragment string) {
+		classesJars := retrieveClassesJarsFromModule(module)
+		manifest.Modules = append(manifest.Modules, hiddenAPIExplainModule{
+			Name:        android.RemoveOptionalPrebuiltPrefix(module.Name()),
+			Fragment:    fragment,
+			ClassesJars: classesJars.Strings(),
+		})
+		deps = append(deps, classesJars...)
+	}
+	for _, element := range classpathElements {
+		switch e := element.(type) {
+		case *ClasspathLibraryElement:
+			addModule(e.Module(), "")
+		case *ClasspathFragmentElement:
+			fragment := android.RemoveOptionalPrebuiltPrefix(e.Module().Name())
+			for _, module := range e.Contents {
+				addModule(module, fragment)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		ctx.ModuleErrorf("failed to marshal hidden API explain manifest: %s", err)
+		return
+	}
+	android.WriteFileRule(ctx, manifestPath, string(data))
+
+	ctx.Phony("hiddenapi-explain", append(android.Paths{manifestPath}, deps...)...)
+}
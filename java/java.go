@@ -66,6 +66,8 @@ func registerJavaBuildComponents(ctx android.RegistrationContext) {
 
 	ctx.RegisterSingletonType("logtags", LogtagsSingleton)
 	ctx.RegisterSingletonType("kythe_java_extract", kytheExtractJavaFactory)
+	ctx.RegisterSingletonType("errorprone_sarif", errorProneSarifSingletonFactory)
+	ctx.RegisterSingletonType("kotlin_incremental_compiler", kotlinIncrementalCompilerSingletonFactory)
 }
 
 func RegisterJavaSdkMemberTypes() {
@@ -369,6 +371,7 @@ type deps struct {
 	bootClasspath           classpath
 	processorPath           classpath
 	errorProneProcessorPath classpath
+	kspProcessorPath        classpath
 	processorClasses        []string
 	staticJars              android.Paths
 	staticHeaderJars        android.Paths
@@ -459,6 +462,8 @@ func normalizeJavaVersion(ctx android.BaseModuleContext, javaVersion string) jav
 type Library struct {
 	Module
 
+	apiCheckProperties apiCheckProperties
+
 	InstallMixin func(ctx android.ModuleContext, installPath android.Path) (extraInstallDeps android.Paths)
 }
 
@@ -517,6 +522,7 @@ func (j *Library) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	j.dexpreopter.uncompressedDex = *j.dexProperties.Uncompress_dex
 	j.classLoaderContexts = j.usesLibrary.classLoaderContextForUsesLibDeps(ctx)
 	j.compile(ctx, nil)
+	j.apiCheck(ctx)
 
 	// Collect the module directory for IDE info in java/jdeps.go.
 	j.modulePaths = append(j.modulePaths, ctx.ModuleDir())
@@ -667,6 +673,7 @@ func LibraryFactory() android.Module {
 	module := &Library{}
 
 	module.addHostAndDeviceProperties()
+	module.AddProperties(&module.apiCheckProperties)
 
 	module.initModuleAndImport(module)
 
@@ -689,6 +696,7 @@ func LibraryHostFactory() android.Module {
 	module := &Library{}
 
 	module.addHostProperties()
+	module.AddProperties(&module.apiCheckProperties)
 
 	module.Module.properties.Installable = proptools.BoolPtr(true)
 
@@ -1762,6 +1770,7 @@ func DefaultsFactory() android.Module {
 		&RuntimeResourceOverlayProperties{},
 		&LintProperties{},
 		&appTestHelperAppProperties{},
+		&apiCheckProperties{},
 	)
 
 	android.InitDefaultsModule(module)
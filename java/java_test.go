@@ -16,6 +16,7 @@ package java
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -977,6 +978,93 @@ func TestTurbine(t *testing.T) {
 	android.AssertStringDoesContain(t, "bar javac classpath", barJavac.Args["classpath"], fooHeaderJar)
 	android.AssertPathsRelativeToTopEquals(t, "bar turbine combineJar", []string{barTurbineJar, fooHeaderJar}, barTurbineCombined.Inputs)
 	android.AssertStringDoesContain(t, "baz javac classpath", bazJavac.Args["classpath"], "prebuilts/sdk/14/public/android.jar")
+
+	barTurbineAbi := "out/soong/.intermediates/bar/android_common/turbine/bar.abi"
+	android.AssertPathRelativeToTopEquals(t, "bar turbine abi", barTurbineAbi, barTurbine.ImplicitOutput)
+	android.AssertStringEquals(t, "bar turbine abi arg", barTurbineAbi, barTurbine.Args["abi"])
+}
+
+func TestApiCheck(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureAddTextFile("api/current.txt", ""),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			static_libs: ["baz"],
+			api_check: {
+				current: "api/current.txt",
+			},
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+		`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	extract := foo.Output("api_check/current.txt")
+	// The API of the static_libs is not part of the API of foo.
+	android.AssertPathsRelativeToTopEquals(t, "extract API inputs",
+		[]string{"out/soong/.intermediates/foo/android_common/turbine/foo.jar"}, extract.Inputs)
+	android.AssertStringDoesContain(t, "extract API command", extract.RuleParams.Command, "header_jar_abi -api")
+
+	check := foo.Output("api_check/check_current_api.timestamp")
+	android.AssertPathsRelativeToTopEquals(t, "check API inputs",
+		[]string{"api/current.txt", "out/soong/.intermediates/foo/android_common/api_check/current.txt"}, check.Inputs)
+	android.AssertStringDoesContain(t, "check API command", check.RuleParams.Command, "m foo-update-current-api")
+
+	update := foo.Output("api_check/update_current_api.timestamp")
+	android.AssertStringDoesContain(t, "update API command", update.RuleParams.Command,
+		"cp -f out/soong/.intermediates/foo/android_common/api_check/current.txt api/current.txt")
+
+	bar := result.ModuleForTests("bar", "android_common")
+	if rule := bar.MaybeOutput("api_check/current.txt"); rule.Rule != nil {
+		t.Errorf("expected no API check for bar, got %q", rule.RuleParams.Command)
+	}
+}
+
+func TestApiCheckKotlin(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureAddTextFile("api/current.txt", ""),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			static_libs: ["baz"],
+			api_check: {
+				current: "api/current.txt",
+			},
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+		}
+		`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	// The classes compiled by kotlinc and turbine are combined, without the kotlin stdlib and the
+	// static_libs.
+	combined := foo.Output("api_check/classes.jar")
+	android.AssertPathsRelativeToTopEquals(t, "API classes", []string{
+		"out/soong/.intermediates/foo/android_common/kotlin/foo.jar",
+		"out/soong/.intermediates/foo/android_common/turbine/foo.jar",
+	}, combined.Inputs)
+
+	extract := foo.Output("api_check/current.txt")
+	android.AssertPathsRelativeToTopEquals(t, "extract API inputs",
+		[]string{"out/soong/.intermediates/foo/android_common/api_check/classes.jar"}, extract.Inputs)
 }
 
 func TestSharding(t *testing.T) {
@@ -997,6 +1085,80 @@ func TestSharding(t *testing.T) {
 	}
 }
 
+func TestAutomaticSharding(t *testing.T) {
+	compileTimes := filepath.Join(t.TempDir(), "javac_compile_times.txt")
+	if err := ioutil.WriteFile(compileTimes, []byte("# module seconds\nbig 95\nother 1000\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	srcs := android.FixtureModifyMockFS(func(fs android.MockFS) {
+		for i := 0; i < 1200; i++ {
+			fs[fmt.Sprintf("big/%d.java", i)] = nil
+		}
+	})
+
+	testCases := []struct {
+		name           string
+		env            map[string]string
+		properties     string
+		expectedShards int
+	}{
+		{
+			name:           "source count",
+			expectedShards: 3,
+		},
+		{
+			name:           "compile times",
+			env:            map[string]string{"SOONG_JAVAC_COMPILE_TIMES": compileTimes},
+			expectedShards: 4,
+		},
+		{
+			name:           "disabled by environment",
+			env:            map[string]string{"SOONG_JAVAC_AUTO_SHARD": "false"},
+			expectedShards: 0,
+		},
+		{
+			name:           "disabled by property",
+			properties:     "javac_shard_size: 0,",
+			expectedShards: 0,
+		},
+		{
+			name:           "explicit shard size",
+			env:            map[string]string{"SOONG_JAVAC_COMPILE_TIMES": compileTimes},
+			properties:     "javac_shard_size: 1000,",
+			expectedShards: 2,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			result := android.GroupFixturePreparers(
+				prepareForJavaTest,
+				srcs,
+				android.FixtureMergeEnv(test.env),
+			).RunTestWithBp(t, `
+				java_library {
+					name: "big",
+					srcs: ["big/*.java"],
+					`+test.properties+`
+				}
+			`)
+
+			big := result.ModuleForTests("big", "android_common")
+			shards := 0
+			for _, output := range big.AllOutputs() {
+				if strings.Contains(output, "/javac/big.jar") && !strings.HasSuffix(output, "big.jar") {
+					shards++
+				}
+			}
+			android.AssertIntEquals(t, "number of javac shards", test.expectedShards, shards)
+			if test.expectedShards == 0 {
+				big.Output("javac/big.jar")
+			}
+		})
+	}
+}
+
 func TestJarGenrules(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
@@ -1484,3 +1646,65 @@ func TestErrorproneEnabledOnlyByEnvironmentVariable(t *testing.T) {
 		t.Errorf("expected errorprone to contain %q, got %q", expectedSubstring, javac.Args["javacFlags"])
 	}
 }
+
+func TestErrorproneSarif(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			errorprone: {
+				javacflags: ["-Xep:DeadException:ERROR"],
+				allowed_warnings: ["MissingOverride:3"],
+			},
+		}
+	`
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"RUN_ERROR_PRONE":   "true",
+			"ERROR_PRONE_SARIF": "true",
+		}),
+	).RunTestWithBp(t, bp)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	javac := foo.Description("javac")
+	errorprone := foo.Description("errorprone")
+	report := foo.Rule("errorProneReport")
+
+	errorproneLog := "out/soong/.intermediates/foo/android_common/errorprone/errorprone.log"
+	android.AssertPathsRelativeToTopEquals(t, "errorprone implicit outputs", []string{errorproneLog}, errorprone.ImplicitOutputs)
+	android.AssertStringDoesContain(t, "errorprone javacFlags", errorprone.Args["javacFlags"], "-Xstdout "+errorproneLog)
+	android.AssertStringDoesNotContain(t, "errorprone javacFlags", errorprone.Args["javacFlags"], "-XepAllErrorsAsWarnings")
+	android.AssertStringEquals(t, "errorprone javacLogOnError", "|| (cat "+errorproneLog+"; exit 1)", errorprone.Args["javacLogOnError"])
+
+	android.AssertPathRelativeToTopEquals(t, "report input", errorproneLog, report.Input)
+	android.AssertPathRelativeToTopEquals(t, "report output",
+		"out/soong/.intermediates/foo/android_common/errorprone/errorprone.sarif", report.Output)
+	android.AssertStringEquals(t, "report allowed warnings", "--allowed_warnings MissingOverride:3", report.Args["allowedWarnings"])
+
+	// The report is checked by the regular build.
+	android.AssertStringListContains(t, "javac implicits", javac.Implicits.Strings(), report.Output.String())
+
+	sarifZip := result.SingletonForTests("errorprone_sarif").Output("errorprone-sarif.zip")
+	android.AssertStringDoesContain(t, "sarif zip", sarifZip.RuleParams.Command, "soong_zip")
+}
+
+func TestErrorproneSarifInvalidAllowedWarnings(t *testing.T) {
+	android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"RUN_ERROR_PRONE":   "true",
+			"ERROR_PRONE_SARIF": "true",
+		}),
+	).ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+		`invalid value "MissingOverride", expected "<check>:<count>"`)).
+		RunTestWithBp(t, `
+			java_library {
+				name: "foo",
+				srcs: ["a.java"],
+				errorprone: {
+					allowed_warnings: ["MissingOverride"],
+				},
+			}
+		`)
+}
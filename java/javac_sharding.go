@@ -0,0 +1,135 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"android/soong/android"
+)
+
+// This file chooses how many javac instances are used to compile the sources of a module.  Each
+// shard compiles a subset of the sources against the turbine header jar of the module, so the
+// shards are independent of each other and ninja runs them in parallel.
+//
+// Modules can set the number of sources per shard with javac_shard_size.  Otherwise, modules with
+// many sources are sharded automatically: the number of shards is derived from the javac time of
+// the module in a previous build if SOONG_JAVAC_COMPILE_TIMES points to a file listing them, and
+// from the number of sources otherwise.  The file contains "<module> <seconds>" lines and can be
+// generated from the .ninja_log of a previous build with build/soong/scripts/javac_compile_times.py.
+// Automatic sharding can be disabled by setting SOONG_JAVAC_AUTO_SHARD=false.
+
+const (
+	// Modules with fewer sources are never sharded automatically, the cost of starting more javac
+	// instances would outweigh the gain.
+	javacAutoShardMinSrcs = 1000
+
+	// The number of sources per shard when there is no javac time for the module.
+	javacAutoShardSrcs = 500
+
+	// The javac time in seconds that each shard should take when the javac time of the module is
+	// known.
+	javacAutoShardTargetSeconds = 30
+
+	// The maximum number of shards created automatically.
+	javacAutoShardMaxShards = 16
+)
+
+var javacCompileTimesKey = android.NewOnceKey("javacCompileTimes")
+
+type javacCompileTimesResult struct {
+	times map[string]float64
+	err   error
+}
+
+// readJavacCompileTimes parses a file containing "<module> <seconds>" lines.
+func readJavacCompileTimes(file string) (map[string]float64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	times := make(map[string]float64)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<module> <seconds>\", got %q", file, lineNum, line)
+		}
+		seconds, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid number of seconds %q", file, lineNum, fields[1])
+		}
+		times[fields[0]] = seconds
+	}
+	return times, scanner.Err()
+}
+
+// javacCompileTimes returns the javac time in seconds of the modules listed in the file pointed to
+// by SOONG_JAVAC_COMPILE_TIMES, or nil if it is not set.
+func javacCompileTimes(ctx android.ModuleContext) map[string]float64 {
+	file := ctx.Config().Getenv("SOONG_JAVAC_COMPILE_TIMES")
+	if file == "" {
+		return nil
+	}
+	ctx.AddNinjaFileDeps(file)
+
+	result := ctx.Config().Once(javacCompileTimesKey, func() interface{} {
+		times, err := readJavacCompileTimes(file)
+		return javacCompileTimesResult{times, err}
+	}).(javacCompileTimesResult)
+	if result.err != nil {
+		ctx.ModuleErrorf("failed to read SOONG_JAVAC_COMPILE_TIMES: %s", result.err)
+		return nil
+	}
+	return result.times
+}
+
+// javacShardSize returns the number of sources each javac shard of the module should compile, or 0
+// if the module should not be sharded.
+func (j *Module) javacShardSize(ctx android.ModuleContext, numSrcs int, flags javaBuilderFlags) int {
+	if j.properties.Javac_shard_size != nil {
+		return int(*j.properties.Javac_shard_size)
+	}
+
+	// Some annotation processors do not function correctly in sharded environments, only shard
+	// modules that use them when it is explicitly requested.
+	if numSrcs < javacAutoShardMinSrcs || len(flags.processorPath) > 0 ||
+		ctx.Config().IsEnvFalse("SOONG_JAVAC_AUTO_SHARD") {
+		return 0
+	}
+
+	shards := (numSrcs + javacAutoShardSrcs - 1) / javacAutoShardSrcs
+	if seconds, ok := javacCompileTimes(ctx)[ctx.ModuleName()]; ok {
+		shards = int(math.Ceil(seconds / javacAutoShardTargetSeconds))
+	}
+	if shards > javacAutoShardMaxShards {
+		shards = javacAutoShardMaxShards
+	}
+	if shards <= 1 {
+		return 0
+	}
+	return (numSrcs + shards - 1) / shards
+}
@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	"android/soong/android"
+	"android/soong/java/config"
 
 	"github.com/google/blueprint"
 )
@@ -30,7 +31,7 @@ var kotlinc = pctx.AndroidRemoteStaticRule("kotlinc", android.RemoteRuleSupports
 	blueprint.RuleParams{
 		Command: `rm -rf "$classesDir" "$srcJarDir" "$kotlinBuildFile" "$emptyDir" && ` +
 			`mkdir -p "$classesDir" "$srcJarDir" "$emptyDir" && ` +
-			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
+			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list $srcJarFilters $srcJars && ` +
 			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
 			` --out_dir "$classesDir" --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
 			` $commonSrcFilesArg --out "$kotlinBuildFile" && ` +
@@ -55,8 +56,100 @@ var kotlinc = pctx.AndroidRemoteStaticRule("kotlinc", android.RemoteRuleSupports
 		Rspfile:        "$out.rsp",
 		RspfileContent: `$in`,
 	},
-	"kotlincFlags", "classpath", "srcJars", "commonSrcFilesArg", "srcJarDir", "classesDir",
-	"kotlinJvmTarget", "kotlinBuildFile", "emptyDir", "name")
+	"kotlincFlags", "classpath", "srcJars", "srcJarFilters", "commonSrcFilesArg", "srcJarDir",
+	"classesDir", "kotlinJvmTarget", "kotlinBuildFile", "emptyDir", "name")
+
+// kotlincIncremental is the equivalent of kotlinc that keeps the classes and the incremental caches
+// of kotlinc between builds, so that only the sources affected by a change are recompiled.  The
+// driver finds the added, modified and removed sources itself, and removes the classes of the
+// removed ones.  The caches don't track changes to the classpath or to the compiler, so they are
+// dropped whenever the flags, the compiler or the contents of the classpath change, and when the
+// previous compilation failed, as it may have left them in an inconsistent state.  This rule
+// relies on state left in the intermediates directory, so it always runs locally.
+var kotlincIncremental = pctx.AndroidStaticRule("kotlincIncremental",
+	blueprint.RuleParams{
+		Command: `rm -rf "$srcJarDir" "$kotlinBuildFile" "$emptyDir" && ` +
+			`mkdir -p "$srcJarDir" "$emptyDir" "$incrementalDir" && ` +
+			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list $srcJarFilters $srcJars && ` +
+			`(echo "$kotlincFlags" && md5sum ${config.KotlinCompilerJar} ${config.KotlinIncrementalCompilerJar} ` +
+			`$classpathFiles) > $incrementalDir/inputs.tmp && ` +
+			`(cmp -s $incrementalDir/inputs.tmp $incrementalDir/inputs || rm -rf "$incrementalDir/caches" "$classesDir") && ` +
+			`rm -f $incrementalDir/inputs && mkdir -p "$classesDir" && ` +
+			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
+			` --out_dir "$classesDir" --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
+			` $commonSrcFilesArg --out "$kotlinBuildFile" && ` +
+			`${config.JavaCmd} ${config.JavaVmFlags} -Xmx${config.JavacHeapSize} ` +
+			`--add-opens=java.base/java.util=ALL-UNNAMED ` +
+			`-cp ${config.KotlinIncrementalCompilerJar}:${config.KotlinBuildToolsApiJar}:` +
+			`${config.KotlinBuildToolsImplJar}:${config.KotlinCompilerJar}:${config.KotlinStdlibJar}:` +
+			`${config.KotlinTrove4jJar}:${config.KotlinAnnotationJar} ` +
+			`com.android.soong.kotlin.KotlinIncrementalCompilerKt --caches_dir "$incrementalDir/caches" -- ` +
+			`$kotlincFlags -jvm-target $kotlinJvmTarget -Xbuild-file=$kotlinBuildFile ` +
+			`-kotlin-home $emptyDir && ` +
+			`mv $incrementalDir/inputs.tmp $incrementalDir/inputs && ` +
+			`${config.SoongZipCmd} -jar -o $out -C $classesDir -D $classesDir && ` +
+			`rm -rf "$srcJarDir"`,
+		CommandDeps: []string{
+			"${config.JavaCmd}",
+			"${config.KotlinIncrementalCompilerJar}",
+			"${config.KotlinBuildToolsApiJar}",
+			"${config.KotlinBuildToolsImplJar}",
+			"${config.KotlinCompilerJar}",
+			"${config.KotlinStdlibJar}",
+			"${config.KotlinTrove4jJar}",
+			"${config.KotlinAnnotationJar}",
+			"${config.GenKotlinBuildFileCmd}",
+			"${config.SoongZipCmd}",
+			"${config.ZipSyncCmd}",
+		},
+		Rspfile:        "$out.rsp",
+		RspfileContent: `$in`,
+	},
+	"kotlincFlags", "classpath", "classpathFiles", "srcJars", "srcJarFilters", "commonSrcFilesArg",
+	"srcJarDir", "classesDir", "incrementalDir", "kotlinJvmTarget", "kotlinBuildFile", "emptyDir", "name")
+
+// kotlinIncrementalCompiler compiles the driver of the kotlincIncremental rule.
+var kotlinIncrementalCompiler = pctx.AndroidStaticRule("kotlinIncrementalCompiler",
+	blueprint.RuleParams{
+		Command: `rm -rf "$classesDir" && mkdir -p "$classesDir" && ` +
+			`${config.KotlincCmd} ${config.KotlincSuppressJDK9Warnings} ${config.JavacHeapFlags} ` +
+			`-classpath ${config.KotlinBuildToolsApiJar} -jvm-target 1.8 -d $classesDir $in && ` +
+			`${config.SoongZipCmd} -jar -o $out -C $classesDir -D $classesDir`,
+		CommandDeps: []string{
+			"${config.KotlincCmd}",
+			"${config.KotlinCompilerJar}",
+			"${config.KotlinStdlibJar}",
+			"${config.KotlinBuildToolsApiJar}",
+			"${config.SoongZipCmd}",
+		},
+	},
+	"classesDir")
+
+func kotlinIncrementalCompilerSingletonFactory() android.Singleton {
+	return &kotlinIncrementalCompilerSingleton{}
+}
+
+// kotlinIncrementalCompilerSingleton builds the driver of the kotlincIncremental rule when
+// KOTLIN_INCREMENTAL=true.  The driver is not a java_binary_host module, as the Kotlin build tools
+// API jars it is compiled against are not in every checkout of external/kotlinc.
+type kotlinIncrementalCompilerSingleton struct{}
+
+func (s *kotlinIncrementalCompilerSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !ctx.Config().IsEnvTrue("KOTLIN_INCREMENTAL") {
+		return
+	}
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        kotlinIncrementalCompiler,
+		Description: "kotlinc kotlin-incremental-compiler",
+		Output:      config.KotlinIncrementalCompilerJar(ctx),
+		Input: android.PathForSource(ctx,
+			"build/soong/cmd/kotlin_incremental_compiler/KotlinIncrementalCompiler.kt"),
+		Args: map[string]string{
+			"classesDir": android.PathForOutput(ctx, "kotlin-incremental-compiler", "classes").String(),
+		},
+	})
+}
 
 func kotlinCommonSrcsList(ctx android.ModuleContext, commonSrcFiles android.Paths) android.OptionalPath {
 	if len(commonSrcFiles) > 0 {
@@ -94,25 +187,46 @@ func kotlinCompile(ctx android.ModuleContext, outputFile android.WritablePath,
 		commonSrcFilesArg = "--common_srcs " + commonSrcsList.String()
 	}
 
+	// Only the .java files of the srcjars are passed to kotlinc, unless they also contain the
+	// .kt files generated by KSP.
+	srcJarFilters := `-f "*.java"`
+	if flags.kotlincSrcJarsHaveKotlin {
+		srcJarFilters += ` -f "*.kt"`
+	}
+
+	rule := kotlinc
+	args := map[string]string{
+		"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
+		"kotlincFlags":      flags.kotlincFlags,
+		"commonSrcFilesArg": commonSrcFilesArg,
+		"srcJars":           strings.Join(srcJars.Strings(), " "),
+		"srcJarFilters":     srcJarFilters,
+		"classesDir":        android.PathForModuleOut(ctx, "kotlinc", "classes").String(),
+		"srcJarDir":         android.PathForModuleOut(ctx, "kotlinc", "srcJars").String(),
+		"kotlinBuildFile":   android.PathForModuleOut(ctx, "kotlinc-build.xml").String(),
+		"emptyDir":          android.PathForModuleOut(ctx, "kotlinc", "empty").String(),
+		// http://b/69160377 kotlinc only supports -jvm-target 1.6 and 1.8
+		"kotlinJvmTarget": "1.8",
+		"name":            kotlinName,
+	}
+	if ctx.Config().IsEnvTrue("KOTLIN_INCREMENTAL") {
+		for _, jar := range config.KotlinBuildToolsJars {
+			if !android.ExistentPathForSource(ctx, jar).Valid() {
+				ctx.ModuleErrorf("cannot build with KOTLIN_INCREMENTAL=true, missing %s?", jar)
+			}
+		}
+		rule = kotlincIncremental
+		args["classpathFiles"] = strings.Join(flags.kotlincClasspath.Strings(), " ")
+		args["incrementalDir"] = android.PathForModuleOut(ctx, "kotlinc", "incremental").String()
+	}
+
 	ctx.Build(pctx, android.BuildParams{
-		Rule:        kotlinc,
+		Rule:        rule,
 		Description: "kotlinc",
 		Output:      outputFile,
 		Inputs:      srcFiles,
 		Implicits:   deps,
-		Args: map[string]string{
-			"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
-			"kotlincFlags":      flags.kotlincFlags,
-			"commonSrcFilesArg": commonSrcFilesArg,
-			"srcJars":           strings.Join(srcJars.Strings(), " "),
-			"classesDir":        android.PathForModuleOut(ctx, "kotlinc", "classes").String(),
-			"srcJarDir":         android.PathForModuleOut(ctx, "kotlinc", "srcJars").String(),
-			"kotlinBuildFile":   android.PathForModuleOut(ctx, "kotlinc-build.xml").String(),
-			"emptyDir":          android.PathForModuleOut(ctx, "kotlinc", "empty").String(),
-			// http://b/69160377 kotlinc only supports -jvm-target 1.6 and 1.8
-			"kotlinJvmTarget": "1.8",
-			"name":            kotlinName,
-		},
+		Args:        args,
 	})
 }
 
@@ -218,6 +332,94 @@ func kotlinKapt(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile an
 	})
 }
 
+var ksp = pctx.AndroidRemoteStaticRule("ksp", android.RemoteRuleSupports{Goma: true},
+	blueprint.RuleParams{
+		Command: `rm -rf "$srcJarDir" "$kotlinBuildFile" "$kspDir" && ` +
+			`mkdir -p "$srcJarDir" "$kspDir/java" "$kspDir/kotlin" "$kspDir/classes" "$kspDir/resources" && ` +
+			`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" -f "*.kt" $srcJars && ` +
+			`${config.GenKotlinBuildFileCmd} --classpath "$classpath" --name "$name"` +
+			` --srcs "$out.rsp" --srcs "$srcJarDir/list"` +
+			` $commonSrcFilesArg --out "$kotlinBuildFile" && ` +
+			`${config.KotlincCmd} ${config.KotlincSuppressJDK9Warnings} ` +
+			`${config.JavacHeapFlags} $kotlincFlags ` +
+			`-Xplugin=${config.KotlinKspJar} -Xplugin=${config.KotlinKspApiJar} ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:apclasspath=$kspProcessorPath ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:projectBaseDir=$kspDir ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:kspOutputDir=$kspDir ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:cachesDir=$kspDir/caches ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:javaOutputDir=$kspDir/java ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:kotlinOutputDir=$kspDir/kotlin ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:classOutputDir=$kspDir/classes ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:resourceOutputDir=$kspDir/resources ` +
+			`-P plugin:com.google.devtools.ksp.symbol-processing:incremental=false ` +
+			`-Xbuild-file=$kotlinBuildFile && ` +
+			`${config.SoongZipCmd} -jar -o $out -C $kspDir/java -D $kspDir/java -C $kspDir/kotlin -D $kspDir/kotlin && ` +
+			`${config.SoongZipCmd} -jar -o $classesJarOut -C $kspDir/classes -D $kspDir/classes ` +
+			`-C $kspDir/resources -D $kspDir/resources && ` +
+			`rm -rf "$srcJarDir"`,
+		CommandDeps: []string{
+			"${config.KotlincCmd}",
+			"${config.KotlinCompilerJar}",
+			"${config.KotlinKspJar}",
+			"${config.KotlinKspApiJar}",
+			"${config.GenKotlinBuildFileCmd}",
+			"${config.SoongZipCmd}",
+			"${config.ZipSyncCmd}",
+		},
+		Rspfile:        "$out.rsp",
+		RspfileContent: `$in`,
+	},
+	"kotlincFlags", "kspProcessorPath", "classpath", "srcJars", "commonSrcFilesArg", "srcJarDir",
+	"kspDir", "kotlinBuildFile", "name", "classesJarOut")
+
+// kotlinKsp runs the Kotlin Symbol Processing processors of the module.  It takes .kt and .java
+// sources and srcjars, and produces a srcjar of the generated .kt and .java sources in
+// srcJarOutputFile and a jar of the generated classes and resources in resJarOutputFile.  The
+// srcjar should be added as an additional input to kotlinc and javac rules.
+func kotlinKsp(ctx android.ModuleContext, srcJarOutputFile, resJarOutputFile android.WritablePath,
+	srcFiles, commonSrcFiles, srcJars android.Paths,
+	flags javaBuilderFlags) {
+
+	srcFiles = append(android.Paths(nil), srcFiles...)
+
+	var deps android.Paths
+	deps = append(deps, flags.kotlincClasspath...)
+	deps = append(deps, srcJars...)
+	deps = append(deps, flags.kspProcessorPath...)
+	deps = append(deps, commonSrcFiles...)
+
+	commonSrcsList := kotlinCommonSrcsList(ctx, commonSrcFiles)
+	commonSrcFilesArg := ""
+	if commonSrcsList.Valid() {
+		deps = append(deps, commonSrcsList.Path())
+		commonSrcFilesArg = "--common_srcs " + commonSrcsList.String()
+	}
+
+	kotlinName := filepath.Join(ctx.ModuleDir(), ctx.ModuleSubDir(), ctx.ModuleName())
+	kotlinName = strings.ReplaceAll(kotlinName, "/", "__")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           ksp,
+		Description:    "ksp",
+		Output:         srcJarOutputFile,
+		ImplicitOutput: resJarOutputFile,
+		Inputs:         srcFiles,
+		Implicits:      deps,
+		Args: map[string]string{
+			"classpath":         flags.kotlincClasspath.FormJavaClassPath(""),
+			"kotlincFlags":      flags.kotlincFlags,
+			"commonSrcFilesArg": commonSrcFilesArg,
+			"srcJars":           strings.Join(srcJars.Strings(), " "),
+			"srcJarDir":         android.PathForModuleOut(ctx, "ksp", "srcJars").String(),
+			"kotlinBuildFile":   android.PathForModuleOut(ctx, "ksp", "build.xml").String(),
+			"kspProcessorPath":  flags.kspProcessorPath.FormJavaClassPath(""),
+			"kspDir":            android.PathForModuleOut(ctx, "ksp/gen").String(),
+			"name":              kotlinName,
+			"classesJarOut":     resJarOutputFile.String(),
+		},
+	})
+}
+
 // kapt converts a list of key, value pairs into a base64 encoded Java serialization, which is what kapt expects.
 func kaptEncodeFlags(options [][2]string) string {
 	buf := &bytes.Buffer{}
@@ -223,6 +223,173 @@ func TestKapt(t *testing.T) {
 	})
 }
 
+// prepareForKspTest adds the jars of KSP, which are not in every checkout of external/kotlinc.
+var prepareForKspTest = android.GroupFixturePreparers(
+	prepareForJavaTest,
+	android.FixtureAddFile("external/kotlinc/lib/symbol-processing-cmdline.jar", nil),
+	android.FixtureAddFile("external/kotlinc/lib/symbol-processing-api.jar", nil),
+)
+
+func TestKsp(t *testing.T) {
+	ctx := prepareForKspTest.RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			plugins: ["bar", "baz"],
+		}
+
+		java_plugin {
+			name: "bar",
+			srcs: ["b.java"],
+			ksp: true,
+		}
+
+		java_plugin {
+			name: "baz",
+			processor_class: "com.baz",
+			srcs: ["b.java"],
+		}
+	`).TestContext
+
+	buildOS := ctx.Config().BuildOS.String()
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	ksp := foo.Rule("ksp")
+	kapt := foo.Rule("kapt")
+	kotlinc := foo.Rule("kotlinc")
+	javac := foo.Rule("javac")
+	combined := foo.Output("combined/foo.jar")
+
+	bar := ctx.ModuleForTests("bar", buildOS+"_common").Rule("javac").Output.String()
+	baz := ctx.ModuleForTests("baz", buildOS+"_common").Rule("javac").Output.String()
+
+	// Test that the KSP processors are only passed to KSP, and the others only to kapt
+	android.AssertStringEquals(t, "ksp processor path", bar, ksp.Args["kspProcessorPath"])
+	android.AssertStringEquals(t, "kapt processor path",
+		"-P plugin:org.jetbrains.kotlin.kapt3:apclasspath="+baz, kapt.Args["kaptProcessorPath"])
+
+	// Test that the KSP srcjar is compiled by kapt, kotlinc and javac
+	android.AssertStringListContains(t, "kapt srcjars", strings.Fields(kapt.Args["srcJars"]), ksp.Output.String())
+	android.AssertStringListContains(t, "kotlinc srcjars", strings.Fields(kotlinc.Args["srcJars"]), ksp.Output.String())
+	android.AssertStringListContains(t, "javac srcjars", strings.Fields(javac.Args["srcJars"]), ksp.Output.String())
+	// Test that kotlinc compiles the .kt files generated by KSP
+	android.AssertStringDoesContain(t, "kotlinc srcjar filters", kotlinc.Args["srcJarFilters"], `"*.kt"`)
+
+	// Test that the classes and resources generated by KSP are in the final jar
+	android.AssertStringListContains(t, "combined jar inputs", combined.Inputs.Strings(), ksp.ImplicitOutput.String())
+}
+
+func TestKspWithoutKotlin(t *testing.T) {
+	testJavaError(t, "KSP plugins can only be used by modules with kotlin sources", `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			plugins: ["bar"],
+		}
+
+		java_plugin {
+			name: "bar",
+			srcs: ["b.java"],
+			ksp: true,
+		}
+	`)
+}
+
+func TestKspMissing(t *testing.T) {
+	testJavaError(t, "cannot use KSP plugins, missing external/kotlinc/lib/symbol-processing-cmdline.jar", `
+		java_library {
+			name: "foo",
+			srcs: ["b.kt"],
+			plugins: ["bar"],
+		}
+
+		java_plugin {
+			name: "bar",
+			srcs: ["b.java"],
+			ksp: true,
+		}
+	`)
+}
+
+func TestKotlinIncremental(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+		}
+	`
+
+	prepareForKotlinIncremental := android.GroupFixturePreparers(
+		prepareForJavaTest,
+		android.FixtureMergeEnv(map[string]string{
+			"KOTLIN_INCREMENTAL": "true",
+		}),
+		android.FixtureAddFile("build/soong/cmd/kotlin_incremental_compiler/KotlinIncrementalCompiler.kt", nil),
+	)
+	result := android.GroupFixturePreparers(
+		prepareForKotlinIncremental,
+		android.FixtureAddFile("external/kotlinc/lib/kotlin-build-tools-api.jar", nil),
+		android.FixtureAddFile("external/kotlinc/lib/kotlin-build-tools-impl.jar", nil),
+	).RunTestWithBp(t, bp)
+
+	kotlinc := result.ModuleForTests("foo", "android_common").Rule("kotlinc")
+	android.AssertStringDoesContain(t, "kotlinc rule", kotlinc.Rule.String(), "kotlincIncremental")
+	android.AssertStringEquals(t, "incremental dir",
+		"out/soong/.intermediates/foo/android_common/kotlinc/incremental", kotlinc.Args["incrementalDir"])
+	for _, jar := range strings.Fields(kotlinc.Args["classpathFiles"]) {
+		android.AssertStringListContains(t, "kotlinc implicits", kotlinc.Implicits.Strings(), jar)
+	}
+	// Test that only the .java files of the srcjars are compiled without KSP
+	android.AssertStringEquals(t, "kotlinc srcjar filters", `-f "*.java"`, kotlinc.Args["srcJarFilters"])
+
+	// Test that the driver is built from build/soong/cmd/kotlin_incremental_compiler
+	driver := result.SingletonForTests("kotlin_incremental_compiler").Rule("kotlinIncrementalCompiler")
+	android.AssertPathRelativeToTopEquals(t, "driver source",
+		"build/soong/cmd/kotlin_incremental_compiler/KotlinIncrementalCompiler.kt", driver.Input)
+	android.AssertPathRelativeToTopEquals(t, "driver jar",
+		"out/soong/kotlin-incremental-compiler/kotlin-incremental-compiler.jar", driver.Output)
+
+	// Test that the Kotlin build tools jars are required
+	prepareForKotlinIncremental.ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+		"cannot build with KOTLIN_INCREMENTAL=true, missing external/kotlinc/lib/kotlin-build-tools-api.jar")).
+		RunTestWithBp(t, bp)
+
+	// Test that the incremental rule is only used when requested
+	ctx, _ := testJava(t, bp)
+	kotlinc = ctx.ModuleForTests("foo", "android_common").Rule("kotlinc")
+	android.AssertStringDoesNotContain(t, "kotlinc rule", kotlinc.Rule.String(), "kotlincIncremental")
+}
+
+func TestKotlinLangVersion(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			kotlin_lang_version: "2.0",
+		}
+	`)
+
+	kotlincFlags := ctx.ModuleForTests("foo", "android_common").VariablesForTestsRelativeToTop()["kotlincFlags"]
+	android.AssertStringDoesContain(t, "kotlinc flags", kotlincFlags, "-language-version 2.0")
+
+	testJavaError(t, `expected a version like "1.9", got "two"`, `
+		java_library {
+			name: "foo",
+			srcs: ["b.kt"],
+			kotlin_lang_version: "two",
+		}
+	`)
+
+	testJavaError(t, "use kotlin_lang_version instead of -language-version", `
+		java_library {
+			name: "foo",
+			srcs: ["b.kt"],
+			kotlin_lang_version: "2.0",
+			kotlincflags: ["-language-version 1.9"],
+		}
+	`)
+}
+
 func TestKaptEncodeFlags(t *testing.T) {
 	// Compares the kaptEncodeFlags against the results of the example implementation at
 	// https://kotlinlang.org/docs/reference/kapt.html#apjavac-options-encoding
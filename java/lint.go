@@ -16,6 +16,7 @@ package java
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -95,6 +96,10 @@ type lintOutputs struct {
 	text android.Path
 	xml  android.Path
 
+	// The issues of the baseline of the module that lint no longer reports, or nil if the
+	// module has no baseline or ANDROID_LINT_STALE_BASELINES is not set.
+	staleBaseline android.Path
+
 	depSets LintDepSets
 }
 
@@ -209,14 +214,16 @@ func lintRBEExecStrategy(ctx android.ModuleContext) string {
 	return ctx.Config().GetenvWithDefault("RBE_LINT_EXEC_STRATEGY", remoteexec.LocalExecStrategy)
 }
 
-func (l *linter) writeLintProjectXML(ctx android.ModuleContext, rule *android.RuleBuilder) lintPaths {
-	projectXMLPath := android.PathForModuleOut(ctx, "lint", "project.xml")
+func (l *linter) writeLintProjectXML(ctx android.ModuleContext, rule *android.RuleBuilder, dir string,
+	manifest android.Path, cached bool) lintPaths {
+
+	projectXMLPath := android.PathForModuleOut(ctx, dir, "project.xml")
 	// Lint looks for a lint.xml file next to the project.xml file, give it one.
-	configXMLPath := android.PathForModuleOut(ctx, "lint", "lint.xml")
-	cacheDir := android.PathForModuleOut(ctx, "lint", "cache")
-	homeDir := android.PathForModuleOut(ctx, "lint", "home")
+	configXMLPath := android.PathForModuleOut(ctx, dir, "lint.xml")
+	cacheDir := android.PathForModuleOut(ctx, dir, "cache")
+	homeDir := android.PathForModuleOut(ctx, dir, "home")
 
-	srcJarDir := android.PathForModuleOut(ctx, "lint", "srcjars")
+	srcJarDir := android.PathForModuleOut(ctx, dir, "srcjars")
 	srcJarList := zipSyncCmd(ctx, rule, srcJarDir, l.srcJars)
 
 	cmd := rule.Command().
@@ -231,8 +238,8 @@ func (l *linter) writeLintProjectXML(ctx android.ModuleContext, rule *android.Ru
 	if l.test {
 		cmd.Flag("--test")
 	}
-	if l.manifest != nil {
-		cmd.FlagWithInput("--manifest ", l.manifest)
+	if manifest != nil {
+		cmd.FlagWithInput("--manifest ", manifest)
 	}
 	if l.mergedManifest != nil {
 		cmd.FlagWithInput("--merged_manifest ", l.mergedManifest)
@@ -240,21 +247,33 @@ func (l *linter) writeLintProjectXML(ctx android.ModuleContext, rule *android.Ru
 
 	// TODO(ccross): some of the files in l.srcs are generated sources and should be passed to
 	// lint separately.
-	srcsList := android.PathForModuleOut(ctx, "lint-srcs.list")
+	srcsList := android.PathForModuleOut(ctx, dir+"-srcs.list")
 	cmd.FlagWithRspFileInputList("--srcs ", srcsList, l.srcs)
 
 	cmd.FlagWithInput("--generated_srcs ", srcJarList)
 
 	if len(l.resources) > 0 {
-		resourcesList := android.PathForModuleOut(ctx, "lint-resources.list")
+		resourcesList := android.PathForModuleOut(ctx, dir+"-resources.list")
 		cmd.FlagWithRspFileInputList("--resources ", resourcesList, l.resources)
 	}
 
-	if l.classes != nil {
-		cmd.FlagWithInput("--classes ", l.classes)
-	}
+	if cached {
+		// The classes of the module and its classpath are only order-only dependencies of cached
+		// lint rules, so that changes to the dependencies of the module don't rerun lint.
+		if l.classes != nil {
+			cmd.FlagWithArg("--classes ", l.classes.String()).OrderOnly(l.classes)
+		}
+		for _, classpath := range l.classpath {
+			cmd.FlagWithArg("--classpath ", classpath.String())
+		}
+		cmd.OrderOnlys(l.classpath)
+	} else {
+		if l.classes != nil {
+			cmd.FlagWithInput("--classes ", l.classes)
+		}
 
-	cmd.FlagForEachInput("--classpath ", l.classpath)
+		cmd.FlagForEachInput("--classpath ", l.classpath)
+	}
 
 	cmd.FlagForEachInput("--extra_checks_jar ", l.extraLintCheckJars)
 
@@ -292,8 +311,8 @@ func (l *linter) writeLintProjectXML(ctx android.ModuleContext, rule *android.Ru
 
 // generateManifest adds a command to the rule to write a simple manifest that contains the
 // minSdkVersion and targetSdkVersion for modules (like java_library) that don't have a manifest.
-func (l *linter) generateManifest(ctx android.ModuleContext, rule *android.RuleBuilder) android.WritablePath {
-	manifestPath := android.PathForModuleOut(ctx, "lint", "AndroidManifest.xml")
+func (l *linter) generateManifest(ctx android.ModuleContext, rule *android.RuleBuilder, dir string) android.WritablePath {
+	manifestPath := android.PathForModuleOut(ctx, dir, "AndroidManifest.xml")
 
 	rule.Command().Text("(").
 		Text(`echo "<?xml version='1.0' encoding='utf-8'?>" &&`).
@@ -320,40 +339,32 @@ func (l *linter) getBaselineFilepath(ctx android.ModuleContext) android.Optional
 	return lintBaseline
 }
 
-func (l *linter) lint(ctx android.ModuleContext) {
-	if !l.enabled() {
-		return
-	}
+// lintCacheEnabled returns true if lint should only rerun when the sources, manifest, resources or
+// lint checks of a module change, and not when the classes of its dependencies change.  It is
+// enabled by setting ANDROID_LINT_CACHE=true, and is not supported when lint runs remotely as
+// remote actions need all their inputs.
+func lintCacheEnabled(ctx android.ModuleContext) bool {
+	return ctx.Config().IsEnvTrue("ANDROID_LINT_CACHE") &&
+		!(ctx.Config().UseRBE() && ctx.Config().IsEnvTrue("RBE_LINT"))
+}
 
-	if l.minSdkVersion != l.compileSdkVersion {
-		l.extraMainlineLintErrors = append(l.extraMainlineLintErrors, updatabilityChecks...)
-		_, filtered := android.FilterList(l.properties.Lint.Warning_checks, updatabilityChecks)
-		if len(filtered) != 0 {
-			ctx.PropertyErrorf("lint.warning_checks",
-				"Can't treat %v checks as warnings if min_sdk_version is different from sdk_version.", filtered)
-		}
-		_, filtered = android.FilterList(l.properties.Lint.Disabled_checks, updatabilityChecks)
-		if len(filtered) != 0 {
-			ctx.PropertyErrorf("lint.disabled_checks",
-				"Can't disable %v checks if min_sdk_version is different from sdk_version.", filtered)
-		}
-	}
+// newLintRule returns a rule that runs lint on the module in the given subdirectory of the module's
+// output directory, and the command running lint so that the caller can add the flags that select
+// what lint writes.  The given outputs are removed before running lint.
+func (l *linter) newLintRule(ctx android.ModuleContext, dir string,
+	outputs ...android.WritablePath) (*android.RuleBuilder, *android.RuleBuilderCommand, lintPaths) {
 
-	extraLintCheckModules := ctx.GetDirectDepsWithTag(extraLintCheckTag)
-	for _, extraLintCheckModule := range extraLintCheckModules {
-		if ctx.OtherModuleHasProvider(extraLintCheckModule, JavaInfoProvider) {
-			dep := ctx.OtherModuleProvider(extraLintCheckModule, JavaInfoProvider).(JavaInfo)
-			l.extraLintCheckJars = append(l.extraLintCheckJars, dep.ImplementationAndResourcesJars...)
-		} else {
-			ctx.PropertyErrorf("lint.extra_check_modules",
-				"%s is not a java module", ctx.OtherModuleName(extraLintCheckModule))
-		}
-	}
+	cached := lintCacheEnabled(ctx)
 
 	rule := android.NewRuleBuilder(pctx, ctx).
-		Sbox(android.PathForModuleOut(ctx, "lint"),
-			android.PathForModuleOut(ctx, "lint.sbox.textproto")).
-		SandboxInputs()
+		Sbox(android.PathForModuleOut(ctx, dir),
+			android.PathForModuleOut(ctx, dir+".sbox.textproto"))
+
+	// The inputs of cached lint rules can't be sandboxed, their classpath is only an order-only
+	// dependency.
+	if !cached {
+		rule.SandboxInputs()
+	}
 
 	if ctx.Config().UseRBE() && ctx.Config().IsEnvTrue("RBE_LINT") {
 		pool := ctx.Config().GetenvWithDefault("RBE_LINT_POOL", "java16")
@@ -366,29 +377,23 @@ func (l *linter) lint(ctx android.ModuleContext) {
 		})
 	}
 
-	if l.manifest == nil {
-		manifest := l.generateManifest(ctx, rule)
-		l.manifest = manifest
-		rule.Temporary(manifest)
+	manifest := l.manifest
+	if manifest == nil {
+		generatedManifest := l.generateManifest(ctx, rule, dir)
+		rule.Temporary(generatedManifest)
+		manifest = generatedManifest
 	}
 
-	lintPaths := l.writeLintProjectXML(ctx, rule)
-
-	html := android.PathForModuleOut(ctx, "lint", "lint-report.html")
-	text := android.PathForModuleOut(ctx, "lint", "lint-report.txt")
-	xml := android.PathForModuleOut(ctx, "lint", "lint-report.xml")
-
-	depSetsBuilder := NewLintDepSetBuilder().Direct(html, text, xml)
-
-	ctx.VisitDirectDepsWithTag(staticLibTag, func(dep android.Module) {
-		if depLint, ok := dep.(lintDepSetsIntf); ok {
-			depSetsBuilder.Transitive(depLint.LintDepSets())
-		}
-	})
+	lintPaths := l.writeLintProjectXML(ctx, rule, dir, manifest, cached)
 
 	rule.Command().Text("rm -rf").Flag(lintPaths.cacheDir.String()).Flag(lintPaths.homeDir.String())
 	rule.Command().Text("mkdir -p").Flag(lintPaths.cacheDir.String()).Flag(lintPaths.homeDir.String())
-	rule.Command().Text("rm -f").Output(html).Output(text).Output(xml)
+	if len(outputs) > 0 {
+		cmd := rule.Command().Text("rm -f")
+		for _, output := range outputs {
+			cmd.Output(output)
+		}
+	}
 
 	var apiVersionsName, apiVersionsPrebuilt string
 	if l.compileSdkKind == android.SdkModule || l.compileSdkKind == android.SdkSystemServer {
@@ -423,14 +428,10 @@ func (l *linter) lint(ctx android.ModuleContext) {
 		Flag("--quiet").
 		FlagWithInput("--project ", lintPaths.projectXML).
 		FlagWithInput("--config ", lintPaths.configXML).
-		FlagWithOutput("--html ", html).
-		FlagWithOutput("--text ", text).
-		FlagWithOutput("--xml ", xml).
 		FlagWithArg("--compile-sdk-version ", l.compileSdkVersion).
 		FlagWithArg("--java-language-level ", l.javaLanguageLevel).
 		FlagWithArg("--kotlin-language-level ", l.kotlinLanguageLevel).
 		FlagWithArg("--url ", fmt.Sprintf(".=.,%s=out", android.PathForOutput(ctx).String())).
-		Flag("--exitcode").
 		Flags(l.properties.Lint.Flags).
 		Implicit(annotationsZipPath).
 		Implicit(apiVersionsXMLPath)
@@ -438,13 +439,76 @@ func (l *linter) lint(ctx android.ModuleContext) {
 	rule.Temporary(lintPaths.projectXML)
 	rule.Temporary(lintPaths.configXML)
 
-	if checkOnly := ctx.Config().Getenv("ANDROID_LINT_CHECK"); checkOnly != "" {
+	return rule, cmd, lintPaths
+}
+
+func (l *linter) lint(ctx android.ModuleContext) {
+	if !l.enabled() {
+		return
+	}
+
+	if l.minSdkVersion != l.compileSdkVersion {
+		l.extraMainlineLintErrors = append(l.extraMainlineLintErrors, updatabilityChecks...)
+		_, filtered := android.FilterList(l.properties.Lint.Warning_checks, updatabilityChecks)
+		if len(filtered) != 0 {
+			ctx.PropertyErrorf("lint.warning_checks",
+				"Can't treat %v checks as warnings if min_sdk_version is different from sdk_version.", filtered)
+		}
+		_, filtered = android.FilterList(l.properties.Lint.Disabled_checks, updatabilityChecks)
+		if len(filtered) != 0 {
+			ctx.PropertyErrorf("lint.disabled_checks",
+				"Can't disable %v checks if min_sdk_version is different from sdk_version.", filtered)
+		}
+	}
+
+	extraLintCheckModules := ctx.GetDirectDepsWithTag(extraLintCheckTag)
+	for _, extraLintCheckModule := range extraLintCheckModules {
+		if ctx.OtherModuleHasProvider(extraLintCheckModule, JavaInfoProvider) {
+			dep := ctx.OtherModuleProvider(extraLintCheckModule, JavaInfoProvider).(JavaInfo)
+			l.extraLintCheckJars = append(l.extraLintCheckJars, dep.ImplementationAndResourcesJars...)
+		} else {
+			ctx.PropertyErrorf("lint.extra_check_modules",
+				"%s is not a java module", ctx.OtherModuleName(extraLintCheckModule))
+		}
+	}
+
+	html := android.PathForModuleOut(ctx, "lint", "lint-report.html")
+	text := android.PathForModuleOut(ctx, "lint", "lint-report.txt")
+	xml := android.PathForModuleOut(ctx, "lint", "lint-report.xml")
+
+	depSetsBuilder := NewLintDepSetBuilder().Direct(html, text, xml)
+
+	ctx.VisitDirectDepsWithTag(staticLibTag, func(dep android.Module) {
+		if depLint, ok := dep.(lintDepSetsIntf); ok {
+			depSetsBuilder.Transitive(depLint.LintDepSets())
+		}
+	})
+
+	rule, cmd, lintPaths := l.newLintRule(ctx, "lint", html, text, xml)
+
+	cmd.FlagWithOutput("--html ", html).
+		FlagWithOutput("--text ", text).
+		FlagWithOutput("--xml ", xml).
+		Flag("--exitcode")
+
+	checkOnly := ctx.Config().Getenv("ANDROID_LINT_CHECK")
+	if checkOnly != "" {
 		cmd.FlagWithArg("--check ", checkOnly)
 	}
 
 	lintBaseline := l.getBaselineFilepath(ctx)
+	var referenceBaseline android.WritablePath
 	if lintBaseline.Valid() {
 		cmd.FlagWithInput("--baseline ", lintBaseline.Path())
+
+		// The reference baseline lists all the issues found by lint, including the ones that
+		// were filtered by the baseline.  It is only written when the stale baselines are
+		// requested with ANDROID_LINT_STALE_BASELINES=true, and is incomplete when only some
+		// checks are run.
+		if checkOnly == "" && ctx.Config().IsEnvTrue("ANDROID_LINT_STALE_BASELINES") {
+			referenceBaseline = android.PathForModuleOut(ctx, "lint", "lint-reference-baseline.xml")
+			cmd.FlagWithOutput("--write-reference-baseline ", referenceBaseline)
+		}
 	}
 
 	cmd.Text("|| (").Text("if [ -e").Input(text).Text("]; then cat").Input(text).Text("; fi; exit 7)")
@@ -464,11 +528,88 @@ func (l *linter) lint(ctx android.ModuleContext) {
 		depSets: depSetsBuilder.Build(),
 	}
 
+	if referenceBaseline != nil {
+		l.outputs.staleBaseline = l.staleBaselineReport(ctx, lintBaseline.Path(), referenceBaseline)
+	}
+
+	l.updateBaseline(ctx)
+
 	if l.buildModuleReportZip {
 		l.reports = BuildModuleLintReportZips(ctx, l.LintDepSets())
 	}
 }
 
+// staleBaselineReport builds a rule that lists the issues of the baseline of the module that lint
+// no longer reports, and returns the path to the list.
+func (l *linter) staleBaselineReport(ctx android.ModuleContext, baseline, referenceBaseline android.Path) android.Path {
+	report := android.PathForModuleOut(ctx, "lint-stale-baseline.txt")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("lint_stale_baseline").
+		FlagWithArg("--name ", ctx.ModuleName()).
+		FlagWithInput("--baseline ", baseline).
+		FlagWithInput("--reference ", referenceBaseline).
+		FlagWithOutput("--output ", report)
+	rule.Build("lintStaleBaseline", "lint stale baseline")
+
+	return report
+}
+
+// updateBaseline builds the rules that regenerate the baseline of the module in the source tree.
+// The rules are only created for the modules selected by ANDROID_LINT_UPDATE_BASELINES, which lists
+// module names separated by commas, or is "all" to select all the modules that already have a
+// baseline.  m lint-update-baselines regenerates the baselines of all the selected modules, and
+// m <module>-lint-update-baseline the one of a single module.  Lint runs without the baseline and
+// without failing on errors, and all the issues it finds are written to the new baseline.
+func (l *linter) updateBaseline(ctx android.ModuleContext) {
+	modules := ctx.Config().Getenv("ANDROID_LINT_UPDATE_BASELINES")
+	if modules == "" {
+		return
+	}
+
+	lintFilename := proptools.StringDefault(l.properties.Lint.Baseline_filename, "lint-baseline.xml")
+	if lintFilename == "" {
+		return
+	}
+
+	// Only update the baseline from one variant of the module.
+	if apexInfo := ctx.Provider(android.ApexInfoProvider).(android.ApexInfo); !apexInfo.IsForPlatform() {
+		return
+	}
+
+	lintBaseline := l.getBaselineFilepath(ctx)
+	if modules == "all" {
+		if !lintBaseline.Valid() {
+			return
+		}
+	} else if !android.InList(ctx.ModuleName(), strings.Split(modules, ",")) {
+		return
+	}
+
+	baselineFile := filepath.Join(ctx.ModuleDir(), lintFilename)
+	if lintBaseline.Valid() {
+		baselineFile = lintBaseline.String()
+	}
+
+	newBaseline := android.PathForModuleOut(ctx, "lint-baseline", "lint-baseline.xml")
+	rule, cmd, lintPaths := l.newLintRule(ctx, "lint-baseline")
+	cmd.FlagWithOutput("--write-reference-baseline ", newBaseline)
+	rule.Command().Text("rm -rf").Flag(lintPaths.cacheDir.String()).Flag(lintPaths.homeDir.String())
+	rule.Build("lintBaseline", "lint baseline")
+
+	updateTimestamp := android.PathForModuleOut(ctx, "lint-update-baseline.timestamp")
+	rule = android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("cp").Flag("-f").
+		Input(newBaseline).Flag(baselineFile).
+		Text("&&").
+		Text("touch").Output(updateTimestamp)
+	rule.Build("lintUpdateBaseline", "update lint baseline")
+
+	ctx.Phony(ctx.ModuleName()+"-lint-update-baseline", updateTimestamp)
+	ctx.Phony("lint-update-baselines", updateTimestamp)
+}
+
 func BuildModuleLintReportZips(ctx android.ModuleContext, depSets LintDepSets) android.Paths {
 	htmlList := depSets.HTML.ToSortedList()
 	textList := depSets.Text.ToSortedList()
@@ -491,9 +632,10 @@ func BuildModuleLintReportZips(ctx android.ModuleContext, depSets LintDepSets) a
 }
 
 type lintSingleton struct {
-	htmlZip android.WritablePath
-	textZip android.WritablePath
-	xmlZip  android.WritablePath
+	htmlZip        android.WritablePath
+	textZip        android.WritablePath
+	xmlZip         android.WritablePath
+	staleBaselines android.WritablePath
 }
 
 func (l *lintSingleton) GenerateBuildActions(ctx android.SingletonContext) {
@@ -614,11 +756,36 @@ func (l *lintSingleton) generateLintReportZips(ctx android.SingletonContext) {
 	zip(l.xmlZip, func(l *lintOutputs) android.Path { return l.xml })
 
 	ctx.Phony("lint-check", l.htmlZip, l.textZip, l.xmlZip)
+
+	if !ctx.Config().IsEnvTrue("ANDROID_LINT_STALE_BASELINES") {
+		return
+	}
+
+	var staleBaselines android.Paths
+	for _, output := range outputs {
+		if output.staleBaseline != nil {
+			staleBaselines = append(staleBaselines, output.staleBaseline)
+		}
+	}
+
+	l.staleBaselines = android.PathForOutput(ctx, "lint-stale-baselines.txt")
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().
+		Text("xargs -r cat").
+		FlagWithRspFileInputList("< ", l.staleBaselines.ReplaceExtension(ctx, "rsp"),
+			android.SortedUniquePaths(staleBaselines)).
+		Text(">").Output(l.staleBaselines)
+	rule.Build("lint-stale-baselines", "lint stale baselines")
+
+	ctx.Phony("lint-stale-baselines", l.staleBaselines)
 }
 
 func (l *lintSingleton) MakeVars(ctx android.MakeVarsContext) {
 	if !ctx.Config().UnbundledBuild() {
 		ctx.DistForGoal("lint-check", l.htmlZip, l.textZip, l.xmlZip)
+		if l.staleBaselines != nil {
+			ctx.DistForGoal("lint-check", l.staleBaselines)
+		}
 	}
 }
 
@@ -294,3 +294,164 @@ func TestJavaLintDatabaseSelectionPublicFiltered(t *testing.T) {
 		}
 	}
 }
+
+func TestJavaLintBaselineUpdate(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+			],
+			min_sdk_version: "29",
+			sdk_version: "current",
+		}
+	`
+	fs := android.MockFS{
+		"lint-baseline.xml": nil,
+	}
+
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		fs.AddToFixture(),
+		android.FixtureMergeEnv(map[string]string{
+			"ANDROID_LINT_STALE_BASELINES":  "true",
+			"ANDROID_LINT_UPDATE_BASELINES": "all",
+		}),
+	).RunTestWithBp(t, bp)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	sboxProto := android.RuleBuilderSboxProtoForTests(t, foo.Output("lint.sbox.textproto"))
+	android.AssertStringDoesContain(t, "lint command", *sboxProto.Commands[0].Command,
+		"--write-reference-baseline __SBOX_SANDBOX_DIR__/out/lint-reference-baseline.xml")
+
+	stale := foo.Output("lint-stale-baseline.txt")
+	android.AssertPathsRelativeToTopEquals(t, "stale baseline inputs", []string{
+		"lint-baseline.xml",
+		"out/soong/.intermediates/foo/android_common/lint/lint-reference-baseline.xml",
+	}, stale.Inputs)
+
+	sboxProto = android.RuleBuilderSboxProtoForTests(t, foo.Output("lint-baseline.sbox.textproto"))
+	android.AssertStringDoesContain(t, "lint baseline command", *sboxProto.Commands[0].Command,
+		"--write-reference-baseline __SBOX_SANDBOX_DIR__/out/lint-baseline.xml")
+	android.AssertStringDoesNotContain(t, "lint baseline command", *sboxProto.Commands[0].Command,
+		"--exitcode")
+	android.AssertStringDoesNotContain(t, "lint baseline command", *sboxProto.Commands[0].Command,
+		"--baseline ")
+
+	update := foo.Output("lint-update-baseline.timestamp")
+	android.AssertStringDoesContain(t, "update baseline command", update.RuleParams.Command,
+		"cp -f out/soong/.intermediates/foo/android_common/lint-baseline/lint-baseline.xml lint-baseline.xml")
+}
+
+func TestJavaLintBaselineNotRequested(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+			],
+			min_sdk_version: "29",
+			sdk_version: "current",
+		}
+	`
+	fs := android.MockFS{
+		"lint-baseline.xml": nil,
+	}
+
+	result := android.GroupFixturePreparers(PrepareForTestWithJavaDefaultModules, fs.AddToFixture()).
+		RunTestWithBp(t, bp)
+
+	foo := result.ModuleForTests("foo", "android_common")
+
+	sboxProto := android.RuleBuilderSboxProtoForTests(t, foo.Output("lint.sbox.textproto"))
+	android.AssertStringDoesNotContain(t, "lint command", *sboxProto.Commands[0].Command,
+		"--write-reference-baseline")
+
+	if stale := foo.MaybeOutput("lint-stale-baseline.txt"); stale.Rule != nil {
+		t.Error("unexpected stale baseline report without ANDROID_LINT_STALE_BASELINES")
+	}
+	if update := foo.MaybeOutput("lint-update-baseline.timestamp"); update.Rule != nil {
+		t.Error("unexpected baseline update without ANDROID_LINT_UPDATE_BASELINES")
+	}
+	if lint := foo.MaybeOutput("lint-baseline.sbox.textproto"); lint.Rule != nil {
+		t.Error("unexpected lint run for the baseline without ANDROID_LINT_UPDATE_BASELINES")
+	}
+}
+
+func TestJavaLintWithoutBaselineHasNoStaleReport(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		PrepareForTestWithJavaDefaultModules,
+		android.FixtureMergeEnv(map[string]string{
+			"ANDROID_LINT_STALE_BASELINES":  "true",
+			"ANDROID_LINT_UPDATE_BASELINES": "foo",
+		}),
+	).RunTestWithBp(t, `
+			java_library {
+				name: "foo",
+				srcs: [
+					"a.java",
+				],
+				min_sdk_version: "29",
+				sdk_version: "current",
+			}
+		`)
+
+	foo := result.ModuleForTests("foo", "android_common")
+	if stale := foo.MaybeOutput("lint-stale-baseline.txt"); stale.Rule != nil {
+		t.Error("unexpected stale baseline report for a module without a baseline")
+	}
+
+	// The baseline can still be created when the module is selected by name.
+	foo.Output("lint-update-baseline.timestamp")
+}
+
+func TestJavaLintCache(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+			],
+			min_sdk_version: "29",
+			sdk_version: "current",
+		}
+	`
+
+	testCases := []struct {
+		name   string
+		cached bool
+	}{
+		{name: "default", cached: false},
+		{name: "cached", cached: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			env := map[string]string{}
+			if testCase.cached {
+				env["ANDROID_LINT_CACHE"] = "true"
+			}
+			result := android.GroupFixturePreparers(
+				PrepareForTestWithJavaDefaultModules,
+				android.FixtureMergeEnv(env),
+			).RunTestWithBp(t, bp)
+
+			foo := result.ModuleForTests("foo", "android_common")
+			lint := foo.Output("lint/lint-report.html")
+			sboxProto := android.RuleBuilderSboxProtoForTests(t, foo.Output("lint.sbox.textproto"))
+
+			classes := "out/soong/.intermediates/foo/android_common/javac/foo.jar"
+			if testCase.cached {
+				android.AssertIntEquals(t, "sandboxed inputs", 0, len(sboxProto.Commands[0].CopyBefore))
+				android.AssertStringListContains(t, "order-only inputs", lint.OrderOnly.Strings(), classes)
+				android.AssertStringDoesContain(t, "lint command", *sboxProto.Commands[0].Command, "foo/android_common/javac/foo.jar")
+			} else {
+				if len(sboxProto.Commands[0].CopyBefore) == 0 {
+					t.Error("expected lint inputs to be sandboxed")
+				}
+				android.AssertStringListContains(t, "implicit inputs", lint.Implicits.Strings(), classes)
+			}
+		})
+	}
+}
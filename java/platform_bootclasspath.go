@@ -362,6 +362,12 @@ func (b *platformBootclasspathModule) generateHiddenAPIBuildActions(ctx android.
 	indexCSV := hiddenAPISingletonPaths(ctx).index
 	b.buildRuleMergeCSV(ctx, "monolithic hidden API index", allIndexFlagFiles, indexCSV)
 
+	// Generate the manifest used by the explain_hiddenapi_flags tool to explain the flags of a
+	// member from the files above.
+	explainManifest := android.PathForOutput(ctx, "hiddenapi", "hiddenapi-explain.json")
+	buildRuleToGenerateHiddenAPIExplainManifest(ctx, explainManifest, stubFlags, allFlags, allAnnotationFlagFiles,
+		monolithicInfo.FlagsFilesByCategory, classpathElements)
+
 	return bootDexJarByModule
 }
 
@@ -356,3 +356,46 @@ func TestPlatformBootclasspath_HiddenAPIMonolithicFiles(t *testing.T) {
 		out/soong/.intermediates/myplatform-bootclasspath/android_common/hiddenapi-monolithic/index-from-classes.csv
 	`, rule)
 }
+
+func TestPlatformBootclasspath_HiddenAPIExplainManifest(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		hiddenApiFixtureFactory,
+		FixtureConfigureBootJars("platform:foo"),
+	).RunTestWithBp(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			compile_dex: true,
+		}
+
+		platform_bootclasspath {
+			name: "myplatform-bootclasspath",
+			hidden_api: {
+				blocked: ["blocked.txt"],
+				unsupported_packages: ["unsupported-packages.txt"],
+			},
+		}
+	`)
+
+	platformBootclasspath := result.ModuleForTests("myplatform-bootclasspath", "android_common")
+	rule := platformBootclasspath.Output("out/soong/hiddenapi/hiddenapi-explain.json")
+	manifest := android.StringRelativeToTop(result.Config, android.ContentFromFileRuleForTests(t, rule))
+
+	android.AssertStringDoesContain(t, "stub flags", manifest,
+		`"stub_flags": "out/soong/hiddenapi/hiddenapi-stub-flags.txt"`)
+	android.AssertStringDoesContain(t, "flags", manifest,
+		`"flags": "out/soong/hiddenapi/hiddenapi-flags.csv"`)
+	android.AssertStringDoesContain(t, "annotation flags", manifest,
+		`"out/soong/.intermediates/myplatform-bootclasspath/android_common/hiddenapi-monolithic/annotation-flags-from-classes.csv"`)
+	android.AssertStringDoesContain(t, "blocked flag file", manifest,
+		`"category": "blocked",
+      "path": "blocked.txt"`)
+	android.AssertStringDoesContain(t, "unsupported packages flag file", manifest,
+		`"category": "unsupported_packages",
+      "path": "unsupported-packages.txt"`)
+	android.AssertStringDoesContain(t, "module", manifest,
+		`"name": "foo",
+      "classes_jars": [
+        "out/soong/.intermediates/foo/android_common/javac/foo.jar"
+      ]`)
+}
@@ -49,4 +49,8 @@ type PluginProperties struct {
 	// This necessitates disabling the turbine optimization on modules that use this plugin, which will reduce
 	// parallelism and cause more recompilation for modules that depend on modules that use this plugin.
 	Generates_api *bool
+
+	// If true, the plugin is a Kotlin Symbol Processing (KSP) processor.  KSP processors are run
+	// with KSP instead of kapt, and can only be used by modules with kotlin sources.
+	Ksp *bool
 }
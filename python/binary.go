@@ -170,7 +170,7 @@ func (binary *binaryDecorator) bootstrapperProps() []interface{} {
 
 func (binary *binaryDecorator) bootstrap(ctx android.ModuleContext, actualVersion string,
 	embeddedLauncher bool, srcsPathMappings []pathMapping, srcsZip android.Path,
-	depsSrcsZips android.Paths) android.OptionalPath {
+	depsSrcsZips android.Paths, validations android.Paths) android.OptionalPath {
 
 	main := ""
 	if binary.autorun() {
@@ -192,7 +192,7 @@ func (binary *binaryDecorator) bootstrap(ctx android.ModuleContext, actualVersio
 
 	binFile := registerBuildActionForParFile(ctx, embeddedLauncher, launcherPath,
 		binary.getHostInterpreterName(ctx, actualVersion),
-		main, binary.getStem(ctx), append(android.Paths{srcsZip}, depsSrcsZips...))
+		main, binary.getStem(ctx), append(android.Paths{srcsZip}, depsSrcsZips...), validations)
 
 	return android.OptionalPathForPath(binFile)
 }
@@ -69,6 +69,15 @@ var (
 			CommandDeps: []string{"$mergeParCmd"},
 		},
 		"srcsZips", "launcher")
+
+	// The packages are listed as "<name>==<version>", a package bundled with two versions is
+	// listed twice.
+	mergePackagesManifests = pctx.AndroidStaticRule("mergePackagesManifests",
+		blueprint.RuleParams{
+			Command: `sort -u /dev/null $in > $out && ` +
+				`awk -F '==' 'seen[$$1]++ { print "$out: " $$1 " is bundled with different versions"; ` +
+				`status = 1 } END { exit status }' $out || (rm -f $out; exit 1)`,
+		})
 )
 
 func init() {
@@ -81,7 +90,7 @@ func init() {
 
 func registerBuildActionForParFile(ctx android.ModuleContext, embeddedLauncher bool,
 	launcherPath android.OptionalPath, interpreter, main, binName string,
-	srcsZips android.Paths) android.Path {
+	srcsZips android.Paths, validations android.Paths) android.Path {
 
 	// .intermediate output path for bin executable.
 	binFile := android.PathForModuleOut(ctx, binName)
@@ -102,6 +111,7 @@ func registerBuildActionForParFile(ctx android.ModuleContext, embeddedLauncher b
 			Description: "host python archive",
 			Output:      binFile,
 			Implicits:   implicits,
+			Validations: validations,
 			Args: map[string]string{
 				"interp":   strings.Replace(interpreter, "/", `\/`, -1),
 				"main":     strings.Replace(main, "/", `\/`, -1),
@@ -120,6 +130,7 @@ func registerBuildActionForParFile(ctx android.ModuleContext, embeddedLauncher b
 				Description: "embedded python archive",
 				Output:      binFile,
 				Implicits:   implicits,
+				Validations: validations,
 				Args: map[string]string{
 					"srcsZips": strings.Join(srcsZips.Strings(), " "),
 					"launcher": launcherPath.String(),
@@ -131,6 +142,7 @@ func registerBuildActionForParFile(ctx android.ModuleContext, embeddedLauncher b
 				Description: "embedded python archive",
 				Output:      binFile,
 				Implicits:   implicits,
+				Validations: validations,
 				Args: map[string]string{
 					"main":     strings.Replace(strings.TrimSuffix(main, pyExt), "/", ".", -1),
 					"srcsZips": strings.Join(srcsZips.Strings(), " "),
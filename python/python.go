@@ -96,6 +96,9 @@ type BaseProperties struct {
 	// list of the Python libraries compatible both with Python2 and Python3.
 	Libs []string `android:"arch_variant"`
 
+	// the type checking of the Python 3 sources of the module.
+	Typecheck TypecheckProperties
+
 	Version struct {
 		// Python2-specific properties, including whether Python2 is supported for this module
 		// and version-specific sources, exclusions and dependencies.
@@ -148,6 +151,10 @@ type Module struct {
 	// installer might be nil (e.g. Python library module).
 	installer installer
 
+	// the wheels of third-party packages bundled by the module, set by python_requirements
+	// modules.
+	requirements *requirementsDecorator
+
 	// the Python files of current module after expanding source dependencies.
 	// pathMapping: <dest: runfile_path, src: source_path>
 	srcsPathMappings []pathMapping
@@ -162,6 +169,19 @@ type Module struct {
 	// dependency modules' zip filepath for zipping current module source/data files.
 	depsSrcsZips android.Paths
 
+	// the list of the third-party packages bundled by the module, or by a binary and its
+	// dependencies.
+	packagesManifest android.Path
+
+	// dependency modules' lists of bundled third-party packages.
+	depsPackagesManifests android.Paths
+
+	// the diagnostics of the type checking of the module's sources, if enabled.
+	typecheckFile android.Path
+
+	// dependency modules' type checking diagnostics.
+	depsTypecheckFiles android.Paths
+
 	// (.intermediate) module output path as installation source.
 	installSource android.OptionalPath
 
@@ -182,7 +202,7 @@ type bootstrapper interface {
 	bootstrapperProps() []interface{}
 	bootstrap(ctx android.ModuleContext, ActualVersion string, embeddedLauncher bool,
 		srcsPathMappings []pathMapping, srcsZip android.Path,
-		depsSrcsZips android.Paths) android.OptionalPath
+		depsSrcsZips android.Paths, validations android.Paths) android.OptionalPath
 
 	autorun() bool
 }
@@ -199,6 +219,8 @@ type pythonDependency interface {
 	getSrcsPathMappings() []pathMapping
 	getDataPathMappings() []pathMapping
 	getSrcsZip() android.Path
+	getPackagesManifest() android.Path
+	getTypecheckFile() android.Path
 }
 
 // getSrcsPathMappings gets this module's path mapping of src source path : runfiles destination
@@ -216,6 +238,16 @@ func (p *Module) getSrcsZip() android.Path {
 	return p.srcsZip
 }
 
+// getPackagesManifest returns the list of the third-party packages bundled by this module, if any.
+func (p *Module) getPackagesManifest() android.Path {
+	return p.packagesManifest
+}
+
+// getTypecheckFile returns the diagnostics of the type checking of this module, if enabled.
+func (p *Module) getTypecheckFile() android.Path {
+	return p.typecheckFile
+}
+
 var _ pythonDependency = (*Module)(nil)
 
 var _ android.AndroidMkEntriesProvider = (*Module)(nil)
@@ -229,6 +261,9 @@ func (p *Module) init(additionalProps ...interface{}) android.Module {
 	if p.bootstrapper != nil {
 		p.AddProperties(p.bootstrapper.bootstrapperProps()...)
 	}
+	if p.requirements != nil {
+		p.AddProperties(&p.requirements.properties)
+	}
 
 	android.InitAndroidArchModule(p, p.hod, p.multilib)
 	android.InitDefaultableModule(p)
@@ -327,6 +362,11 @@ func (p *Module) OutputFiles(tag string) (android.Paths, error) {
 			return android.Paths{outputFile.Path()}, nil
 		}
 		return android.Paths{}, nil
+	case ".packages":
+		if p.packagesManifest != nil {
+			return android.Paths{p.packagesManifest}, nil
+		}
+		return android.Paths{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -426,6 +466,7 @@ func (p *Module) DepsMutator(ctx android.BottomUpMutatorContext) {
 
 func (p *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	p.generatePythonBuildActions(ctx)
+	p.typecheckFile = p.typecheck(ctx)
 
 	// Only Python binary and test modules have non-empty bootstrapper.
 	if p.bootstrapper != nil {
@@ -435,8 +476,17 @@ func (p *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		// bootstrap the module, including resolving main file, getting launcher path, and
 		// registering actions to build the par file
 		// bootstrap returns the binary output path
+		// the type checking of the module and its dependencies validates the par, without
+		// delaying it
+		var validations android.Paths
+		if p.typecheckFile != nil {
+			validations = append(validations, p.typecheckFile)
+		}
+		validations = append(validations, p.depsTypecheckFiles...)
 		p.installSource = p.bootstrapper.bootstrap(ctx, p.properties.Actual_version,
-			p.isEmbeddedLauncherEnabled(), p.srcsPathMappings, p.srcsZip, p.depsSrcsZips)
+			p.isEmbeddedLauncherEnabled(), p.srcsPathMappings, p.srcsZip, p.depsSrcsZips, validations)
+		// list the third-party packages bundled into the par
+		p.packagesManifest = p.mergePackagesManifests(ctx)
 	}
 
 	// Only Python binary and test modules have non-empty installer.
@@ -459,6 +509,15 @@ func (p *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 // generatePythonBuildActions performs build actions common to all Python modules
 func (p *Module) generatePythonBuildActions(ctx android.ModuleContext) {
+	// python_requirements modules bundle wheels instead of sources.
+	if p.requirements != nil {
+		if len(p.properties.Srcs) > 0 || len(p.properties.Data) > 0 {
+			ctx.ModuleErrorf("python_requirements can't have srcs or data, only wheels")
+		}
+		p.srcsZip, p.packagesManifest = p.requirements.unpackWheels(ctx)
+		return
+	}
+
 	expandedSrcs := android.PathsForModuleSrcExcludes(ctx, p.properties.Srcs, p.properties.Exclude_srcs)
 	requiresSrcs := true
 	if p.bootstrapper != nil && !p.bootstrapper.autorun() {
@@ -690,11 +749,30 @@ func (p *Module) collectPathsFromTransitiveDeps(ctx android.ModuleContext) {
 					path.dest, path.src.String(), ctx.ModuleName(), ctx.OtherModuleName(child))
 			}
 			p.depsSrcsZips = append(p.depsSrcsZips, dep.getSrcsZip())
+			if manifest := dep.getPackagesManifest(); manifest != nil {
+				p.depsPackagesManifests = append(p.depsPackagesManifests, manifest)
+			}
+			if typecheckFile := dep.getTypecheckFile(); typecheckFile != nil {
+				p.depsTypecheckFiles = append(p.depsTypecheckFiles, typecheckFile)
+			}
 		}
 		return true
 	})
 }
 
+// mergePackagesManifests registers build actions to list the third-party packages bundled by the
+// module's dependencies, failing if a package is bundled with different versions.
+func (p *Module) mergePackagesManifests(ctx android.ModuleContext) android.Path {
+	manifest := android.PathForModuleOut(ctx, ctx.ModuleName()+".packages.txt")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        mergePackagesManifests,
+		Description: "python packages manifest",
+		Output:      manifest,
+		Inputs:      p.depsPackagesManifests,
+	})
+	return manifest
+}
+
 // chckForDuplicateOutputPath checks whether outputPath has already been included in map m, which
 // would result in two files being placed in the same location.
 // If there is a duplicate path, an error is thrown and true is returned
@@ -378,3 +378,113 @@ func expectModule(t *testing.T, ctx *android.TestContext, name, variant, expecte
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+func TestPythonRequirements(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		android.PrepareForTestWithDefaults,
+		PrepareForTestWithPythonBuildComponents,
+		android.FixtureWithRootAndroidBp(`
+			python_requirements {
+				name: "py-requests",
+				lockfile: "requirements.txt",
+				wheels: ["wheels/*.whl"],
+			}
+
+			python_binary_host {
+				name: "bin",
+				srcs: ["bin.py"],
+				libs: ["py-requests"],
+			}`),
+		android.MockFS{
+			"requirements.txt": nil,
+			"wheels/certifi-2021.5.30-py2.py3-none-any.whl": nil,
+			"wheels/requests-2.26.0-py2.py3-none-any.whl":   nil,
+			"bin.py":         nil,
+			StubTemplateHost: nil,
+		}.AddToFixture(),
+	).RunTest(t)
+
+	requirements := result.ModuleForTests("py-requests", "PY3")
+	wheels := requirements.Rule("python_wheels")
+	android.AssertStringDoesContain(t, "python_wheels command", wheels.RuleParams.Command,
+		"--lockfile requirements.txt")
+	android.AssertPathsRelativeToTopEquals(t, "python_wheels outputs", []string{
+		"out/soong/.intermediates/py-requests/PY3/py-requests.packages.txt",
+		"out/soong/.intermediates/py-requests/PY3/py-requests.py.srcszip",
+	}, wheels.Outputs.Paths())
+	android.AssertStringListContains(t, "python_wheels inputs",
+		android.PathsRelativeToTop(wheels.Inputs), "wheels/requests-2.26.0-py2.py3-none-any.whl")
+
+	bin := result.ModuleForTests("bin", "PY3")
+	android.AssertPathsRelativeToTopEquals(t, "depsSrcsZips", []string{
+		"out/soong/.intermediates/py-requests/PY3/py-requests.py.srcszip",
+	}, bin.Module().(*Module).depsSrcsZips)
+
+	manifest := bin.Rule("mergePackagesManifests")
+	android.AssertPathRelativeToTopEquals(t, "packages manifest",
+		"out/soong/.intermediates/bin/PY3/bin.packages.txt", manifest.Output)
+	android.AssertPathsRelativeToTopEquals(t, "packages manifest inputs", []string{
+		"out/soong/.intermediates/py-requests/PY3/py-requests.packages.txt",
+	}, manifest.Inputs)
+}
+
+func TestPythonTypecheck(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		android.PrepareForTestWithDefaults,
+		PrepareForTestWithPythonBuildComponents,
+		android.FixtureWithRootAndroidBp(`
+			python_library_host {
+				name: "lib",
+				pkg_path: "a",
+				srcs: ["lib.py"],
+				typecheck: {
+					enabled: true,
+					strict: true,
+				},
+			}
+
+			python_library_host {
+				name: "lib_unchecked",
+				srcs: ["lib_unchecked.py"],
+			}
+
+			python_binary_host {
+				name: "bin",
+				srcs: ["bin.py"],
+				libs: ["lib", "lib_unchecked"],
+				typecheck: {
+					enabled: true,
+				},
+			}`),
+		android.MockFS{
+			"lib.py":           nil,
+			"lib_unchecked.py": nil,
+			"bin.py":           nil,
+			StubTemplateHost:   nil,
+		}.AddToFixture(),
+	).RunTest(t)
+
+	lib := result.ModuleForTests("lib", "PY3").Rule("python_typecheck")
+	android.AssertStringDoesContain(t, "lib typecheck command", lib.RuleParams.Command, "--strict")
+	android.AssertStringDoesContain(t, "lib typecheck command", lib.RuleParams.Command, " a/lib.py")
+	android.AssertPathRelativeToTopEquals(t, "lib typecheck output",
+		"out/soong/.intermediates/lib/PY3/lib.typecheck.json", lib.Output)
+
+	libUnchecked := result.ModuleForTests("lib_unchecked", "PY3")
+	if libUnchecked.MaybeRule("python_typecheck").Rule != nil {
+		t.Errorf("expected lib_unchecked not to be type checked")
+	}
+
+	bin := result.ModuleForTests("bin", "PY3")
+	binTypecheck := bin.Rule("python_typecheck")
+	android.AssertStringDoesNotContain(t, "bin typecheck command", binTypecheck.RuleParams.Command, "--strict")
+	android.AssertStringListContains(t, "bin typecheck inputs",
+		android.PathsRelativeToTop(binTypecheck.Inputs),
+		"out/soong/.intermediates/lib_unchecked/PY3/lib_unchecked.py.srcszip")
+
+	par := bin.Rule("hostPar")
+	android.AssertPathsRelativeToTopEquals(t, "par validations", []string{
+		"out/soong/.intermediates/bin/PY3/bin.typecheck.json",
+		"out/soong/.intermediates/lib/PY3/lib.typecheck.json",
+	}, par.Validations)
+}
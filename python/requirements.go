@@ -0,0 +1,86 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+// This file contains the module type for bundling third-party Python packages from wheels.
+
+import (
+	"android/soong/android"
+)
+
+func init() {
+	registerPythonRequirementsComponents(android.InitRegistrationContext)
+}
+
+func registerPythonRequirementsComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("python_requirements", PythonRequirementsFactory)
+}
+
+type RequirementsProperties struct {
+	// the lockfile pinning the version and the sha256 hashes of the wheels of each package, in
+	// the format written by pip-compile --generate-hashes.
+	Lockfile *string `android:"path"`
+
+	// the wheels of the packages pinned in the lockfile, checked into the tree. Each pinned
+	// package must have exactly one wheel matching its version and one of its hashes. Only pure
+	// Python wheels are supported.
+	Wheels []string `android:"path"`
+}
+
+type requirementsDecorator struct {
+	properties RequirementsProperties
+}
+
+// python_requirements verifies the wheels of third-party packages against a lockfile and unpacks
+// them, so that Python modules can use the packages through libs like a python_library. The
+// packages bundled into each Python binary are listed in its <name>.packages.txt output.
+func PythonRequirementsFactory() android.Module {
+	module := newModule(android.HostAndDeviceSupported, android.MultilibBoth)
+	module.requirements = &requirementsDecorator{}
+
+	return module.init()
+}
+
+// unpackWheels registers the build actions to verify and unpack the wheels, and returns the zip of
+// the unpacked packages and the manifest listing them.
+func (r *requirementsDecorator) unpackWheels(ctx android.ModuleContext) (android.Path, android.Path) {
+	if r.properties.Lockfile == nil {
+		ctx.PropertyErrorf("lockfile", "python_requirements requires a lockfile")
+		return nil, nil
+	}
+	lockfile := android.PathForModuleSrc(ctx, String(r.properties.Lockfile))
+	wheels := android.PathsForModuleSrc(ctx, r.properties.Wheels)
+
+	srcsZip := android.PathForModuleOut(ctx, ctx.ModuleName()+".py.srcszip")
+	manifest := android.PathForModuleOut(ctx, ctx.ModuleName()+".packages.txt")
+	outDir := android.PathForModuleOut(ctx, "wheels")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().Text("rm -rf").Flag(outDir.String())
+	rule.Command().BuiltTool("python_wheels").
+		FlagWithInput("--lockfile ", lockfile).
+		FlagWithArg("--output_dir ", outDir.String()).
+		FlagWithOutput("--manifest ", manifest).
+		Inputs(wheels)
+	rule.Command().
+		BuiltTool("soong_zip").
+		FlagWithOutput("-o ", srcsZip).
+		FlagWithArg("-C ", outDir.String()).
+		FlagWithArg("-D ", outDir.String())
+	rule.Command().Text("rm -rf").Flag(outDir.String())
+	rule.Build("python_wheels", "python wheels "+lockfile.Rel())
+
+	return srcsZip, manifest
+}
@@ -20,5 +20,6 @@ var PrepareForTestWithPythonBuildComponents = android.GroupFixturePreparers(
 	android.FixtureRegisterWithContext(registerPythonBinaryComponents),
 	android.FixtureRegisterWithContext(registerPythonLibraryComponents),
 	android.FixtureRegisterWithContext(registerPythonTestComponents),
+	android.FixtureRegisterWithContext(registerPythonRequirementsComponents),
 	android.FixtureRegisterWithContext(registerPythonMutators),
 )
@@ -0,0 +1,86 @@
+// Copyright 2021 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+// This file contains the build actions for type checking Python modules.
+
+import (
+	"android/soong/android"
+)
+
+// the properties of the type checking of a Python module.
+type TypecheckProperties struct {
+	// whether to type check the sources of the module with mypy. Defaults to false.
+	Enabled *bool
+
+	// whether to enable the strict checks of mypy, which also require the functions to be
+	// annotated. Defaults to false.
+	Strict *bool
+}
+
+// typecheck registers build actions to type check the Python sources of the module with mypy,
+// with the sources of its dependencies on the path, and returns the file the diagnostics are
+// written to, or nil if type checking is disabled. Binaries and tests run the type checking of
+// their sources and libraries as validations, and `m <module>` runs it for libraries.
+func (p *Module) typecheck(ctx android.ModuleContext) android.Path {
+	if !Bool(p.properties.Typecheck.Enabled) || p.srcsZip == nil {
+		return nil
+	}
+	// Recent versions of mypy can't check Python 2 sources.
+	if p.properties.Actual_version != pyVersion3 {
+		return nil
+	}
+
+	var files []string
+	for _, path := range p.srcsPathMappings {
+		if path.src.Ext() == pyExt {
+			files = append(files, path.dest)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	var depsZips android.Paths
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		if ctx.OtherModuleDependencyTag(child) != pythonLibTag {
+			return false
+		}
+		if dep, ok := child.(pythonDependency); ok && dep.getSrcsZip() != nil {
+			depsZips = append(depsZips, dep.getSrcsZip())
+			return true
+		}
+		return false
+	})
+	depsZips = android.FirstUniquePaths(depsZips)
+
+	diagnostics := android.PathForModuleOut(ctx, ctx.ModuleName()+".typecheck.json")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().BuiltTool("python_typecheck").
+		FlagWithInput("--mypy ", ctx.Config().HostToolPath(ctx, "mypy"))
+	if Bool(p.properties.Typecheck.Strict) {
+		cmd.Flag("--strict")
+	}
+	cmd.FlagWithInput("--srcs_zip ", p.srcsZip).
+		FlagForEachInput("--deps_zip ", depsZips).
+		FlagWithOutput("--output ", diagnostics).
+		Flags(files)
+	rule.Build("python_typecheck", "python typecheck "+ctx.ModuleName())
+
+	ctx.CheckbuildFile(diagnostics)
+
+	return diagnostics
+}
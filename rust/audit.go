@@ -0,0 +1,206 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"encoding/json"
+	"strings"
+
+	"android/soong/android"
+)
+
+// When RUST_AUDIT=true is set, m rust-audit writes rust-audit.json, which lists, for every rust binary and shared library, the
+// crates linked into it, with the module building each crate, its directory, whether it is a third
+// party crate from external/rust, and the number of unsafe blocks, functions, impls and traits in
+// its sources.  The sources of each crate are read from the dep-info file written by rustc, and
+// scanned by build/soong/scripts/rust_audit.py.
+//
+// When RUST_AUDIT_ALLOWLIST is also set to a file listing the crates allowed to contain unsafe
+// code, one "<crate_name> [<max unsafe count>]" per line, m rust-audit also fails if other crates
+// contain unsafe code.  The file can be anywhere, in or out of the source tree.
+
+func init() {
+	android.RegisterSingletonType("rust_audit", rustAuditSingletonFactory)
+}
+
+const rustAuditAllowlistEnv = "RUST_AUDIT_ALLOWLIST"
+
+func rustAuditEnabled(config android.Config) bool {
+	return config.IsEnvTrue("RUST_AUDIT")
+}
+
+// rustAuditCrate describes a crate in the manifest read by rust_audit.py.
+type rustAuditCrate struct {
+	CrateName string `json:"crate_name"`
+	Module    string `json:"module"`
+	Variant   string `json:"variant"`
+	Path      string `json:"path"`
+	External  bool   `json:"external"`
+	ProcMacro bool   `json:"proc_macro"`
+	Output    string `json:"output"`
+	DepInfo   string `json:"dep_info"`
+}
+
+// rustAuditBinary describes a binary or a shared library in the manifest, with the indexes of the
+// crates linked into it.
+type rustAuditBinary struct {
+	Module  string `json:"module"`
+	Variant string `json:"variant"`
+	Path    string `json:"path"`
+	Crates  []int  `json:"crates"`
+}
+
+type rustAuditManifest struct {
+	Crates   []rustAuditCrate  `json:"crates"`
+	Binaries []rustAuditBinary `json:"binaries"`
+}
+
+func rustAuditSingletonFactory() android.Singleton {
+	return &rustAuditSingleton{}
+}
+
+type rustAuditSingleton struct {
+	report android.WritablePath
+
+	manifest rustAuditManifest
+	// The index of each crate in the manifest.
+	crates map[*Module]int
+	// The outputs of the crates, which the dep-info files are written with.
+	outputs android.Paths
+}
+
+// isAuditedCrate returns whether the module builds a crate from source that can be linked into a
+// binary, or a proc macro used to build it.
+func isAuditedCrate(module *Module) bool {
+	if module.compiler == nil || !module.unstrippedOutputFile.Valid() || module.CrateName() == "" {
+		return false
+	}
+	switch module.compiler.(type) {
+	case *libraryDecorator, *procMacroDecorator:
+		return true
+	}
+	return false
+}
+
+// addCrate adds the crate built by the module to the manifest if needed and returns its index.
+func (s *rustAuditSingleton) addCrate(ctx android.SingletonContext, module *Module) int {
+	if idx, ok := s.crates[module]; ok {
+		return idx
+	}
+	_, procMacro := module.compiler.(*procMacroDecorator)
+	output := module.unstrippedOutputFile.Path()
+	dir := ctx.ModuleDir(module)
+	s.manifest.Crates = append(s.manifest.Crates, rustAuditCrate{
+		CrateName: module.CrateName(),
+		Module:    ctx.ModuleName(module),
+		Variant:   ctx.ModuleSubDir(module),
+		Path:      dir,
+		External:  dir == "external/rust" || strings.HasPrefix(dir, "external/rust/"),
+		ProcMacro: procMacro,
+		Output:    output.String(),
+		DepInfo:   output.String() + ".d.raw",
+	})
+	s.outputs = append(s.outputs, output)
+	idx := len(s.manifest.Crates) - 1
+	s.crates[module] = idx
+	return idx
+}
+
+// crateClosure returns the indexes of the crates built by the rust dependencies of the module,
+// transitively.
+func (s *rustAuditSingleton) crateClosure(ctx android.SingletonContext, module *Module) []int {
+	var closure []int
+	visited := make(map[*Module]bool)
+	var visit func(parent *Module)
+	visit = func(parent *Module) {
+		ctx.VisitDirectDeps(parent, func(child android.Module) {
+			dep, ok := child.(*Module)
+			// Skip the source variant of source providers, which is built by the module itself.
+			if !ok || visited[dep] || ctx.ModuleName(dep) == ctx.ModuleName(parent) {
+				return
+			}
+			visited[dep] = true
+			if !isAuditedCrate(dep) {
+				return
+			}
+			closure = append(closure, s.addCrate(ctx, dep))
+			visit(dep)
+		})
+	}
+	visit(module)
+	return closure
+}
+
+func (s *rustAuditSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !rustAuditEnabled(ctx.Config()) {
+		return
+	}
+
+	s.crates = make(map[*Module]int)
+
+	ctx.VisitAllModules(func(module android.Module) {
+		rModule, ok := module.(*Module)
+		if !ok || !rModule.Enabled() || rModule.compiler == nil || !rModule.unstrippedOutputFile.Valid() {
+			return
+		}
+		if !rModule.Binary() && !rModule.Shared() {
+			return
+		}
+		binary := rustAuditBinary{
+			Module:  ctx.ModuleName(rModule),
+			Variant: ctx.ModuleSubDir(rModule),
+			Path:    ctx.ModuleDir(rModule),
+		}
+		if rModule.CrateName() != "" {
+			binary.Crates = append(binary.Crates, s.addCrate(ctx, rModule))
+		}
+		binary.Crates = append(binary.Crates, s.crateClosure(ctx, rModule)...)
+		s.manifest.Binaries = append(s.manifest.Binaries, binary)
+	})
+
+	buf, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		ctx.Errorf("failed to marshal the rust audit manifest: %s", err)
+		return
+	}
+	manifest := android.PathForOutput(ctx, "rust-audit-manifest.json")
+	android.WriteFileRule(ctx, manifest, string(buf))
+
+	s.report = android.PathForOutput(ctx, "rust-audit.json")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	cmd := rule.Command().BuiltTool("rust_audit").
+		FlagWithInput("--manifest ", manifest).
+		FlagWithOutput("--output ", s.report).
+		Implicits(s.outputs)
+	outputs := android.Paths{s.report}
+	if allowlist := ctx.Config().Getenv(rustAuditAllowlistEnv); allowlist != "" {
+		timestamp := android.PathForOutput(ctx, "rust-audit.timestamp")
+		cmd.FlagWithInput("--allowlist ", android.PathForArbitraryInput(ctx, allowlist)).
+			FlagWithOutput("--check_output ", timestamp)
+		outputs = append(outputs, timestamp)
+	}
+	rule.Build("rust_audit", "audit rust crates")
+
+	ctx.Phony("rust-audit", outputs...)
+}
+
+func (s *rustAuditSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.report != nil {
+		ctx.DistForGoal("rust-audit", s.report)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*rustAuditSingleton)(nil)
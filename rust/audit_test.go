@@ -0,0 +1,126 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"encoding/json"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestRustAudit(t *testing.T) {
+	bp := `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			rustlibs: ["libfoo"],
+			proc_macros: ["libfoo_derive"],
+		}
+		rust_proc_macro {
+			name: "libfoo_derive",
+			srcs: ["foo.rs"],
+			crate_name: "foo_derive",
+		}`
+
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureAddTextFile("external/rust/crates/foo/Android.bp", `
+			rust_library_host {
+				name: "libfoo",
+				srcs: ["src/lib.rs"],
+				crate_name: "foo",
+			}`),
+		android.FixtureAddFile("external/rust/crates/foo/src/lib.rs", nil),
+		android.FixtureMergeEnv(map[string]string{
+			"RUST_AUDIT":          "true",
+			rustAuditAllowlistEnv: "/tmp/rust_audit_allowlist.txt",
+		}),
+	).RunTestWithBp(t, bp)
+
+	singleton := result.SingletonForTests("rust_audit")
+	var manifest rustAuditManifest
+	content := android.ContentFromFileRuleForTests(t, singleton.Output("rust-audit-manifest.json"))
+	if err := json.Unmarshal([]byte(content), &manifest); err != nil {
+		t.Fatalf("failed to parse the manifest: %s", err)
+	}
+
+	var binary *rustAuditBinary
+	for i := range manifest.Binaries {
+		if manifest.Binaries[i].Module == "fizz-buzz" {
+			binary = &manifest.Binaries[i]
+		}
+	}
+	if binary == nil {
+		t.Fatalf("fizz-buzz is missing from the manifest binaries")
+	}
+	android.AssertStringEquals(t, "binary variant", "linux_glibc_x86_64", binary.Variant)
+
+	crates := make(map[string]rustAuditCrate)
+	for _, idx := range binary.Crates {
+		crate := manifest.Crates[idx]
+		crates[crate.CrateName] = crate
+	}
+	for _, name := range []string{"fizz_buzz", "bar", "foo", "foo_derive"} {
+		if _, ok := crates[name]; !ok {
+			t.Errorf("crate %q is missing from the crates of fizz-buzz: %v", name, crates)
+		}
+	}
+
+	foo := crates["foo"]
+	android.AssertStringEquals(t, "foo module", "libfoo", foo.Module)
+	android.AssertStringEquals(t, "foo path", "external/rust/crates/foo", foo.Path)
+	android.AssertBoolEquals(t, "foo external", true, foo.External)
+	android.AssertStringEquals(t, "foo dep info", foo.Output+".d.raw", foo.DepInfo)
+	android.AssertBoolEquals(t, "bar external", false, crates["bar"].External)
+	android.AssertBoolEquals(t, "foo_derive proc macro", true, crates["foo_derive"].ProcMacro)
+
+	libfoo := result.ModuleForTests("libfoo", "linux_glibc_x86_64_rlib_rlib-std").Rule("rustc")
+	android.AssertStringEquals(t, "foo output", libfoo.Output.String(), foo.Output)
+	android.AssertStringListContains(t, "foo implicit outputs",
+		libfoo.ImplicitOutputs.Strings(), foo.DepInfo)
+
+	audit := singleton.Rule("rust_audit")
+	android.AssertStringListContains(t, "audit implicits",
+		android.PathsRelativeToTop(audit.Implicits), android.PathRelativeToTop(libfoo.Output))
+	android.AssertStringDoesContain(t, "audit command", audit.RuleParams.Command,
+		"--allowlist /tmp/rust_audit_allowlist.txt")
+	android.AssertPathsRelativeToTopEquals(t, "audit outputs",
+		[]string{"out/soong/rust-audit.json", "out/soong/rust-audit.timestamp"},
+		audit.Outputs.Paths())
+}
+
+func TestRustAuditDisabled(t *testing.T) {
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+	).RunTestWithBp(t, `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+		}`)
+
+	singleton := result.SingletonForTests("rust_audit")
+	if manifest := singleton.MaybeOutput("rust-audit-manifest.json"); manifest.Rule != nil {
+		t.Errorf("unexpected rust audit manifest without RUST_AUDIT")
+	}
+}
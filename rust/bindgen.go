@@ -46,15 +46,29 @@ var (
 		"${cc_config.ClangBase}/${config.HostPrebuiltTag}/${bindgenClangVersion}/lib64/")
 
 	//TODO(ivanlozano) Switch this to RuleBuilder
+	// The output is only replaced when its content changes, so that the crates using it are not
+	// rebuilt when a header changes without changing the bindings.
 	bindgen = pctx.AndroidStaticRule("bindgen",
 		blueprint.RuleParams{
 			Command: "CLANG_PATH=$bindgenClang LIBCLANG_PATH=$bindgenLibClang RUSTFMT=${config.RustBin}/rustfmt " +
-				"$cmd $flags $in -o $out -- -MD -MF $out.d $cflags",
+				"$cmd $flags $in -o $out.tmp -- -MD -MF $out.d $cflags && " +
+				"if ! cmp -s $out.tmp $out; then mv $out.tmp $out; else rm -f $out.tmp; fi",
 			CommandDeps: []string{"$cmd"},
 			Deps:        blueprint.DepsGCC,
 			Depfile:     "$out.d",
+			Restat:      true,
 		},
 		"cmd", "flags", "cflags")
+
+	_ = pctx.HostBinToolVariable("bindgenSymbolsCmd", "bindgen_symbols")
+
+	bindgenSymbols = pctx.AndroidStaticRule("bindgenSymbols",
+		blueprint.RuleParams{
+			Command: "${bindgenSymbolsCmd} --module $module --bindings $in --expected $expected " +
+				"--output $symbols && touch $out",
+			CommandDeps: []string{"${bindgenSymbolsCmd}"},
+		},
+		"module", "expected", "symbols")
 )
 
 func init() {
@@ -80,6 +94,14 @@ type BindgenProperties struct {
 	//
 	// "my_bindgen [flags] wrapper_header.h -o [output_path] -- [clang flags]"
 	Custom_bindgen string
+
+	// the list of the items that are expected in the generated bindings, one "<kind> <name>" per
+	// line, e.g. "fn foo_open" or "struct foo".  If set, the build fails when the bound functions,
+	// statics, types, constants and modules differ from the list, so that header changes that add
+	// or remove bound items are reviewed.  The list of the generated items is written next to the
+	// bindings to update the file.  Headers that bind different items on some architectures, e.g.
+	// __va_list_tag on x86_64, can set a different list for those architectures.
+	Expected_symbols *string `android:"path,arch_variant"`
 }
 
 type bindgenDecorator struct {
@@ -209,12 +231,18 @@ func (b *bindgenDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) andr
 		cmdDesc = "bindgen"
 	}
 
+	var validations android.Paths
+	if b.Properties.Expected_symbols != nil {
+		validations = append(validations, b.checkSymbols(ctx, outputFile))
+	}
+
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        bindgen,
 		Description: strings.Join([]string{cmdDesc, wrapperFile.Path().Rel()}, " "),
 		Output:      outputFile,
 		Input:       wrapperFile.Path(),
 		Implicits:   implicits,
+		Validations: validations,
 		Args: map[string]string{
 			"cmd":    cmd,
 			"flags":  strings.Join(bindgenFlags, " "),
@@ -226,6 +254,30 @@ func (b *bindgenDecorator) GenerateSource(ctx ModuleContext, deps PathDeps) andr
 	return outputFile
 }
 
+// checkSymbols builds a rule that compares the items bound in the generated bindings with the
+// expected_symbols list and returns its timestamp.  The check validates the generation of the
+// bindings, which it depends on.
+func (b *bindgenDecorator) checkSymbols(ctx ModuleContext, bindings android.Path) android.Path {
+	expected := android.PathForModuleSrc(ctx, String(b.Properties.Expected_symbols))
+	symbols := android.PathForModuleOut(ctx, b.BaseSourceProvider.getStem(ctx)+".symbols")
+	timestamp := android.PathForModuleOut(ctx, b.BaseSourceProvider.getStem(ctx)+".symbols.timestamp")
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:           bindgenSymbols,
+		Description:    "check bindgen symbols " + expected.Rel(),
+		Output:         timestamp,
+		ImplicitOutput: symbols,
+		Input:          bindings,
+		Implicit:       expected,
+		Args: map[string]string{
+			"module":   ctx.ModuleName(),
+			"expected": expected.String(),
+			"symbols":  symbols.String(),
+		},
+	})
+	return timestamp
+}
+
 func (b *bindgenDecorator) SourceProviderProps() []interface{} {
 	return append(b.BaseSourceProvider.SourceProviderProps(),
 		&b.Properties, &b.ClangProperties)
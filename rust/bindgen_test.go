@@ -168,3 +168,70 @@ func TestBindgenDisallowedFlags(t *testing.T) {
 		}
 	`)
 }
+
+func TestBindgenExpectedSymbols(t *testing.T) {
+	ctx := testRust(t, `
+		rust_bindgen {
+			name: "libbindgen",
+			wrapper_src: "src/any.h",
+			crate_name: "bindgen",
+			stem: "libbindgen",
+			source_stem: "bindings",
+			expected_symbols: "src/any.symbols",
+		}
+		rust_bindgen {
+			name: "libbindgen_unchecked",
+			wrapper_src: "src/any.h",
+			crate_name: "bindgen_unchecked",
+			stem: "libbindgen_unchecked",
+			source_stem: "bindings",
+		}
+	`)
+	module := ctx.ModuleForTests("libbindgen", "android_arm64_armv8-a_source")
+	bindings := module.Output("bindings.rs")
+	check := module.Output("bindings.symbols.timestamp")
+	if len(bindings.Validations) != 1 || bindings.Validations[0] != check.Output {
+		t.Errorf("expected the symbols check to validate the bindings, got %v", bindings.Validations)
+	}
+	if check.Input != bindings.Output {
+		t.Errorf("expected the symbols check to read %v, got %v", bindings.Output, check.Input)
+	}
+	if !strings.HasSuffix(check.Args["expected"], "src/any.symbols") {
+		t.Errorf("unexpected expected symbols list %q", check.Args["expected"])
+	}
+	if !strings.HasSuffix(check.Args["symbols"], "libbindgen/android_arm64_armv8-a_source/bindings.symbols") {
+		t.Errorf("unexpected generated symbols list %q", check.Args["symbols"])
+	}
+
+	unchecked := ctx.ModuleForTests("libbindgen_unchecked", "android_arm64_armv8-a_source").Output("bindings.rs")
+	if len(unchecked.Validations) != 0 {
+		t.Errorf("expected no validations without expected_symbols, got %v", unchecked.Validations)
+	}
+}
+
+func TestBindgenExpectedSymbolsArchVariant(t *testing.T) {
+	ctx := testRust(t, `
+		rust_bindgen {
+			name: "libbindgen",
+			wrapper_src: "src/any.h",
+			crate_name: "bindgen",
+			stem: "libbindgen",
+			source_stem: "bindings",
+			host_supported: true,
+			expected_symbols: "src/any.symbols",
+			arch: {
+				x86_64: {
+					expected_symbols: "src/any_x86_64.symbols",
+				},
+			},
+		}
+	`)
+	device := ctx.ModuleForTests("libbindgen", "android_arm64_armv8-a_source").Output("bindings.symbols.timestamp")
+	if !strings.HasSuffix(device.Args["expected"], "src/any.symbols") {
+		t.Errorf("unexpected expected symbols list for arm64 %q", device.Args["expected"])
+	}
+	host := ctx.ModuleForTests("libbindgen", "linux_glibc_x86_64_source").Output("bindings.symbols.timestamp")
+	if !strings.HasSuffix(host.Args["expected"], "src/any_x86_64.symbols") {
+		t.Errorf("unexpected expected symbols list for x86_64 %q", host.Args["expected"])
+	}
+}
@@ -28,7 +28,7 @@ var (
 	_     = pctx.SourcePathVariable("rustcCmd", "${config.RustBin}/rustc")
 	rustc = pctx.AndroidStaticRule("rustc",
 		blueprint.RuleParams{
-			Command: "$envVars $rustcCmd " +
+			Command: "$envVars $diagnosticsWrapper$rustcCmd " +
 				"-C linker=${config.RustLinker} " +
 				"-C link-args=\"${crtBegin} ${config.RustLinkerArgs} ${linkFlags} ${crtEnd}\" " +
 				"--emit link -o $out --emit dep-info=$out.d.raw $in ${libFlags} $rustcFlags" +
@@ -42,7 +42,7 @@ var (
 			Deps:    blueprint.DepsGCC,
 			Depfile: "$out.d",
 		},
-		"rustcFlags", "linkFlags", "libFlags", "crtBegin", "crtEnd", "envVars")
+		"rustcFlags", "linkFlags", "libFlags", "crtBegin", "crtEnd", "envVars", "diagnosticsWrapper")
 
 	_       = pctx.SourcePathVariable("rustdocCmd", "${config.RustBin}/rustdoc")
 	rustdoc = pctx.AndroidStaticRule("rustdoc",
@@ -53,10 +53,28 @@ var (
 		},
 		"rustdocFlags", "outDir", "envVars")
 
+	// The doctests are only compiled when the module is built, and persisted in $outDir/doctests
+	// to be run by the test runner. A doctest that doesn't compile, or a compile_fail doctest that
+	// does, fails the build. The list of the doctests is written to $outDir/doctests.list, which
+	// tells the runner which doctests are no_run, compile_fail or should_panic.
+	rustdocTest = pctx.AndroidStaticRule("rustdocTest",
+		blueprint.RuleParams{
+			Command: "rm -rf $outDir && mkdir -p $outDir/doctests && " +
+				"$envVars $rustdocCmd --test -Z unstable-options " +
+				"--persist-doctests $outDir/doctests --no-run " +
+				"-C linker=${config.RustLinker} " +
+				"-C link-args=\"${config.RustLinkerArgs} ${linkFlags}\" " +
+				"$rustdocFlags $in $libFlags && " +
+				"$envVars $rustdocCmd --test $rustdocFlags $in $libFlags -- --list > $outDir/doctests.list && " +
+				"${SoongZipCmd} -o $out -C $outDir -D $outDir",
+			CommandDeps: []string{"$rustdocCmd", "${SoongZipCmd}"},
+		},
+		"rustdocFlags", "linkFlags", "libFlags", "outDir", "envVars")
+
 	_            = pctx.SourcePathVariable("clippyCmd", "${config.RustBin}/clippy-driver")
 	clippyDriver = pctx.AndroidStaticRule("clippy",
 		blueprint.RuleParams{
-			Command: "$envVars $clippyCmd " +
+			Command: "$envVars $diagnosticsWrapper$clippyCmd " +
 				// Because clippy-driver uses rustc as backend, we need to have some output even during the linting.
 				// Use the metadata output as it has the smallest footprint.
 				"--emit metadata -o $out --emit dep-info=$out.d.raw $in ${libFlags} " +
@@ -66,7 +84,7 @@ var (
 			Deps:        blueprint.DepsGCC,
 			Depfile:     "$out.d",
 		},
-		"rustcFlags", "libFlags", "clippyFlags", "envVars")
+		"rustcFlags", "libFlags", "clippyFlags", "envVars", "diagnosticsWrapper")
 
 	zip = pctx.AndroidStaticRule("zip",
 		blueprint.RuleParams{
@@ -91,6 +109,7 @@ type buildOutput struct {
 
 func init() {
 	pctx.HostBinToolVariable("SoongZipCmd", "soong_zip")
+	pctx.HostBinToolVariable("RustDiagnosticsCmd", "rust_diagnostics")
 }
 
 func TransformSrcToBinary(ctx ModuleContext, mainSrc android.Path, deps PathDeps, flags Flags,
@@ -280,26 +299,52 @@ func transformSrctoCrate(ctx ModuleContext, main android.Path, deps PathDeps, fl
 		}
 	}
 
+	// When the diagnostics are collected, they are written by clippy if it runs, as it reports
+	// the rustc diagnostics as well, or by rustc otherwise.
+	var diagnostics android.WritablePath
+	if rustDiagnosticsEnabled(ctx.Config()) {
+		diagnostics = android.PathForModuleOut(ctx, outputFile.Base()+".diagnostics.json")
+		ctx.RustModule().diagnosticsFile = android.OptionalPathForPath(diagnostics)
+	}
+
 	if flags.Clippy {
 		clippyFile := android.PathForModuleOut(ctx, outputFile.Base()+".clippy")
+		clippyImplicits := implicits
+		var clippyImplicitOutputs android.WritablePaths
+		diagnosticsWrapper := ""
+		if diagnostics != nil {
+			clippyImplicits, clippyImplicitOutputs, diagnosticsWrapper = diagnosticsWrapperArgs(ctx, implicits, diagnostics)
+		}
 		ctx.Build(pctx, android.BuildParams{
 			Rule:            clippyDriver,
 			Description:     "clippy " + main.Rel(),
 			Output:          clippyFile,
-			ImplicitOutputs: nil,
+			ImplicitOutputs: clippyImplicitOutputs,
 			Inputs:          inputs,
-			Implicits:       implicits,
+			Implicits:       clippyImplicits,
 			Args: map[string]string{
-				"rustcFlags":  strings.Join(rustcFlags, " "),
-				"libFlags":    strings.Join(libFlags, " "),
-				"clippyFlags": strings.Join(flags.ClippyFlags, " "),
-				"envVars":     strings.Join(envVars, " "),
+				"rustcFlags":         strings.Join(rustcFlags, " "),
+				"libFlags":           strings.Join(libFlags, " "),
+				"clippyFlags":        strings.Join(flags.ClippyFlags, " "),
+				"envVars":            strings.Join(envVars, " "),
+				"diagnosticsWrapper": diagnosticsWrapper,
 			},
 		})
 		// Declare the clippy build as an implicit dependency of the original crate.
 		implicits = append(implicits, clippyFile)
 	}
 
+	diagnosticsWrapper := ""
+	if diagnostics != nil && !flags.Clippy {
+		var diagnosticsOutputs android.WritablePaths
+		implicits, diagnosticsOutputs, diagnosticsWrapper = diagnosticsWrapperArgs(ctx, implicits, diagnostics)
+		implicitOutputs = append(implicitOutputs, diagnosticsOutputs...)
+	}
+
+	// rustc also writes the full dep-info of the crate, which m rust-audit reads to find the
+	// sources of the crate.
+	implicitOutputs = append(implicitOutputs, android.PathForModuleOut(ctx, outputFile.Base()+".d.raw"))
+
 	ctx.Build(pctx, android.BuildParams{
 		Rule:            rustc,
 		Description:     "rustc " + main.Rel(),
@@ -307,19 +352,68 @@ func transformSrctoCrate(ctx ModuleContext, main android.Path, deps PathDeps, fl
 		ImplicitOutputs: implicitOutputs,
 		Inputs:          inputs,
 		Implicits:       implicits,
+		Validations:     deps.validations,
 		Args: map[string]string{
-			"rustcFlags": strings.Join(rustcFlags, " "),
-			"linkFlags":  strings.Join(linkFlags, " "),
-			"libFlags":   strings.Join(libFlags, " "),
-			"crtBegin":   deps.CrtBegin.String(),
-			"crtEnd":     deps.CrtEnd.String(),
-			"envVars":    strings.Join(envVars, " "),
+			"rustcFlags":         strings.Join(rustcFlags, " "),
+			"linkFlags":          strings.Join(linkFlags, " "),
+			"libFlags":           strings.Join(libFlags, " "),
+			"crtBegin":           deps.CrtBegin.String(),
+			"crtEnd":             deps.CrtEnd.String(),
+			"envVars":            strings.Join(envVars, " "),
+			"diagnosticsWrapper": diagnosticsWrapper,
 		},
 	})
 
 	return output
 }
 
+// TransformDoctests compiles the doctests of a crate against its rlib and zips them, with the list
+// of the doctests, in outputFile.
+func TransformDoctests(ctx ModuleContext, main android.Path, rlib android.Path, deps PathDeps,
+	flags Flags, outputFile android.WritablePath) {
+
+	rustdocFlags := append([]string{}, flags.RustdocFlags...)
+	rustdocFlags = append(rustdocFlags, "--sysroot=/dev/null")
+
+	if targetTriple := ctx.toolchain().RustTriple(); targetTriple != "" {
+		rustdocFlags = append(rustdocFlags, "--target="+targetTriple)
+	}
+
+	crateName := ctx.RustModule().CrateName()
+	rustdocFlags = append(rustdocFlags, "--crate-name "+crateName)
+	rustdocFlags = append(rustdocFlags, deps.depFlags...)
+
+	libFlags := makeLibFlags(deps)
+	libFlags = append(libFlags, "--extern "+crateName+"="+rlib.String())
+
+	var linkFlags []string
+	linkFlags = append(linkFlags, flags.GlobalLinkFlags...)
+	linkFlags = append(linkFlags, flags.LinkFlags...)
+
+	var implicits android.Paths
+	implicits = append(implicits, rlib)
+	implicits = append(implicits, rustLibsToPaths(deps.RLibs)...)
+	implicits = append(implicits, rustLibsToPaths(deps.DyLibs)...)
+	implicits = append(implicits, rustLibsToPaths(deps.ProcMacros)...)
+	implicits = append(implicits, deps.StaticLibs...)
+	implicits = append(implicits, deps.SharedLibDeps...)
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        rustdocTest,
+		Description: "rustdoc --test " + main.Rel(),
+		Output:      outputFile,
+		Input:       main,
+		Implicits:   implicits,
+		Args: map[string]string{
+			"rustdocFlags": strings.Join(rustdocFlags, " "),
+			"linkFlags":    strings.Join(linkFlags, " "),
+			"libFlags":     strings.Join(libFlags, " "),
+			"outDir":       android.PathForModuleOut(ctx, "doctests").String(),
+			"envVars":      strings.Join(rustEnvVars(ctx, deps), " "),
+		},
+	})
+}
+
 func Rustdoc(ctx ModuleContext, main android.Path, deps PathDeps,
 	flags Flags) android.ModuleOutPath {
 
@@ -22,6 +22,7 @@ import (
 	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
+	"android/soong/bloaty"
 	"android/soong/rust/config"
 )
 
@@ -133,6 +134,17 @@ type BaseCompilerProperties struct {
 	// list of configuration options to enable for this crate. To enable features, use the "features" property.
 	Cfgs []string `android:"arch_variant"`
 
+	// list of features of the dependencies of this crate that it relies on, in the form
+	// <crate_name>:<feature>. Each of these features must be enabled on the dependency in every
+	// binary or shared library that includes this crate.
+	Dep_features []string `android:"arch_variant"`
+
+	// whether the features and cfgs of this crate must match those of the other modules building
+	// a crate with the same crate_name in every binary or shared library that includes it. Set it
+	// to false on a separate version of a crate that is linked next to another version of the
+	// crate. Defaults to true.
+	Unify_features *bool
+
 	// specific rust edition that should be used if the default version is not desired
 	Edition *string `android:"arch_variant"`
 
@@ -166,6 +178,9 @@ type BaseCompilerProperties struct {
 
 	// If cargo_env_compat is true, sets the CARGO_PKG_VERSION env var to this value.
 	Cargo_pkg_version *string
+
+	// Maximum section sizes of the binary or shared library, verified with bloaty when it is built.
+	Size_budget bloaty.SizeBudget `android:"arch_variant"`
 }
 
 type baseCompiler struct {
@@ -189,6 +204,20 @@ type baseCompiler struct {
 	cargoOutDir android.ModuleOutPath
 }
 
+// sizeBudgetValidations returns the validation checking the section sizes of the output file
+// named fileName against the size_budget property. If stripped is true, the stripped output file
+// is checked as it is the one being installed.
+func (compiler *baseCompiler) sizeBudgetValidations(ctx ModuleContext, fileName string, stripped bool) android.Paths {
+	outputFile := android.PathForModuleOut(ctx, fileName)
+	if stripped {
+		outputFile = android.PathForModuleOut(ctx, "stripped", fileName)
+	}
+	if check := bloaty.CheckSizeBudget(ctx, outputFile, compiler.Properties.Size_budget); check != nil {
+		return android.Paths{check}
+	}
+	return nil
+}
+
 func (compiler *baseCompiler) Disabled() bool {
 	return false
 }
@@ -379,6 +408,22 @@ func (compiler *baseCompiler) crateName() string {
 	return compiler.Properties.Crate_name
 }
 
+func (compiler *baseCompiler) features() []string {
+	return compiler.Properties.Features
+}
+
+func (compiler *baseCompiler) cfgs() []string {
+	return compiler.Properties.Cfgs
+}
+
+func (compiler *baseCompiler) depFeatures() []string {
+	return compiler.Properties.Dep_features
+}
+
+func (compiler *baseCompiler) unifyFeatures() bool {
+	return proptools.BoolDefault(compiler.Properties.Unify_features, true)
+}
+
 func (compiler *baseCompiler) everInstallable() bool {
 	// Most modules are installable, so return true by default.
 	return true
@@ -419,6 +464,11 @@ func (compiler *baseCompiler) install(ctx ModuleContext) {
 	compiler.path = ctx.InstallFile(compiler.installDir(ctx), path.Path().Base(), path.Path())
 }
 
+// installedPath returns the path the module was installed to by install.
+func (compiler *baseCompiler) installedPath() android.InstallPath {
+	return compiler.path
+}
+
 func (compiler *baseCompiler) getStem(ctx ModuleContext) string {
 	return compiler.getStemWithoutSuffix(ctx) + String(compiler.Properties.Suffix)
 }
@@ -45,6 +45,7 @@ var (
 		"rust_benchmark_host",
 		"rust_binary",
 		"rust_binary_host",
+		"rust_doctest_host",
 		"rust_library",
 		"rust_library_dylib",
 		"rust_library_rlib",
@@ -0,0 +1,92 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"android/soong/android"
+)
+
+// When RUST_DIAGNOSTICS=true is set, rustc, or clippy-driver for the modules that run clippy, is
+// run through build/soong/scripts/rust_diagnostics.py, which passes --error-format=json to the
+// compiler, writes the diagnostics of each crate to <output>.diagnostics.json and prints them to
+// the build log as usual.  m rust-diagnostics aggregates the diagnostics of all the crates into
+// a SARIF report, rust-diagnostics.sarif, and extracts their machine applicable suggestions into
+// rust-fixes.json, which can be applied to the sources with rust_apply_fixes.
+
+func init() {
+	android.RegisterSingletonType("rust_diagnostics", rustDiagnosticsSingletonFactory)
+}
+
+func rustDiagnosticsEnabled(config android.Config) bool {
+	return config.IsEnvTrue("RUST_DIAGNOSTICS")
+}
+
+// diagnosticsWrapperArgs returns the implicits, implicit outputs and diagnosticsWrapper argument
+// of a rustc or clippy rule writing its diagnostics to the given file.
+func diagnosticsWrapperArgs(ctx ModuleContext, implicits android.Paths,
+	diagnostics android.WritablePath) (android.Paths, android.WritablePaths, string) {
+
+	wrapper := ctx.Config().HostToolPath(ctx, "rust_diagnostics")
+	implicits = append(android.Paths{wrapper}, implicits...)
+	return implicits, android.WritablePaths{diagnostics},
+		"${RustDiagnosticsCmd} run --output " + diagnostics.String() + " -- "
+}
+
+func rustDiagnosticsSingletonFactory() android.Singleton {
+	return &rustDiagnosticsSingleton{}
+}
+
+type rustDiagnosticsSingleton struct {
+	sarif android.WritablePath
+	fixes android.WritablePath
+}
+
+func (s *rustDiagnosticsSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !rustDiagnosticsEnabled(ctx.Config()) {
+		return
+	}
+
+	var diagnostics android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled() {
+			return
+		}
+		if m, ok := module.(*Module); ok && m.diagnosticsFile.Valid() {
+			diagnostics = append(diagnostics, m.diagnosticsFile.Path())
+		}
+	})
+
+	s.sarif = android.PathForOutput(ctx, "rust-diagnostics.sarif")
+	s.fixes = android.PathForOutput(ctx, "rust-fixes.json")
+	rspFile := android.PathForOutput(ctx, "rust-diagnostics.rsp")
+
+	rule := android.NewRuleBuilder(pctx, ctx)
+	rule.Command().BuiltTool("rust_diagnostics").
+		Text("report").
+		FlagWithOutput("--sarif ", s.sarif).
+		FlagWithOutput("--fixes ", s.fixes).
+		FlagWithRspFileInputList("@", rspFile, diagnostics)
+	rule.Build("rust_diagnostics", "aggregate rust diagnostics")
+
+	ctx.Phony("rust-diagnostics", s.sarif, s.fixes)
+}
+
+func (s *rustDiagnosticsSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if s.sarif != nil {
+		ctx.DistForGoal("rust-diagnostics", s.sarif, s.fixes)
+	}
+}
+
+var _ android.SingletonMakeVarsProvider = (*rustDiagnosticsSingleton)(nil)
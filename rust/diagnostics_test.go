@@ -0,0 +1,82 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestDiagnostics(t *testing.T) {
+	bp := `
+		rust_library {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+		}
+		rust_library {
+			name: "libfoobar",
+			srcs: ["foo.rs"],
+			crate_name: "foobar",
+			clippy_lints: "none",
+		}`
+
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		android.FixtureMergeEnv(map[string]string{"RUST_DIAGNOSTICS": "true"}),
+	).RunTestWithBp(t, bp)
+
+	// libfoo runs clippy, which writes the diagnostics.
+	libfoo := result.ModuleForTests("libfoo", "android_arm64_armv8-a_dylib")
+	clippy := libfoo.Rule("clippy")
+	android.AssertStringEquals(t, "libfoo clippy diagnosticsWrapper",
+		"${RustDiagnosticsCmd} run --output out/soong/.intermediates/libfoo/android_arm64_armv8-a_dylib/libfoo.dylib.so.diagnostics.json -- ",
+		android.StringRelativeToTop(result.Config, clippy.Args["diagnosticsWrapper"]))
+	android.AssertStringEquals(t, "libfoo rustc diagnosticsWrapper", "",
+		libfoo.Rule("rustc").Args["diagnosticsWrapper"])
+
+	// libfoobar doesn't run clippy, rustc writes the diagnostics.
+	libfoobar := result.ModuleForTests("libfoobar", "android_arm64_armv8-a_dylib")
+	rustc := libfoobar.Rule("rustc")
+	android.AssertStringDoesContain(t, "libfoobar rustc diagnosticsWrapper",
+		rustc.Args["diagnosticsWrapper"], "${RustDiagnosticsCmd} run --output ")
+	android.AssertPathsRelativeToTopEquals(t, "libfoobar rustc implicit outputs",
+		[]string{"out/soong/.intermediates/libfoobar/android_arm64_armv8-a_dylib/libfoobar.dylib.so.diagnostics.json"},
+		rustc.ImplicitOutputs.Paths())
+
+	report := result.SingletonForTests("rust_diagnostics").Rule("rust_diagnostics")
+	reportInputs := android.PathsRelativeToTop(report.Inputs)
+	android.AssertStringListContains(t, "report inputs", reportInputs,
+		"out/soong/.intermediates/libfoo/android_arm64_armv8-a_dylib/libfoo.dylib.so.diagnostics.json")
+	android.AssertStringListContains(t, "report inputs", reportInputs,
+		"out/soong/.intermediates/libfoobar/android_arm64_armv8-a_dylib/libfoobar.dylib.so.diagnostics.json")
+	android.AssertPathsRelativeToTopEquals(t, "report outputs",
+		[]string{"out/soong/rust-diagnostics.sarif", "out/soong/rust-fixes.json"},
+		report.Outputs.Paths())
+}
+
+func TestDiagnosticsDisabled(t *testing.T) {
+	ctx := testRust(t, `
+		rust_library {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+		}`)
+
+	libfoo := ctx.ModuleForTests("libfoo", "android_arm64_armv8-a_dylib")
+	android.AssertStringEquals(t, "clippy diagnosticsWrapper", "", libfoo.Rule("clippy").Args["diagnosticsWrapper"])
+	android.AssertStringEquals(t, "rustc diagnosticsWrapper", "", libfoo.Rule("rustc").Args["diagnosticsWrapper"])
+}
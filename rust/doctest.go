@@ -0,0 +1,98 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"android/soong/android"
+)
+
+func init() {
+	android.RegisterModuleType("rust_doctest_host", RustDoctestHostFactory)
+}
+
+// A doctest module builds the crate in srcs as a library and compiles the documentation tests of
+// the crate against it with rustdoc --test, using the same dependencies, cfgs and features.  The
+// compiled doctests are installed, zipped, with a runner script that runs them and reports the
+// results like the Rust test harness.  It is usually defined along with the rust_library of the
+// crate, sharing its properties through rust_defaults.
+type doctestDecorator struct {
+	*testDecorator
+
+	doctestsZip android.Path
+}
+
+func NewRustDoctest(hod android.HostOrDeviceSupported) (*Module, *doctestDecorator) {
+	module, test := NewRustTest(hod)
+
+	doctest := &doctestDecorator{
+		testDecorator: test,
+	}
+
+	module.compiler = doctest
+	return module, doctest
+}
+
+// rust_doctest_host runs the documentation tests of a crate.
+func RustDoctestHostFactory() android.Module {
+	module, _ := NewRustDoctest(android.HostSupported)
+	return module.Init()
+}
+
+func (doctest *doctestDecorator) compilerFlags(ctx ModuleContext, flags Flags) Flags {
+	// The crate is built as a library, not as a test.
+	return doctest.binaryDecorator.compilerFlags(ctx, flags)
+}
+
+func (doctest *doctestDecorator) compile(ctx ModuleContext, flags Flags, deps PathDeps) android.Path {
+	fileName := doctest.getStem(ctx) + ctx.toolchain().ExecutableSuffix()
+	outputFile := android.PathForModuleOut(ctx, fileName)
+
+	crateName := ctx.RustModule().CrateName()
+	if crateName == "" {
+		ctx.PropertyErrorf("crate_name", "crate_name must be set to run the doctests of the crate")
+		return outputFile
+	}
+
+	srcPath, _ := srcPathFromModuleSrcs(ctx, doctest.baseCompiler.Properties.Srcs)
+
+	flags.RustFlags = append(flags.RustFlags, deps.depFlags...)
+	flags.LinkFlags = append(flags.LinkFlags, deps.depLinkFlags...)
+	flags.LinkFlags = append(flags.LinkFlags, deps.linkObjects...)
+
+	rlib := android.PathForModuleOut(ctx, "lib"+crateName+".rlib")
+	TransformSrctoRlib(ctx, srcPath, deps, flags, rlib)
+
+	doctestsZip := android.PathForModuleOut(ctx, fileName+".doctests.zip")
+	TransformDoctests(ctx, srcPath, rlib, deps, flags, doctestsZip)
+	doctest.doctestsZip = doctestsZip
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        android.CpExecutable,
+		Description: "doctest runner",
+		Input:       android.PathForSource(ctx, "build/soong/scripts/rust_doctest_runner.sh"),
+		Output:      outputFile,
+		Implicit:    doctestsZip,
+	})
+
+	return outputFile
+}
+
+func (doctest *doctestDecorator) install(ctx ModuleContext) {
+	doctest.testDecorator.install(ctx)
+	// The runner expects the compiled doctests next to it.
+	if doctest.doctestsZip != nil {
+		doctest.data = append(doctest.data, android.DataPath{SrcPath: doctest.doctestsZip})
+	}
+}
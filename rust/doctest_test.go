@@ -0,0 +1,74 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestRustDoctest(t *testing.T) {
+	ctx := testRust(t, `
+		rust_doctest_host {
+			name: "libfoo_doctests",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz"],
+			rustlibs: ["libbar"],
+			test_suites: ["general-tests"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+		}`)
+
+	module := ctx.ModuleForTests("libfoo_doctests", "linux_glibc_x86_64")
+
+	// The crate is built as a library, without the test harness.
+	rustc := module.Rule("rustc")
+	android.AssertStringEquals(t, "rlib output", "libfoo.rlib", rustc.Output.Base())
+	android.AssertStringDoesContain(t, "rustc flags", rustc.Args["rustcFlags"], "--crate-type=rlib")
+	android.AssertStringDoesNotContain(t, "rustc flags", rustc.Args["rustcFlags"], "--test")
+
+	doctests := module.Rule("rustdocTest")
+	android.AssertStringEquals(t, "doctests output", "libfoo_doctests.doctests.zip", doctests.Output.Base())
+	android.AssertStringDoesContain(t, "rustdoc flags", doctests.Args["rustdocFlags"], "--cfg 'feature=\"fizz\"'")
+	android.AssertStringDoesContain(t, "rustdoc flags", doctests.Args["rustdocFlags"], "--crate-name foo")
+	android.AssertStringDoesContain(t, "lib flags", doctests.Args["libFlags"], "--extern bar=")
+	android.AssertStringDoesContain(t, "lib flags", doctests.Args["libFlags"], "--extern foo="+rustc.Output.String())
+
+	runner := module.Output("libfoo_doctests")
+	android.AssertPathRelativeToTopEquals(t, "runner input",
+		"build/soong/scripts/rust_doctest_runner.sh", runner.Input)
+
+	doctest := module.Module().(*Module).compiler.(*doctestDecorator)
+	data := doctest.dataPaths()
+	if len(data) != 1 || data[0].SrcPath != doctests.Output {
+		t.Errorf("expected the doctests zip as test data, got %v", data)
+	}
+	if doctest.testConfig == nil {
+		t.Errorf("expected a test config to be generated")
+	}
+}
+
+func TestRustDoctestCrateName(t *testing.T) {
+	testRustError(t, "crate_name must be set to run the doctests of the crate", `
+		rust_doctest_host {
+			name: "libfoo_doctests",
+			srcs: ["foo.rs"],
+		}`)
+}
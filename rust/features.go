@@ -0,0 +1,170 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"sort"
+	"strings"
+
+	"android/soong/android"
+)
+
+// Unlike Cargo, Soong doesn't unify the features of a crate across the dependency graph: each
+// module passes its features and cfgs to rustc as they are. featureUnificationMutator checks that
+// every crate linked into a binary or a shared library is built with a single set of features and
+// cfgs, and that the features the crates rely on through their dep_features property are enabled.
+// A module with unify_features: false is a separate version of its crate, and is checked on its
+// own.
+
+// crateFeatures records which modules build a crate with which features and cfgs.
+type crateFeatures struct {
+	crateName string
+	// The modules building the crate, in the order they were found.
+	modules []string
+	// The features and the cfgs enabled by each module.
+	features map[string][]string
+	cfgs     map[string][]string
+}
+
+func featureUnificationMutator(mctx android.BottomUpMutatorContext) {
+	mod, ok := mctx.Module().(*Module)
+	if !ok || mod.compiler == nil || !mod.Enabled() {
+		return
+	}
+	if !mod.Binary() && !mod.Shared() && !mod.Dylib() {
+		return
+	}
+
+	crates := make(map[string]*crateFeatures)
+	var order []*Module
+	// The rust dependencies of each module in the closure.
+	deps := make(map[*Module][]*Module)
+
+	add := func(m *Module, name string) {
+		crateName := m.CrateName()
+		if crateName == "" {
+			return
+		}
+		key := crateName
+		if !m.compiler.unifyFeatures() {
+			key = crateName + " " + name
+		}
+		crate := crates[key]
+		if crate == nil {
+			crate = &crateFeatures{
+				crateName: crateName,
+				features:  make(map[string][]string),
+				cfgs:      make(map[string][]string),
+			}
+			crates[key] = crate
+		}
+		if _, exists := crate.features[name]; !exists {
+			crate.modules = append(crate.modules, name)
+			crate.features[name] = android.SortedUniqueStrings(m.compiler.features())
+			crate.cfgs[name] = android.SortedUniqueStrings(m.compiler.cfgs())
+			order = append(order, m)
+		}
+	}
+
+	add(mod, mctx.ModuleName())
+	mctx.WalkDeps(func(child, parent android.Module) bool {
+		depTag := mctx.OtherModuleDependencyTag(child)
+		// Proc macros run in the compiler and are built separately from the crates they're used by.
+		if depTag != rlibDepTag && depTag != dylibDepTag {
+			return false
+		}
+		dep, ok := child.(*Module)
+		if !ok || dep.compiler == nil {
+			return false
+		}
+		if p, ok := parent.(*Module); ok {
+			deps[p] = append(deps[p], dep)
+		}
+		add(dep, mctx.OtherModuleName(child))
+		return true
+	})
+
+	for _, key := range android.SortedStringKeys(crates) {
+		crate := crates[key]
+		if len(crate.modules) < 2 {
+			continue
+		}
+		// Report each feature and cfg that isn't enabled by all the modules building the crate.
+		for _, feature := range allValues(crate.features) {
+			enabled, disabled := crate.modulesWith(crate.features, feature)
+			if len(disabled) > 0 {
+				mctx.ModuleErrorf("crate %q is built with inconsistent features in the dependencies of this module: "+
+					"feature %q is enabled by %s but not by %s",
+					crate.crateName, feature, strings.Join(enabled, ", "), strings.Join(disabled, ", "))
+			}
+		}
+		for _, cfg := range allValues(crate.cfgs) {
+			enabled, disabled := crate.modulesWith(crate.cfgs, cfg)
+			if len(disabled) > 0 {
+				mctx.ModuleErrorf("crate %q is built with inconsistent cfgs in the dependencies of this module: "+
+					"cfg %q is set by %s but not by %s",
+					crate.crateName, cfg, strings.Join(enabled, ", "), strings.Join(disabled, ", "))
+			}
+		}
+	}
+
+	for _, m := range order {
+		for _, depFeature := range m.compiler.depFeatures() {
+			split := strings.SplitN(depFeature, ":", 2)
+			if len(split) != 2 || split[0] == "" || split[1] == "" {
+				mctx.ModuleErrorf("dep_features of %q: %q must be in the form <crate_name>:<feature>",
+					mctx.OtherModuleName(m), depFeature)
+				continue
+			}
+			// Check the dependencies of the module, as another version of the crate may be
+			// linked next to it.  A missing dependency is reported when the crate is built.
+			var disabled []string
+			for _, dep := range deps[m] {
+				if dep.CrateName() == split[0] && !android.InList(split[1], dep.compiler.features()) {
+					disabled = append(disabled, mctx.OtherModuleName(dep))
+				}
+			}
+			if len(disabled) > 0 {
+				mctx.ModuleErrorf("%q relies on feature %q of crate %q, which is not enabled by %s",
+					mctx.OtherModuleName(m), split[1], split[0],
+					strings.Join(android.SortedUniqueStrings(disabled), ", "))
+			}
+		}
+	}
+}
+
+// allValues returns the features or the cfgs enabled by any of the modules building a crate.
+func allValues(values map[string][]string) []string {
+	var all []string
+	for _, v := range values {
+		all = append(all, v...)
+	}
+	return android.SortedUniqueStrings(all)
+}
+
+// modulesWith returns the modules building the crate that enable and don't enable a feature or a
+// cfg.
+func (c *crateFeatures) modulesWith(values map[string][]string, value string) (enabled, disabled []string) {
+	for _, name := range c.modules {
+		if android.InList(value, values[name]) {
+			enabled = append(enabled, name)
+		} else {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	sort.Strings(disabled)
+	return enabled, disabled
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 The Android Open Source Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rust
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that crates built with a single set of features are accepted.
+func TestFeatureUnification(t *testing.T) {
+	testRust(t, `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar", "libfoo"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			rustlibs: ["libfoo"],
+			dep_features: ["foo:fizz"],
+		}
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz", "buzz"],
+		}`)
+}
+
+// Test that a crate built with different features or cfgs in the same binary is reported.
+func TestFeatureUnificationConflict(t *testing.T) {
+	bp := `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar", "libfoo"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			rustlibs: ["libfoo_nobuzz"],
+		}
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz", "buzz"],
+			cfgs: ["fast"],
+		}
+		rust_library_host {
+			name: "libfoo_nobuzz",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz"],
+			cfgs: ["fast"],
+		}`
+
+	testRustError(t, `crate "foo" is built with inconsistent features in the dependencies of this module: `+
+		`feature "buzz" is enabled by libfoo but not by libfoo_nobuzz`, bp)
+
+	testRustError(t, `crate "foo" is built with inconsistent cfgs in the dependencies of this module: `+
+		`cfg "slow" is set by libfoo_nobuzz but not by libfoo`,
+		strings.Replace(bp, `features: ["fizz"],
+			cfgs: ["fast"],`, `features: ["fizz", "buzz"],
+			cfgs: ["fast", "slow"],`, 1))
+}
+
+// Test that a separate version of a crate is not unified with the other version.
+func TestFeatureUnificationSeparateVersion(t *testing.T) {
+	testRust(t, `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar", "libfoo"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			rustlibs: ["libfoo_v2"],
+			dep_features: ["foo:buzz"],
+		}
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz"],
+		}
+		rust_library_host {
+			name: "libfoo_v2",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz", "buzz"],
+			unify_features: false,
+		}`)
+}
+
+// Test that a crate relying on a feature that isn't enabled is reported.
+func TestFeatureUnificationDepFeatures(t *testing.T) {
+	testRustError(t, `"libbar" relies on feature "buzz" of crate "foo", which is not enabled by libfoo`, `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			rustlibs: ["libfoo"],
+			dep_features: ["foo:buzz"],
+		}
+		rust_library_host {
+			name: "libfoo",
+			srcs: ["foo.rs"],
+			crate_name: "foo",
+			features: ["fizz"],
+		}`)
+
+	testRustError(t, `dep_features of "libbar": "buzz" must be in the form <crate_name>:<feature>`, `
+		rust_binary_host {
+			name: "fizz-buzz",
+			srcs: ["foo.rs"],
+			rustlibs: ["libbar"],
+		}
+		rust_library_host {
+			name: "libbar",
+			srcs: ["foo.rs"],
+			crate_name: "bar",
+			dep_features: ["buzz"],
+		}`)
+}
@@ -477,6 +477,7 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 	} else if library.dylib() {
 		fileName = library.getStem(ctx) + ctx.toolchain().DylibSuffix()
 		outputFile = android.PathForModuleOut(ctx, fileName)
+		deps.validations = library.sizeBudgetValidations(ctx, fileName, library.stripper.NeedsStrip(ctx))
 
 		TransformSrctoDylib(ctx, srcPath, deps, flags, outputFile)
 	} else if library.static() {
@@ -487,6 +488,7 @@ func (library *libraryDecorator) compile(ctx ModuleContext, flags Flags, deps Pa
 	} else if library.shared() {
 		fileName = library.sharedLibFilename(ctx)
 		outputFile = android.PathForModuleOut(ctx, fileName)
+		deps.validations = library.sizeBudgetValidations(ctx, fileName, library.stripper.NeedsStrip(ctx))
 
 		TransformSrctoShared(ctx, srcPath, deps, flags, outputFile)
 	}
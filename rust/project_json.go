@@ -18,8 +18,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"strings"
 
 	"android/soong/android"
+	"android/soong/cc"
 )
 
 // This singleton collects Rust crate definitions and generates a JSON file
@@ -29,11 +31,29 @@ import (
 // For example,
 //
 //   $ SOONG_GEN_RUST_PROJECT=1 m nothing
+//
+// When the compilation database is generated (SOONG_GEN_COMPDB), the crates are
+// also written next to compile_commands.json, restricted to the variants
+// selected for the compilation database, and their generated sources are added
+// to the compdb-generated-sources phony target.
+//
+// The variant described for each crate can be chosen with
+// SOONG_GEN_RUST_PROJECT_ARCH and SOONG_GEN_RUST_PROJECT_IMAGE, which default to
+// the variant selected for the compilation database when it is generated too.
+// The generated sources and the proc-macro dylibs referenced by
+// rust-project.json are built by the rust-project-deps phony target, e.g.
+//
+//   $ SOONG_GEN_RUST_PROJECT=1 SOONG_GEN_RUST_PROJECT_ARCH=x86_64 m rust-project-deps
 
 const (
 	// Environment variables used to control the behavior of this singleton.
-	envVariableCollectRustDeps = "SOONG_GEN_RUST_PROJECT"
-	rustProjectJsonFileName    = "rust-project.json"
+	envVariableCollectRustDeps  = "SOONG_GEN_RUST_PROJECT"
+	envVariableRustProjectArch  = "SOONG_GEN_RUST_PROJECT_ARCH"
+	envVariableRustProjectImage = "SOONG_GEN_RUST_PROJECT_IMAGE"
+	rustProjectJsonFileName     = "rust-project.json"
+
+	// The phony target building the files referenced by rust-project.json.
+	rustProjectDepsPhony = "rust-project-deps"
 )
 
 // The format of rust-project.json is not yet finalized. A current description is available at:
@@ -44,13 +64,23 @@ type rustProjectDep struct {
 	Name  string `json:"name"`
 }
 
+// rustProjectSource lists the directories containing the source files of a crate, including the
+// generated ones.
+type rustProjectSource struct {
+	IncludeDirs []string `json:"include_dirs"`
+	ExcludeDirs []string `json:"exclude_dirs"`
+}
+
 type rustProjectCrate struct {
-	DisplayName string            `json:"display_name"`
-	RootModule  string            `json:"root_module"`
-	Edition     string            `json:"edition,omitempty"`
-	Deps        []rustProjectDep  `json:"deps"`
-	Cfg         []string          `json:"cfg"`
-	Env         map[string]string `json:"env"`
+	DisplayName        string             `json:"display_name"`
+	RootModule         string             `json:"root_module"`
+	Edition            string             `json:"edition,omitempty"`
+	Deps               []rustProjectDep   `json:"deps"`
+	Cfg                []string           `json:"cfg"`
+	Env                map[string]string  `json:"env"`
+	Source             *rustProjectSource `json:"source,omitempty"`
+	IsProcMacro        bool               `json:"is_proc_macro,omitempty"`
+	ProcMacroDylibPath string             `json:"proc_macro_dylib_path,omitempty"`
 }
 
 type rustProjectJson struct {
@@ -66,6 +96,12 @@ type crateInfo struct {
 type projectGeneratorSingleton struct {
 	project     rustProjectJson
 	knownCrates map[string]crateInfo // Keys are module names.
+
+	// Sources generated by the SourceProvider crates in project.
+	generatedSources android.Paths
+
+	// Dylibs of the proc-macro crates in project.
+	procMacroDylibs android.Paths
 }
 
 func rustProjectGeneratorSingleton() android.Singleton {
@@ -208,6 +244,8 @@ func isModuleSupported(ctx android.SingletonContext, module android.Module) (*Mo
 		comp = c.baseCompiler
 	case *testDecorator:
 		comp = c.binaryDecorator.baseCompiler
+	case *procMacroDecorator:
+		comp = c.baseCompiler
 	default:
 		return nil, nil, false
 	}
@@ -233,13 +271,48 @@ func (singleton *projectGeneratorSingleton) addCrate(ctx android.SingletonContex
 		Env:         make(map[string]string),
 	}
 
+	crate.Source = &rustProjectSource{
+		IncludeDirs: []string{path.Dir(rootModule)},
+		ExcludeDirs: make([]string, 0),
+	}
+
 	if comp.CargoOutDir().Valid() {
 		crate.Env["OUT_DIR"] = comp.CargoOutDir().String()
+		crate.Source.IncludeDirs = append(crate.Source.IncludeDirs, comp.CargoOutDir().String())
+	}
+
+	if comp.CargoEnvCompat() {
+		if _, ok := rModule.compiler.(*binaryDecorator); ok && rModule.OutputFile().Valid() {
+			outputFile := rModule.OutputFile().Path()
+			crate.Env["CARGO_BIN_NAME"] = strings.TrimSuffix(outputFile.Base(), outputFile.Ext())
+		}
+		crate.Env["CARGO_CRATE_NAME"] = rModule.CrateName()
+		if pkgVersion := comp.CargoPkgVersion(); pkgVersion != "" {
+			crate.Env["CARGO_PKG_VERSION"] = pkgVersion
+		}
+	}
+
+	if rModule.sourceProvider != nil {
+		singleton.generatedSources = append(singleton.generatedSources, rModule.sourceProvider.Srcs()...)
 	}
 
+	if _, ok := rModule.compiler.(*procMacroDecorator); ok {
+		crate.IsProcMacro = true
+		if rModule.OutputFile().Valid() {
+			crate.ProcMacroDylibPath = rModule.OutputFile().String()
+			singleton.procMacroDylibs = append(singleton.procMacroDylibs, rModule.OutputFile().Path())
+		}
+	}
+
+	// The cfgs passed to rustc by the compiler, see baseCompiler.cfgsToFlags, featuresToFlags
+	// and compilerFlags.
+	crate.Cfg = append(crate.Cfg, comp.Properties.Cfgs...)
 	for _, feature := range comp.Properties.Features {
 		crate.Cfg = append(crate.Cfg, "feature=\""+feature+"\"")
 	}
+	if rModule.UseVndk() {
+		crate.Cfg = append(crate.Cfg, "android_vndk")
+	}
 
 	deps := make(map[string]int)
 	singleton.mergeDependencies(ctx, rModule, &crate, deps)
@@ -250,6 +323,24 @@ func (singleton *projectGeneratorSingleton) addCrate(ctx android.SingletonContex
 	return idx, true
 }
 
+// rustProjectVariantSelected returns true if the given module variant matches the arch and image
+// selected through SOONG_GEN_RUST_PROJECT_ARCH and SOONG_GEN_RUST_PROJECT_IMAGE. If they are not
+// set, the variants selected for the compilation database are used when it is generated.
+func rustProjectVariantSelected(config android.Config, module *Module) bool {
+	arch := config.Getenv(envVariableRustProjectArch)
+	image := config.Getenv(envVariableRustProjectImage)
+	if arch == "" && image == "" {
+		return !cc.CompdbEnabled(config) || cc.CompdbVariantSelected(config, module)
+	}
+	if arch != "" && module.Target().Arch.ArchType.Name != arch {
+		return false
+	}
+	if image != "" && string(cc.GetImageVariantType(module)) != image {
+		return false
+	}
+	return true
+}
+
 // appendCrateAndDependencies creates a rustProjectCrate for the module argument and appends it to singleton.project.
 // It visits the dependencies of the module depth-first so the dependency ID can be added to the current module. If the
 // current module is already in singleton.knownCrates, its dependencies are merged.
@@ -258,6 +349,9 @@ func (singleton *projectGeneratorSingleton) appendCrateAndDependencies(ctx andro
 	if !ok {
 		return
 	}
+	if !rustProjectVariantSelected(ctx.Config(), rModule) {
+		return
+	}
 	// If we have seen this crate already; merge any new dependencies.
 	if cInfo, ok := singleton.knownCrates[module.Name()]; ok {
 		crate := singleton.project.Crates[cInfo.Idx]
@@ -269,7 +363,9 @@ func (singleton *projectGeneratorSingleton) appendCrateAndDependencies(ctx andro
 }
 
 func (singleton *projectGeneratorSingleton) GenerateBuildActions(ctx android.SingletonContext) {
-	if !ctx.Config().IsEnvTrue(envVariableCollectRustDeps) {
+	collectRustDeps := ctx.Config().IsEnvTrue(envVariableCollectRustDeps)
+	compdbEnabled := cc.CompdbEnabled(ctx.Config())
+	if !collectRustDeps && !compdbEnabled {
 		return
 	}
 
@@ -278,10 +374,28 @@ func (singleton *projectGeneratorSingleton) GenerateBuildActions(ctx android.Sin
 		singleton.appendCrateAndDependencies(ctx, module)
 	})
 
-	path := android.PathForOutput(ctx, rustProjectJsonFileName)
-	err := createJsonFile(singleton.project, path)
-	if err != nil {
-		ctx.Errorf(err.Error())
+	if collectRustDeps {
+		path := android.PathForOutput(ctx, rustProjectJsonFileName)
+		err := createJsonFile(singleton.project, path)
+		if err != nil {
+			ctx.Errorf(err.Error())
+		}
+		ctx.Phony(rustProjectDepsPhony, android.FirstUniquePaths(
+			append(singleton.generatedSources, singleton.procMacroDylibs...))...)
+	}
+
+	if compdbEnabled {
+		// The compdb singleton may not have created the directory yet.
+		if err := android.CreateOutputDirIfNonexistent(cc.CompdbOutputDir(ctx), 0777); err != nil {
+			ctx.Errorf(err.Error())
+		}
+		path := cc.CompdbOutputDir(ctx).Join(ctx, rustProjectJsonFileName)
+		err := createJsonFile(singleton.project, path)
+		if err != nil {
+			ctx.Errorf(err.Error())
+		}
+		ctx.Phony(cc.CompdbGeneratedSourcesPhony, android.FirstUniquePaths(
+			append(singleton.generatedSources, singleton.procMacroDylibs...))...)
 	}
 }
 
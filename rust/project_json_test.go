@@ -297,3 +297,199 @@ func TestProjectJsonMultiVersion(t *testing.T) {
 	}
 	t.Errorf("libb crate has not been found: %v", crates)
 }
+
+func TestProjectJsonProcMacro(t *testing.T) {
+	bp := `
+	rust_proc_macro {
+		name: "libmacros",
+		srcs: ["macros/src/lib.rs"],
+		crate_name: "macros",
+	}
+	rust_library {
+		name: "libf",
+		srcs: ["f/src/lib.rs"],
+		crate_name: "f",
+		cfgs: ["fizz"],
+		features: ["buzz"],
+		proc_macros: ["libmacros"],
+		cargo_env_compat: true,
+		cargo_pkg_version: "1.0.0",
+	}
+	`
+	jsonContent := testProjectJson(t, bp)
+	crates := validateJsonCrates(t, jsonContent)
+	foundMacros, foundF := false, false
+	for _, c := range crates {
+		crate := validateCrate(t, c)
+		switch crate["root_module"] {
+		case "macros/src/lib.rs":
+			foundMacros = true
+			if crate["is_proc_macro"] != true {
+				t.Errorf("libmacros is not a proc macro: %v", crate)
+			}
+			dylib, _ := crate["proc_macro_dylib_path"].(string)
+			if !strings.HasSuffix(dylib, "libmacros.so") {
+				t.Errorf("Unexpected proc_macro_dylib_path for libmacros: %q", dylib)
+			}
+		case "f/src/lib.rs":
+			foundF = true
+			if !android.InList("macros", validateDependencies(t, crate)) {
+				t.Errorf("libf does not depend on libmacros: %v", crate)
+			}
+			android.AssertArrayString(t, "libf cfgs", []string{"fizz", "feature=\"buzz\""}, crateCfgs(crate))
+			env := crate["env"].(map[string]interface{})
+			android.AssertStringEquals(t, "CARGO_CRATE_NAME", "f", env["CARGO_CRATE_NAME"].(string))
+			android.AssertStringEquals(t, "CARGO_PKG_VERSION", "1.0.0", env["CARGO_PKG_VERSION"].(string))
+			source := crate["source"].(map[string]interface{})
+			includeDirs := source["include_dirs"].([]interface{})
+			if len(includeDirs) == 0 || includeDirs[0] != "f/src" {
+				t.Errorf("Unexpected include_dirs for libf: %v", includeDirs)
+			}
+		}
+	}
+	if !foundMacros || !foundF {
+		t.Errorf("libmacros or libf crate has not been found: %v", crates)
+	}
+}
+
+func TestProjectJsonVariant(t *testing.T) {
+	bp := `
+	rust_library {
+		name: "liba",
+		srcs: ["a/src/lib.rs"],
+		crate_name: "a",
+		host_supported: true,
+		vendor_available: true,
+	}
+	`
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_GEN_RUST_PROJECT":       "1",
+			"SOONG_GEN_RUST_PROJECT_ARCH":  "arm64",
+			"SOONG_GEN_RUST_PROJECT_IMAGE": "vendor",
+		}),
+		android.FixtureModifyProductVariables(func(variables android.FixtureProductVariables) {
+			variables.DeviceVndkVersion = StringPtr("current")
+			variables.Platform_vndk_version = StringPtr("29")
+		}),
+	).RunTestWithBp(t, bp)
+
+	content, err := ioutil.ReadFile(filepath.Join(result.Config.SoongOutDir(), rustProjectJsonFileName))
+	if err != nil {
+		t.Fatalf("rust-project.json has not been generated")
+	}
+	crates := validateJsonCrates(t, content)
+	for _, c := range crates {
+		crate := validateCrate(t, c)
+		if crate["root_module"] != "a/src/lib.rs" {
+			continue
+		}
+		env := crate["env"].(map[string]interface{})
+		outDir, _ := env["OUT_DIR"].(string)
+		if !strings.Contains(outDir, "android_vendor") || !strings.Contains(outDir, "arm64") {
+			t.Errorf("liba is not described by its arm64 vendor variant, got OUT_DIR %q", outDir)
+		}
+		if !android.InList("android_vndk", crateCfgs(crate)) {
+			t.Errorf("liba vendor variant does not have the android_vndk cfg: %v", crate)
+		}
+		return
+	}
+	t.Errorf("liba crate has not been found: %v", crates)
+}
+
+// crateCfgs returns the cfg attribute of a crate.
+func crateCfgs(crate map[string]interface{}) []string {
+	var cfgs []string
+	for _, cfg := range crate["cfg"].([]interface{}) {
+		cfgs = append(cfgs, cfg.(string))
+	}
+	return cfgs
+}
+
+// Test that the variants selected for the compilation database don't restrict rust-project.json
+// when the compilation database is not generated.
+func TestProjectJsonCompdbSelectionNotGenerated(t *testing.T) {
+	bp := `
+	rust_library {
+		name: "liba",
+		srcs: ["a/src/lib.rs"],
+		crate_name: "a",
+	}
+	`
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_GEN_RUST_PROJECT": "1",
+			"SOONG_GEN_COMPDB_IMAGE": "vendor",
+		}),
+	).RunTestWithBp(t, bp)
+
+	content, err := ioutil.ReadFile(filepath.Join(result.Config.SoongOutDir(), rustProjectJsonFileName))
+	if err != nil {
+		t.Fatalf("rust-project.json has not been generated")
+	}
+	for _, c := range validateJsonCrates(t, content) {
+		if validateCrate(t, c)["root_module"] == "a/src/lib.rs" {
+			return
+		}
+	}
+	t.Errorf("liba crate has not been found")
+}
+
+func TestProjectJsonCompdb(t *testing.T) {
+	bp := `
+	rust_library {
+		name: "libd",
+		srcs: ["d/src/lib.rs"],
+		rlibs: ["libbindings1"],
+		crate_name: "d",
+		host_supported: true,
+	}
+	rust_bindgen {
+		name: "libbindings1",
+		crate_name: "bindings1",
+		source_stem: "bindings1",
+		host_supported: true,
+		wrapper_src: "src/any.h",
+	}
+	`
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		android.PrepareForTestWithPhony,
+		android.FixtureMergeEnv(map[string]string{
+			"SOONG_GEN_COMPDB":      "1",
+			"SOONG_GEN_COMPDB_ARCH": "arm64",
+		}),
+	).RunTestWithBp(t, bp)
+
+	// rust-project.json is only written next to compile_commands.json.
+	if _, err := ioutil.ReadFile(filepath.Join(result.Config.SoongOutDir(), rustProjectJsonFileName)); err == nil {
+		t.Errorf("rust-project.json has been generated without SOONG_GEN_RUST_PROJECT")
+	}
+	content, err := ioutil.ReadFile(filepath.Join(result.Config.SoongOutDir(),
+		"development/ide/compdb", rustProjectJsonFileName))
+	if err != nil {
+		t.Fatalf("rust-project.json has not been generated next to compile_commands.json")
+	}
+	found := false
+	for _, c := range validateJsonCrates(t, content) {
+		crate := validateCrate(t, c)
+		if crate["root_module"] != "d/src/lib.rs" {
+			continue
+		}
+		found = true
+		outDir, _ := crate["env"].(map[string]interface{})["OUT_DIR"].(string)
+		if !strings.Contains(outDir, "android_arm64") {
+			t.Errorf("libd is not described by its arm64 variant, got OUT_DIR %q", outDir)
+		}
+	}
+	if !found {
+		t.Errorf("libd crate has not been found")
+	}
+
+	bindings := result.ModuleForTests("libbindings1", "android_arm64_armv8-a_source").Output("bindings1.rs")
+	phony := result.SingletonForTests("phony").Output("compdb-generated-sources")
+	android.AssertStringListContains(t, "compdb-generated-sources",
+		android.PathsRelativeToTop(phony.Implicits), bindings.Output.RelativeToTop().String())
+}
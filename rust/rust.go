@@ -48,6 +48,7 @@ func init() {
 	})
 	android.PostDepsMutators(func(ctx android.RegisterMutatorsContext) {
 		ctx.BottomUp("rust_sanitizers", rustSanitizerRuntimeMutator).Parallel()
+		ctx.BottomUp("rust_feature_unification", featureUnificationMutator).Parallel()
 	})
 	pctx.Import("android/soong/rust/config")
 	pctx.ImportAs("cc_config", "android/soong/cc/config")
@@ -161,6 +162,9 @@ type Module struct {
 	unstrippedOutputFile android.OptionalPath
 	docTimestampFile     android.OptionalPath
 
+	// The diagnostics of rustc or clippy for the module, when RUST_DIAGNOSTICS is set.
+	diagnosticsFile android.OptionalPath
+
 	hideApexVariantFromMake bool
 }
 
@@ -424,6 +428,9 @@ type PathDeps struct {
 	// Paths to generated source files
 	SrcDeps          android.Paths
 	srcProviderFiles android.Paths
+
+	// Validations of the crate, such as the size budget check.
+	validations android.Paths
 }
 
 type RustLibraries []RustLibrary
@@ -440,6 +447,10 @@ type compiler interface {
 	compile(ctx ModuleContext, flags Flags, deps PathDeps) android.Path
 	compilerDeps(ctx DepsContext, deps Deps) Deps
 	crateName() string
+	features() []string
+	cfgs() []string
+	depFeatures() []string
+	unifyFeatures() bool
 	rustdoc(ctx ModuleContext, flags Flags, deps PathDeps) android.OptionalPath
 
 	// Output directory in which source-generated code from dependencies is
@@ -454,6 +465,7 @@ type compiler interface {
 
 	inData() bool
 	install(ctx ModuleContext)
+	installedPath() android.InstallPath
 	relativeInstallPath() string
 	everInstallable() bool
 
@@ -895,6 +907,12 @@ func (mod *Module) GenerateAndroidBuildActions(actx android.ModuleContext) {
 		apexInfo := actx.Provider(android.ApexInfoProvider).(android.ApexInfo)
 		if mod.installable(apexInfo) {
 			mod.compiler.install(ctx)
+
+			_, isTest := mod.compiler.(*testDecorator)
+			_, isBenchmark := mod.compiler.(*benchmarkDecorator)
+			if mod.Binary() || isTest || isBenchmark || mod.Shared() || mod.Dylib() {
+				cc.SplitDebugInfoByBuildId(ctx, unstrippedOutputFile, mod.compiler.installedPath())
+			}
 		}
 
 		ctx.Phony("rust", ctx.RustModule().OutputFile().Path())
@@ -50,6 +50,8 @@ var rustMockedFiles = android.MockFS{
 	"foo.c":                        nil,
 	"src/bar.rs":                   nil,
 	"src/any.h":                    nil,
+	"src/any.symbols":              nil,
+	"src/any_x86_64.symbols":       nil,
 	"c_includes/c_header.h":        nil,
 	"rust_includes/rust_headers.h": nil,
 	"proto.proto":                  nil,
@@ -442,3 +444,25 @@ func TestLibrarySizes(t *testing.T) {
 	m.Output("libwaldo.dylib.so.bloaty.csv")
 	m.Output("stripped/libwaldo.dylib.so.bloaty.csv")
 }
+
+// Test that the growth report compares the sizes with the baseline of another build.
+func TestBinarySizesGrowthReport(t *testing.T) {
+	skipTestIfOsNotSupported(t)
+	baseline := "/previous/out/soong/binary_sizes.pb.gz"
+	result := android.GroupFixturePreparers(
+		prepareForRustTest,
+		rustMockedFiles.AddToFixture(),
+		android.FixtureMergeEnv(map[string]string{"SOONG_BLOATY_BASELINE": baseline}),
+	).RunTestWithBp(t, `
+		rust_library_dylib {
+			name: "libwaldo",
+			srcs: ["foo.rs"],
+			crate_name: "waldo",
+		}`)
+
+	m := result.SingletonForTests("file_metrics")
+	diff := m.Output("binary_sizes_growth.txt")
+	android.AssertStringEquals(t, "baseline", baseline, diff.Args["baseline"])
+	android.AssertPathsRelativeToTopEquals(t, "implicits", []string{baseline}, diff.Implicits)
+	android.AssertPathRelativeToTopEquals(t, "input", "out/soong/binary_sizes.pb.gz", diff.Input)
+}
@@ -220,6 +220,7 @@ func registerRequiredBuildComponentsForTest(ctx android.RegistrationContext) {
 	ctx.RegisterModuleType("rust_bindgen_host", RustBindgenHostFactory)
 	ctx.RegisterModuleType("rust_test", RustTestFactory)
 	ctx.RegisterModuleType("rust_test_host", RustTestHostFactory)
+	ctx.RegisterModuleType("rust_doctest_host", RustDoctestHostFactory)
 	ctx.RegisterModuleType("rust_library", RustLibraryFactory)
 	ctx.RegisterModuleType("rust_library_dylib", RustLibraryDylibFactory)
 	ctx.RegisterModuleType("rust_library_rlib", RustLibraryRlibFactory)
@@ -245,6 +246,11 @@ func registerRequiredBuildComponentsForTest(ctx android.RegistrationContext) {
 		ctx.BottomUp("rust_stdlinkage", LibstdMutator).Parallel()
 		ctx.BottomUp("rust_begin", BeginMutator).Parallel()
 	})
+	ctx.PostDepsMutators(func(ctx android.RegisterMutatorsContext) {
+		ctx.BottomUp("rust_feature_unification", featureUnificationMutator).Parallel()
+	})
 	ctx.RegisterSingletonType("rust_project_generator", rustProjectGeneratorSingleton)
+	ctx.RegisterSingletonType("rust_diagnostics", rustDiagnosticsSingletonFactory)
+	ctx.RegisterSingletonType("rust_audit", rustAuditSingletonFactory)
 	registerRustSnapshotModules(ctx)
 }
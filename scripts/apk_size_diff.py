@@ -0,0 +1,109 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Compares two APK size reports written by apk_size_report.py.
+
+Prints the entries whose compressed size changed, largest change first, and
+fails if the compressed size of the APK grew by more than --max_growth bytes.
+"""
+
+import argparse
+import json
+import sys
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--max_growth', dest='max_growth', type=int,
+                      help='fail if the compressed size of the APK grew by '
+                      'more than this number of bytes.')
+  parser.add_argument('--output', dest='output',
+                      help='file to write the diff to instead of stdout.')
+  parser.add_argument('old', help='the size report of the old APK.')
+  parser.add_argument('new', help='the size report of the new APK.')
+  return parser.parse_args()
+
+
+def flatten(report):
+  """Returns the sizes of a report indexed by category/key."""
+  sizes = {'total': report['total']}
+  for cat, entry in report['categories'].items():
+    sizes[cat] = entry
+    for key, sub_entry in entry['breakdown'].items():
+      sizes['%s/%s' % (cat, key)] = sub_entry
+  return sizes
+
+
+def size_diff(old, new):
+  """Returns the (key, old entry, new entry) tuples of the changed entries.
+
+  Missing entries are reported with sizes of 0.  The entries are sorted by
+  decreasing absolute change of their compressed size.
+  """
+  old_sizes = flatten(old)
+  new_sizes = flatten(new)
+  empty = {'size': 0, 'compressed': 0}
+  changes = []
+  for key in set(old_sizes) | set(new_sizes):
+    old_entry = old_sizes.get(key, empty)
+    new_entry = new_sizes.get(key, empty)
+    if (old_entry['size'] != new_entry['size'] or
+        old_entry['compressed'] != new_entry['compressed']):
+      changes.append((key, old_entry, new_entry))
+  changes.sort(key=lambda c: (-abs(c[2]['compressed'] - c[1]['compressed']),
+                              c[0]))
+  return changes
+
+
+def format_diff(changes):
+  """Returns a table of the changes."""
+  lines = ['%-50s %12s %12s %12s %12s' % ('entry', 'old', 'new', 'delta',
+                                           'delta (raw)')]
+  for key, old_entry, new_entry in changes:
+    lines.append('%-50s %12d %12d %+12d %+12d' % (
+        key, old_entry['compressed'], new_entry['compressed'],
+        new_entry['compressed'] - old_entry['compressed'],
+        new_entry['size'] - old_entry['size']))
+  return '\n'.join(lines) + '\n'
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  with open(args.old) as f:
+    old = json.load(f)
+  with open(args.new) as f:
+    new = json.load(f)
+
+  diff = format_diff(size_diff(old, new))
+  if args.output:
+    with open(args.output, 'w') as f:
+      f.write(diff)
+  else:
+    sys.stdout.write(diff)
+
+  growth = new['total']['compressed'] - old['total']['compressed']
+  if args.max_growth is not None and growth > args.max_growth:
+    sys.stderr.write('%s grew by %d bytes, more than the allowed %d bytes\n' %
+                     (new['name'], growth, args.max_growth))
+    return 1
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,64 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for apk_size_diff.py."""
+
+import unittest
+
+import apk_size_diff
+
+
+def report(dex_packages, native):
+  dex = {k: {'size': v, 'compressed': v} for k, v in dex_packages.items()}
+  native = {k: {'size': v, 'compressed': v // 2} for k, v in native.items()}
+  dex_size = sum(dex_packages.values())
+  native_size = sum(native[k]['size'] for k in native)
+  native_compressed = sum(native[k]['compressed'] for k in native)
+  return {
+      'name': 'foo',
+      'total': {'size': dex_size + native_size,
+                'compressed': dex_size + native_compressed},
+      'categories': {
+          'dex': {'size': dex_size, 'compressed': dex_size, 'breakdown': dex},
+          'native': {'size': native_size, 'compressed': native_compressed,
+                     'breakdown': native},
+      },
+  }
+
+
+class SizeDiffTest(unittest.TestCase):
+
+  def test_diff(self):
+    old = report({'com.foo': 100, 'com.bar': 50}, {'x86': 100})
+    new = report({'com.foo': 100, 'com.baz': 10}, {'x86': 300})
+    changes = apk_size_diff.size_diff(old, new)
+    self.assertEqual([c[0] for c in changes], [
+        'native', 'native/x86', 'total', 'dex/com.bar', 'dex', 'dex/com.baz'])
+    self.assertEqual(changes[3][2], {'size': 0, 'compressed': 0})
+    self.assertEqual(changes[5][1], {'size': 0, 'compressed': 0})
+
+  def test_format(self):
+    old = report({'com.foo': 100}, {})
+    new = report({'com.foo': 120}, {})
+    diff = apk_size_diff.format_diff(apk_size_diff.size_diff(old, new))
+    self.assertIn('dex/com.foo', diff)
+    self.assertIn('+20', diff)
+    self.assertNotIn('native', diff)
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
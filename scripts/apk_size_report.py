@@ -0,0 +1,226 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Writes a JSON report of the size of the contents of an APK.
+
+The APK is broken down into dex code per Java package, resources per resource
+type, native libraries per ABI, assets per top level directory of assets/, and
+other files.  Each entry reports the uncompressed size and the compressed size
+in the APK.  The size of the dex code of a package is the size of the class
+data and code items of its classes, the remaining size of the dex files like
+the string and method tables shared by all the classes is reported as
+<shared>.  Compressed sizes of packages are prorated from the compressed size
+of the dex files.
+
+Reports can be compared with apk_size_diff.py.
+"""
+
+import argparse
+import collections
+import json
+import struct
+import sys
+import zipfile
+
+SHARED = '<shared>'
+DEFAULT_PACKAGE = '<default>'
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--name', dest='name', required=True,
+                      help='name of the module.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the JSON report to.')
+  parser.add_argument('apk', help='the APK to report the size of.')
+  return parser.parse_args()
+
+
+def read_uleb128(data, offset):
+  """Returns the unsigned LEB128 value at offset and the offset after it."""
+  result = 0
+  shift = 0
+  while True:
+    byte = data[offset]
+    offset += 1
+    result |= (byte & 0x7f) << shift
+    if byte & 0x80 == 0:
+      return result, offset
+    shift += 7
+
+
+def read_sleb128(data, offset):
+  """Returns the signed LEB128 value at offset and the offset after it."""
+  result = 0
+  shift = 0
+  while True:
+    byte = data[offset]
+    offset += 1
+    result |= (byte & 0x7f) << shift
+    shift += 7
+    if byte & 0x80 == 0:
+      if byte & 0x40:
+        result -= 1 << shift
+      return result, offset
+
+
+def code_item_size(data, offset):
+  """Returns the size of the code_item at offset."""
+  tries_size, = struct.unpack_from('<H', data, offset + 6)
+  insns_size, = struct.unpack_from('<I', data, offset + 12)
+  end = offset + 16 + insns_size * 2
+  if tries_size:
+    if insns_size % 2:
+      end += 2
+    end += tries_size * 8
+    handlers, end = read_uleb128(data, end)
+    for _ in range(handlers):
+      size, end = read_sleb128(data, end)
+      for _ in range(abs(size)):
+        _, end = read_uleb128(data, end)
+        _, end = read_uleb128(data, end)
+      if size <= 0:
+        _, end = read_uleb128(data, end)
+  return end - offset
+
+
+def class_data_size(data, offset):
+  """Returns the size of the class_data_item at offset and of its code items."""
+  start = offset
+  counts = []
+  for _ in range(4):
+    count, offset = read_uleb128(data, offset)
+    counts.append(count)
+  static_fields, instance_fields, direct_methods, virtual_methods = counts
+  for _ in range(static_fields + instance_fields):
+    _, offset = read_uleb128(data, offset)
+    _, offset = read_uleb128(data, offset)
+  code_size = 0
+  for _ in range(direct_methods + virtual_methods):
+    _, offset = read_uleb128(data, offset)
+    _, offset = read_uleb128(data, offset)
+    code_off, offset = read_uleb128(data, offset)
+    if code_off:
+      code_size += code_item_size(data, code_off)
+  return offset - start + code_size
+
+
+def read_string(data, string_ids_off, index):
+  """Returns the string with the given index of a dex file."""
+  string_data_off, = struct.unpack_from('<I', data, string_ids_off + index * 4)
+  _, offset = read_uleb128(data, string_data_off)
+  end = data.index(b'\0', offset)
+  return data[offset:end].decode('utf-8', 'replace')
+
+
+def package_name(descriptor):
+  """Returns the Java package of a class descriptor like Lfoo/bar/Baz;."""
+  name = descriptor[1:-1]
+  if '/' not in name:
+    return DEFAULT_PACKAGE
+  return name.rsplit('/', 1)[0].replace('/', '.')
+
+
+def dex_package_sizes(data):
+  """Returns the size of the classes of a dex file per Java package."""
+  if not data.startswith(b'dex\n'):
+    raise ValueError('not a dex file')
+  string_ids_off, = struct.unpack_from('<I', data, 0x3c)
+  type_ids_off, = struct.unpack_from('<I', data, 0x44)
+  class_defs_size, class_defs_off = struct.unpack_from('<II', data, 0x60)
+
+  sizes = collections.Counter()
+  for i in range(class_defs_size):
+    class_def_off = class_defs_off + i * 32
+    class_idx, = struct.unpack_from('<I', data, class_def_off)
+    class_data_off, = struct.unpack_from('<I', data, class_def_off + 24)
+    descriptor_idx, = struct.unpack_from('<I', data, type_ids_off + class_idx * 4)
+    package = package_name(read_string(data, string_ids_off, descriptor_idx))
+    # Count the class_def_item itself so that classes without class data are
+    # accounted for.
+    sizes[package] += 32
+    if class_data_off:
+      sizes[package] += class_data_size(data, class_data_off)
+  sizes[SHARED] += len(data) - sum(sizes.values())
+  return sizes
+
+
+def category(name):
+  """Returns the category and the breakdown key of an APK entry."""
+  parts = name.split('/')
+  if name.endswith('.dex') and len(parts) == 1:
+    return 'dex', None
+  if parts[0] == 'res' and len(parts) > 2:
+    return 'resources', parts[1].split('-')[0]
+  if name == 'resources.arsc':
+    return 'resources', 'arsc'
+  if parts[0] == 'lib' and len(parts) > 2:
+    return 'native', parts[1]
+  if parts[0] == 'assets' and len(parts) > 1:
+    return 'assets', parts[1] if len(parts) > 2 else '<root>'
+  return 'other', parts[0]
+
+
+def new_entry():
+  return {'size': 0, 'compressed': 0}
+
+
+def add(entry, size, compressed):
+  entry['size'] += size
+  entry['compressed'] += compressed
+
+
+def size_report(name, apk):
+  """Returns the size report of an APK opened as a zipfile.ZipFile."""
+  categories = collections.OrderedDict(
+      (c, {'size': 0, 'compressed': 0, 'breakdown': {}})
+      for c in ('dex', 'resources', 'native', 'assets', 'other'))
+  total = new_entry()
+
+  for info in apk.infolist():
+    if info.filename.endswith('/'):
+      continue
+    add(total, info.file_size, info.compress_size)
+    cat, key = category(info.filename)
+    add(categories[cat], info.file_size, info.compress_size)
+    breakdown = categories[cat]['breakdown']
+    if cat == 'dex':
+      package_sizes = dex_package_sizes(apk.read(info.filename))
+      for package, size in package_sizes.items():
+        compressed = size * info.compress_size // max(info.file_size, 1)
+        add(breakdown.setdefault(package, new_entry()), size, compressed)
+    else:
+      add(breakdown.setdefault(key, new_entry()), info.file_size,
+          info.compress_size)
+
+  return {'name': name, 'total': total, 'categories': categories}
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  with zipfile.ZipFile(args.apk) as apk:
+    report = size_report(args.name, apk)
+
+  with open(args.output, 'w') as f:
+    json.dump(report, f, indent=2, sort_keys=True)
+    f.write('\n')
+
+
+if __name__ == '__main__':
+  sys.exit(main())
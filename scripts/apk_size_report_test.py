@@ -0,0 +1,152 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for apk_size_report.py."""
+
+import io
+import struct
+import unittest
+import zipfile
+
+import apk_size_report
+
+
+def uleb128(value):
+  out = bytearray()
+  while True:
+    byte = value & 0x7f
+    value >>= 7
+    if value:
+      out.append(byte | 0x80)
+    else:
+      out.append(byte)
+      return bytes(out)
+
+
+def build_dex(classes):
+  """Builds a minimal dex file.
+
+  classes is a list of (descriptor, insns_size) tuples, each class gets a
+  single direct method with insns_size code units and no tries.
+  """
+  n = len(classes)
+  string_ids_off = 0x70
+  type_ids_off = string_ids_off + 4 * n
+  class_defs_off = type_ids_off + 4 * n
+  data = bytearray(class_defs_off + 32 * n)
+
+  string_offs = []
+  for descriptor, _ in classes:
+    string_offs.append(len(data))
+    data += uleb128(len(descriptor)) + descriptor.encode() + b'\0'
+
+  class_data_offs = []
+  for _, insns_size in classes:
+    while len(data) % 4:
+      data.append(0)
+    code_off = len(data)
+    data += struct.pack('<HHHHII', 1, 0, 0, 0, 0, insns_size)
+    data += b'\0' * (insns_size * 2)
+    class_data_offs.append(len(data))
+    data += uleb128(0) + uleb128(0) + uleb128(1) + uleb128(0)
+    data += uleb128(0) + uleb128(1) + uleb128(code_off)
+
+  data[0:8] = b'dex\n035\0'
+  struct.pack_into('<I', data, 0x20, len(data))
+  struct.pack_into('<II', data, 0x38, n, string_ids_off)
+  struct.pack_into('<II', data, 0x40, n, type_ids_off)
+  struct.pack_into('<II', data, 0x60, n, class_defs_off)
+  for i in range(n):
+    struct.pack_into('<I', data, string_ids_off + 4 * i, string_offs[i])
+    struct.pack_into('<I', data, type_ids_off + 4 * i, i)
+    struct.pack_into('<I', data, class_defs_off + 32 * i, i)
+    struct.pack_into('<I', data, class_defs_off + 32 * i + 24,
+                     class_data_offs[i])
+  return bytes(data)
+
+
+class DexPackageSizesTest(unittest.TestCase):
+
+  def test_packages(self):
+    dex = build_dex([('Lcom/foo/A;', 10), ('Lcom/foo/B;', 2),
+                     ('Lcom/bar/C;', 4), ('LD;', 1)])
+    sizes = apk_size_report.dex_package_sizes(dex)
+    # class_def_item + class_data_item + code_item header and instructions.
+    # The class_data_items are 8 bytes long, as the code offsets are encoded
+    # on 2 bytes.
+    self.assertEqual(sizes['com.foo'], (32 + 8 + 16 + 20) + (32 + 8 + 16 + 4))
+    self.assertEqual(sizes['com.bar'], 32 + 8 + 16 + 8)
+    self.assertEqual(sizes['<default>'], 32 + 8 + 16 + 2)
+    self.assertEqual(sum(sizes.values()), len(dex))
+
+  def test_code_item_with_tries(self):
+    code = struct.pack('<HHHHII', 1, 0, 0, 1, 0, 3) + b'\0' * 6
+    code += b'\0\0'  # padding
+    code += b'\0' * 8  # try_item
+    # One handler with one typed catch and a catch all.
+    code += uleb128(1) + b'\x7f' + uleb128(1) + uleb128(2) + uleb128(3)
+    self.assertEqual(apk_size_report.code_item_size(code, 0), len(code))
+
+
+class CategoryTest(unittest.TestCase):
+
+  def test_category(self):
+    self.assertEqual(apk_size_report.category('classes2.dex'), ('dex', None))
+    self.assertEqual(apk_size_report.category('res/drawable-hdpi/a.png'),
+                     ('resources', 'drawable'))
+    self.assertEqual(apk_size_report.category('resources.arsc'),
+                     ('resources', 'arsc'))
+    self.assertEqual(apk_size_report.category('lib/arm64-v8a/libfoo.so'),
+                     ('native', 'arm64-v8a'))
+    self.assertEqual(apk_size_report.category('assets/dexopt/baseline.prof'),
+                     ('assets', 'dexopt'))
+    self.assertEqual(apk_size_report.category('assets/a.txt'),
+                     ('assets', '<root>'))
+    self.assertEqual(apk_size_report.category('META-INF/CERT.RSA'),
+                     ('other', 'META-INF'))
+
+
+class SizeReportTest(unittest.TestCase):
+
+  def test_report(self):
+    buf = io.BytesIO()
+    dex = build_dex([('Lcom/foo/A;', 10)])
+    with zipfile.ZipFile(buf, 'w') as apk:
+      apk.writestr('classes.dex', dex)
+      apk.writestr('res/layout/main.xml', b'x' * 100)
+      apk.writestr('lib/x86/libfoo.so', b'y' * 50)
+      apk.writestr('AndroidManifest.xml', b'z' * 10)
+
+    with zipfile.ZipFile(buf) as apk:
+      report = apk_size_report.size_report('foo', apk)
+
+    categories = report['categories']
+    self.assertEqual(report['total']['size'], len(dex) + 160)
+    self.assertEqual(categories['dex']['size'], len(dex))
+    self.assertEqual(
+        sum(e['size'] for e in categories['dex']['breakdown'].values()),
+        len(dex))
+    self.assertEqual(categories['resources']['breakdown']['layout']['size'],
+                     100)
+    self.assertEqual(categories['native']['breakdown']['x86']['size'], 50)
+    self.assertEqual(
+        categories['other']['breakdown']['AndroidManifest.xml']['size'], 10)
+    self.assertEqual(categories['assets']['size'], 0)
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,120 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Checks the items bound by bindgen against an expected list.
+
+The items are the public functions, statics, types, constants and modules
+declared at the top level of the bindings generated by bindgen, or in their
+extern blocks, one "<kind> <name>" per line, e.g. "fn foo_open".  The script
+writes the items to --output and fails if they differ from the --expected
+list, which is checked in next to the rust_bindgen module, so that header
+changes that add or remove bound items are reviewed.
+"""
+
+import argparse
+import difflib
+import re
+import sys
+
+# Matches the declaration of a public item.
+ITEM_RE = re.compile(
+    r'^\s*pub\s+(?:unsafe\s+)?(?P<kind>fn|struct|union|enum|type|const|'
+    r'static(?:\s+mut)?|mod)\s+(?P<name>[A-Za-z_][A-Za-z0-9_]*)')
+
+# Matches the string literals, which may contain braces, e.g. in doc comments.
+STRING_RE = re.compile(r'"(?:[^"\\]|\\.)*"')
+
+# Matches the start of an extern block.
+EXTERN_RE = re.compile(r'^\s*(?:pub\s+)?extern\s+"[^"]*"\s*\{')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--bindings', dest='bindings', required=True,
+                      help='the bindings generated by bindgen.')
+  parser.add_argument('--expected', dest='expected', required=True,
+                      help='the expected list of items.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the items of the bindings to.')
+  parser.add_argument('--module', dest='module', default='',
+                      help='name of the rust_bindgen module.')
+  return parser.parse_args()
+
+
+def bound_items(lines):
+  """Returns the sorted items declared by bindings."""
+  items = set()
+  depth = 0
+  # The depths of the extern blocks that are open.
+  extern_depths = []
+  for line in lines:
+    code = STRING_RE.sub('""', line)
+    if code.lstrip().startswith('//'):
+      continue
+    if depth == 0 or (extern_depths and depth == extern_depths[-1]):
+      match = ITEM_RE.match(code)
+      if match:
+        kind = ' '.join(match.group('kind').split())
+        items.add('%s %s' % (kind, match.group('name')))
+    if depth == 0 and EXTERN_RE.match(code):
+      extern_depths.append(depth + 1)
+    depth += code.count('{') - code.count('}')
+    while extern_depths and depth < extern_depths[-1]:
+      extern_depths.pop()
+  return sorted(items)
+
+
+def read_expected(lines):
+  """Returns the items of an expected list, ignoring comments."""
+  items = set()
+  for line in lines:
+    line = line.split('#', 1)[0].strip()
+    if line:
+      items.add(' '.join(line.split()))
+  return sorted(items)
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  with open(args.bindings) as f:
+    items = bound_items(f)
+  with open(args.expected) as f:
+    expected = read_expected(f)
+
+  with open(args.output, 'w') as f:
+    for item in items:
+      f.write(item + '\n')
+
+  if items != expected:
+    print('The items bound by %s differ from %s:' %
+          (args.module or args.bindings, args.expected))
+    for line in difflib.unified_diff(expected, items, args.expected,
+                                     'generated', lineterm=''):
+      print(line)
+    print()
+    print('If the change is intended, update the expected list with:')
+    print('  cp %s %s' % (args.output, args.expected))
+    return 1
+
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,88 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for bindgen_symbols.py."""
+
+import unittest
+
+import bindgen_symbols
+
+BINDINGS = """\
+/* automatically generated by rust-bindgen 0.59.1 */
+
+pub const FOO_MAX: u32 = 16;
+pub type foo_id = ::std::os::raw::c_int;
+#[repr(C)]
+#[derive(Debug, Copy, Clone)]
+pub struct foo {
+    pub id: foo_id,
+    pub name: *const ::std::os::raw::c_char,
+}
+#[doc = "Braces in docs {"]
+pub union foo_data {
+    pub i: u32,
+    pub f: f32,
+}
+impl foo {
+    pub fn bitfield(&self) -> u32 {
+        0
+    }
+}
+pub mod foo_mode {
+    pub type Type = ::std::os::raw::c_uint;
+    pub const FOO_MODE_A: Type = 0;
+}
+extern "C" {
+    pub fn foo_open(name: *const ::std::os::raw::c_char) -> *mut foo;
+}
+extern "C" {
+    pub static mut foo_count: ::std::os::raw::c_int;
+    // pub fn commented_out();
+    pub fn foo_close(foo: *mut foo);
+}
+"""
+
+
+class BindgenSymbolsTest(unittest.TestCase):
+  """Unit tests for bindgen_symbols.py."""
+
+  def test_bound_items(self):
+    self.assertEqual(bindgen_symbols.bound_items(BINDINGS.splitlines()), [
+        'const FOO_MAX',
+        'fn foo_close',
+        'fn foo_open',
+        'mod foo_mode',
+        'static mut foo_count',
+        'struct foo',
+        'type foo_id',
+        'union foo_data',
+    ])
+
+  def test_read_expected(self):
+    expected = [
+        '# Items bound by libfoo_bindgen',
+        'fn foo_open',
+        '',
+        'struct   foo  # the handle',
+        'fn foo_open',
+    ]
+    self.assertEqual(bindgen_symbols.read_expected(expected),
+                     ['fn foo_open', 'struct foo'])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,243 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Detects strong symbols defined by more than one static library of a link.
+
+When two static libraries of a link define the same symbol, the linker silently
+picks the definition of whichever library comes first. This script lists the
+global symbols of the objects and static libraries of the link with llvm-nm,
+works out which archive members the linker pulls in to resolve the undefined
+symbols of the link, and fails if a strong symbol of a pulled in member is also
+defined by another static library. The copies of the objects of a static
+library in the archives that include it with whole_static_libs are not
+reported.
+"""
+
+import argparse
+import subprocess
+import sys
+
+# llvm-nm symbol types of strong definitions: text, data, bss, read-only data
+# and their small data variants.
+STRONG_SYMBOL_TYPES = frozenset('TDBRGS')
+
+# llvm-nm symbol types of undefined symbols. Weak undefined symbols ("w", "v")
+# don't make the linker pull in archive members.
+UNDEFINED_SYMBOL_TYPES = frozenset('U')
+
+# llvm-nm symbol types that are neither definitions nor undefined symbols that
+# the linker resolves.
+IGNORED_SYMBOL_TYPES = frozenset('wvN?')
+
+
+class Member(object):
+  """The global symbols of an object file or archive member."""
+
+  def __init__(self, name):
+    self.name = name
+    self.strong = set()
+    self.defined = set()
+    self.undefined = set()
+
+
+class LinkInput(object):
+  """An object file or static library of the link."""
+
+  def __init__(self, kind, path, dep_path, included_in):
+    self.kind = kind
+    self.path = path
+    self.dep_path = dep_path
+    self.included_in = included_in
+    self.members = []
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--nm', dest='nm', required=True,
+                      help='path to llvm-nm.')
+  parser.add_argument('--name', dest='name', default='',
+                      help='name of the module being linked.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='timestamp file to write if no duplicate is found.')
+  parser.add_argument('link_inputs', help='file listing the inputs of the '
+                      'link in order, one "<object|whole|static>\\t<path>\\t'
+                      '<dependency path>\\t<archives including it>" per line.')
+  return parser.parse_args()
+
+
+def read_link_inputs(path):
+  """Reads the list of objects and static libraries of the link."""
+  link_inputs = []
+  with open(path) as f:
+    for line in f:
+      line = line.rstrip('\n')
+      if not line:
+        continue
+      fields = line.split('\t')
+      fields += [''] * (4 - len(fields))
+      kind, lib, dep_path, included_in = fields[:4]
+      link_inputs.append(LinkInput(kind, lib, dep_path or lib,
+                                   [a for a in included_in.split(',') if a]))
+  return link_inputs
+
+
+def parse_nm_output(output, name):
+  """Returns the members described by the POSIX output of llvm-nm.
+
+  The output of llvm-nm for an archive has a "<archive>[<member>]:" header
+  before the symbols of each member, the output for an object file has no
+  header.
+  """
+  members = []
+  member = None
+  for line in output.splitlines():
+    fields = line.split()
+    if not fields:
+      continue
+    if len(fields) == 1 and fields[0].endswith(':'):
+      member = Member(fields[0][:-1])
+      members.append(member)
+      continue
+    if len(fields) < 2:
+      continue
+    if member is None:
+      member = Member(name)
+      members.append(member)
+    symbol, symbol_type = fields[0], fields[1]
+    if symbol_type in UNDEFINED_SYMBOL_TYPES:
+      member.undefined.add(symbol)
+    elif symbol_type not in IGNORED_SYMBOL_TYPES:
+      member.defined.add(symbol)
+      if symbol_type in STRONG_SYMBOL_TYPES:
+        member.strong.add(symbol)
+  return members
+
+
+def load_members(link_inputs):
+  """Returns the ids of the members that the linker loads.
+
+  The object files and the members of whole static libraries are always
+  loaded. A member of a static library is loaded when it defines a symbol that
+  the loaded members leave undefined, from the first static library of the link
+  that defines it.
+  """
+  loaded = set()
+  lazy = []
+  for link_input in link_inputs:
+    for member in link_input.members:
+      if link_input.kind == 'static':
+        lazy.append(member)
+      else:
+        loaded.add(id(member))
+  members = {id(m): m for i in link_inputs for m in i.members}
+
+  while True:
+    defined = set()
+    undefined = set()
+    for member_id in loaded:
+      defined |= members[member_id].defined
+      undefined |= members[member_id].undefined
+    undefined -= defined
+    pulled = [m for m in lazy
+              if id(m) not in loaded and m.defined & undefined]
+    if not pulled:
+      return loaded
+    # Only pull in the first definition of each symbol.
+    for member in pulled:
+      if member.defined & undefined:
+        loaded.add(id(member))
+        undefined -= member.defined
+
+
+def included_archives(link_inputs):
+  """Returns the archives that include the objects of each static library."""
+  direct = {i.path: set(i.included_in) for i in link_inputs}
+  closure = {}
+  for path in direct:
+    archives = set()
+    pending = list(direct[path])
+    while pending:
+      archive = pending.pop()
+      if archive not in archives:
+        archives.add(archive)
+        pending.extend(direct.get(archive, ()))
+    closure[path] = archives
+  return closure
+
+
+def find_duplicates(link_inputs, loaded):
+  """Returns the pulled in symbols defined by more than one static library.
+
+  Args:
+    link_inputs: list of LinkInput, in the order of the link.
+    loaded: set of the ids of the loaded members.
+
+  Returns:
+    A dictionary from each duplicated symbol to the sorted list of dependency
+    paths of the libraries defining it.
+  """
+  libs = [i for i in link_inputs if i.kind != 'object']
+  included_in = included_archives(libs)
+
+  pulled_in = set()
+  definitions = {}
+  for lib in libs:
+    for member in lib.members:
+      if id(member) in loaded:
+        pulled_in |= member.strong
+      for symbol in member.strong:
+        definitions.setdefault(symbol, set()).add(lib.path)
+
+  dep_paths = {lib.path: lib.dep_path for lib in libs}
+  duplicates = {}
+  for symbol in pulled_in:
+    paths = definitions[symbol]
+    # A static library copied into another archive with whole_static_libs
+    # defines the same symbols as that archive.
+    paths = set(p for p in paths if not included_in[p] & paths)
+    if len(paths) > 1:
+      duplicates[symbol] = sorted(dep_paths[p] for p in paths)
+  return duplicates
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  link_inputs = read_link_inputs(args.link_inputs)
+  for link_input in link_inputs:
+    output = subprocess.check_output(
+        [args.nm, '--extern-only', '--format=posix', link_input.path],
+        universal_newlines=True)
+    link_input.members = parse_nm_output(output, link_input.path)
+
+  duplicates = find_duplicates(link_inputs, load_members(link_inputs))
+  if duplicates:
+    for symbol in sorted(duplicates):
+      print('error: %s: symbol %s is defined by several static libraries:' %
+            (args.name, symbol), file=sys.stderr)
+      for dep_path in duplicates[symbol]:
+        print('    %s' % dep_path, file=sys.stderr)
+    sys.exit(1)
+
+  with open(args.output, 'w'):
+    pass
+
+
+if __name__ == '__main__':
+  main()
@@ -0,0 +1,173 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for check_duplicate_static_symbols.py."""
+
+import unittest
+
+import check_duplicate_static_symbols
+from check_duplicate_static_symbols import LinkInput, Member
+
+
+def member(name, strong=(), weak=(), undefined=()):
+  """Returns a member defining the given symbols."""
+  m = Member(name)
+  m.strong = set(strong)
+  m.defined = set(strong) | set(weak)
+  m.undefined = set(undefined)
+  return m
+
+
+def link_input(kind, path, members, included_in=()):
+  """Returns a link input with the given members."""
+  i = LinkInput(kind, path, 'bin -> ' + path, list(included_in))
+  i.members = members
+  return i
+
+
+class ParseNmOutputTest(unittest.TestCase):
+  """Unit tests for parse_nm_output function."""
+
+  def test_archive(self):
+    output = ('libfoo.a[foo.o]:\n'
+              'foo T 0 10\n'
+              'foo_data D 0 4\n'
+              'foo_inline W 0 8\n'
+              'foo_common C 4 4\n'
+              'bar U\n'
+              'maybe w\n'
+              '\n'
+              'libfoo.a[bar.o]:\n'
+              'bar_bss B 0 4\n')
+    members = check_duplicate_static_symbols.parse_nm_output(output,
+                                                             'libfoo.a')
+    self.assertEqual([m.name for m in members],
+                     ['libfoo.a[foo.o]', 'libfoo.a[bar.o]'])
+    self.assertEqual(members[0].strong, {'foo', 'foo_data'})
+    self.assertEqual(members[0].defined,
+                     {'foo', 'foo_data', 'foo_inline', 'foo_common'})
+    self.assertEqual(members[0].undefined, {'bar'})
+    self.assertEqual(members[1].strong, {'bar_bss'})
+
+  def test_object(self):
+    output = ('main T 0 10\n'
+              'foo U\n')
+    members = check_duplicate_static_symbols.parse_nm_output(output, 'main.o')
+    self.assertEqual([m.name for m in members], ['main.o'])
+    self.assertEqual(members[0].strong, {'main'})
+    self.assertEqual(members[0].undefined, {'foo'})
+
+
+class LoadMembersTest(unittest.TestCase):
+  """Unit tests for load_members function."""
+
+  def test_pulls_in_needed_members(self):
+    main = member('main.o', strong=['main'], undefined=['foo'])
+    foo = member('liba.a[foo.o]', strong=['foo'], undefined=['bar'])
+    unused = member('liba.a[unused.o]', strong=['unused'])
+    bar = member('libb.a[bar.o]', strong=['bar'])
+    whole = member('libw.a[w.o]', strong=['w'])
+    link_inputs = [
+        link_input('object', 'main.o', [main]),
+        link_input('whole', 'libw.a', [whole]),
+        link_input('static', 'liba.a', [foo, unused]),
+        link_input('static', 'libb.a', [bar]),
+    ]
+    loaded = check_duplicate_static_symbols.load_members(link_inputs)
+    self.assertEqual(loaded, {id(main), id(whole), id(foo), id(bar)})
+
+  def test_first_definition(self):
+    main = member('main.o', strong=['main'], undefined=['foo'])
+    foo_a = member('liba.a[foo.o]', strong=['foo'])
+    foo_b = member('libb.a[foo.o]', strong=['foo'])
+    link_inputs = [
+        link_input('object', 'main.o', [main]),
+        link_input('static', 'liba.a', [foo_a]),
+        link_input('static', 'libb.a', [foo_b]),
+    ]
+    loaded = check_duplicate_static_symbols.load_members(link_inputs)
+    self.assertEqual(loaded, {id(main), id(foo_a)})
+
+
+class FindDuplicatesTest(unittest.TestCase):
+  """Unit tests for find_duplicates function."""
+
+  def find_duplicates(self, link_inputs):
+    loaded = check_duplicate_static_symbols.load_members(link_inputs)
+    return check_duplicate_static_symbols.find_duplicates(link_inputs, loaded)
+
+  def test_no_duplicates(self):
+    link_inputs = [
+        link_input('object', 'main.o',
+                   [member('main.o', strong=['main'], undefined=['a', 'b'])]),
+        link_input('static', 'liba.a', [member('liba.a[a.o]', strong=['a'])]),
+        link_input('static', 'libb.a', [member('libb.a[b.o]', strong=['b'])]),
+    ]
+    self.assertEqual(self.find_duplicates(link_inputs), {})
+
+  def test_duplicates(self):
+    link_inputs = [
+        link_input('object', 'main.o',
+                   [member('main.o', strong=['main'], undefined=['dup'])]),
+        link_input('static', 'liba.a',
+                   [member('liba.a[a.o]', strong=['a', 'dup'])]),
+        link_input('static', 'libc.a',
+                   [member('libc.a[c.o]', strong=['c', 'dup'])]),
+    ]
+    self.assertEqual(self.find_duplicates(link_inputs),
+                     {'dup': ['bin -> liba.a', 'bin -> libc.a']})
+
+  def test_members_not_pulled_in(self):
+    link_inputs = [
+        link_input('object', 'main.o', [member('main.o', strong=['main'])]),
+        link_input('static', 'liba.a',
+                   [member('liba.a[a.o]', strong=['a', 'dup'])]),
+        link_input('static', 'libc.a',
+                   [member('libc.a[c.o]', strong=['c', 'dup'])]),
+    ]
+    self.assertEqual(self.find_duplicates(link_inputs), {})
+
+  def test_whole_static_libs_copy(self):
+    # liba includes libb with whole_static_libs, and the link has both.
+    link_inputs = [
+        link_input('object', 'main.o',
+                   [member('main.o', strong=['main'], undefined=['a', 'b'])]),
+        link_input('static', 'liba.a', [
+            member('liba.a[a.o]', strong=['a'], undefined=['b']),
+            member('liba.a[b.o]', strong=['b']),
+        ]),
+        link_input('static', 'libb.a', [member('libb.a[b.o]', strong=['b'])],
+                   included_in=['liba.a']),
+    ]
+    self.assertEqual(self.find_duplicates(link_inputs), {})
+
+  def test_whole_static_libs_copy_with_conflict(self):
+    # The copy of libb in liba is not reported, the conflict with libc is.
+    link_inputs = [
+        link_input('object', 'main.o',
+                   [member('main.o', strong=['main'], undefined=['b'])]),
+        link_input('static', 'liba.a', [member('liba.a[b.o]', strong=['b'])]),
+        link_input('static', 'libb.a', [member('libb.a[b.o]', strong=['b'])],
+                   included_in=['liba.a']),
+        link_input('static', 'libc.a', [member('libc.a[c.o]', strong=['b'])]),
+    ]
+    self.assertEqual(self.find_duplicates(link_inputs),
+                     {'b': ['bin -> liba.a', 'bin -> libc.a']})
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,179 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Converts the Error Prone findings of a module to SARIF and checks budgets.
+
+The input is the javac log of a compilation with Error Prone, written with
+-Xstdout.  The findings are written to a SARIF file.  The severity of each check
+is the kind of the javac diagnostic: Error Prone reports the findings of the
+checks with the ERROR severity as errors, and the others as warnings.
+
+The script fails if a check has more findings than it is allowed with
+--allowed_warnings <check>:<count>, which lets modules reduce the number of
+findings of a check over time without making the check an error.  Findings
+reported as errors are only accepted within the budget of their check; javac
+fails the compilation on them anyway, before the log reaches the script.
+"""
+
+import argparse
+import collections
+import json
+import re
+import sys
+
+# Matches the first line of a javac diagnostic reported by Error Prone, e.g.
+# foo/Foo.java:12: warning: [MissingOverride] bar implements method in Bar
+FINDING_RE = re.compile(
+    r'^(?P<file>[^:\s][^:]*):(?P<line>\d+): (?P<kind>warning|error): '
+    r'\[(?P<check>\w+)\] (?P<message>.*)$')
+
+# The Error Prone severity of each kind of javac diagnostic.
+SEVERITIES = {'error': 'ERROR', 'warning': 'WARN'}
+
+Finding = collections.namedtuple(
+    'Finding', ['file', 'line', 'check', 'severity', 'message'])
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--name', dest='name', required=True,
+                      help='name of the module.')
+  parser.add_argument('--log', dest='log', required=True,
+                      help='javac log of the Error Prone compilation.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='SARIF file to write the findings to.')
+  parser.add_argument('--allowed_warnings', dest='allowed_warnings',
+                      action='append', default=[],
+                      help='<check>:<count>, the number of findings allowed '
+                      'for a check.')
+  return parser.parse_args()
+
+
+def parse_findings(lines):
+  """Returns the Error Prone findings of a javac log."""
+  findings = []
+  for line in lines:
+    match = FINDING_RE.match(line.rstrip('\n'))
+    if match:
+      findings.append(Finding(match.group('file'), int(match.group('line')),
+                              match.group('check'),
+                              SEVERITIES[match.group('kind')],
+                              match.group('message')))
+  return findings
+
+
+def parse_allowed_warnings(allowed_warnings):
+  """Returns the number of findings allowed for each check."""
+  allowed = {}
+  for value in allowed_warnings:
+    check, _, count = value.rpartition(':')
+    if not check or not count.isdigit():
+      raise ValueError('invalid --allowed_warnings %r, expected '
+                       '<check>:<count>' % value)
+    allowed[check] = int(count)
+  return allowed
+
+
+def sarif_level(severity):
+  """Converts an Error Prone severity to a SARIF level."""
+  return {'ERROR': 'error', 'WARN': 'warning'}.get(severity, 'note')
+
+
+def to_sarif(name, findings):
+  """Returns the SARIF document for the findings of a module."""
+  checks = sorted(set(f.check for f in findings))
+  results = []
+  for f in findings:
+    results.append({
+        'ruleId': f.check,
+        'ruleIndex': checks.index(f.check),
+        'level': sarif_level(f.severity),
+        'message': {'text': f.message},
+        'locations': [{
+            'physicalLocation': {
+                'artifactLocation': {'uri': f.file},
+                'region': {'startLine': f.line},
+            },
+        }],
+    })
+  return {
+      '$schema': 'https://json.schemastore.org/sarif-2.1.0.json',
+      'version': '2.1.0',
+      'runs': [{
+          'tool': {
+              'driver': {
+                  'name': 'Error Prone',
+                  'informationUri': 'https://errorprone.info',
+                  'rules': [{'id': check} for check in checks],
+              },
+          },
+          'properties': {'module': name},
+          'results': results,
+      }],
+  }
+
+
+def check_budgets(findings, allowed):
+  """Returns the error messages for the checks that exceed their budget."""
+  counts = collections.Counter(f.check for f in findings)
+  severities = {f.check: f.severity for f in findings}
+  errors = []
+  for check in sorted(counts):
+    count = counts[check]
+    if check in allowed:
+      if count > allowed[check]:
+        errors.append('%s: %d findings, only %d allowed' %
+                      (check, count, allowed[check]))
+    elif severities.get(check) == 'ERROR':
+      errors.append('%s: %d findings, the check is an error' % (check, count))
+  return errors
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  try:
+    with open(args.log) as f:
+      findings = parse_findings(f)
+  except FileNotFoundError:
+    # javac does not run, and does not write a log, for modules without sources.
+    findings = []
+
+  allowed = parse_allowed_warnings(args.allowed_warnings)
+
+  with open(args.output, 'w') as f:
+    json.dump(to_sarif(args.name, findings), f, indent=2, sort_keys=True)
+
+  errors = check_budgets(findings, allowed)
+  if errors:
+    failed = set(e.split(':')[0] for e in errors)
+    for f in findings:
+      if f.check in failed:
+        print('%s:%d: [%s] %s' % (f.file, f.line, f.check, f.message))
+    print()
+    print('Error Prone findings of %s are over budget:' % args.name)
+    for error in errors:
+      print('  ' + error)
+    return 1
+
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,96 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for errorprone_report.py."""
+
+import unittest
+
+import errorprone_report
+from errorprone_report import Finding
+
+LOG = """\
+foo/Foo.java:12: warning: [MissingOverride] bar implements method in Bar; expected @Override
+  void bar() {}
+       ^
+    (see https://errorprone.info/bugpattern/MissingOverride)
+  Did you mean '@Override void bar() {}'?
+foo/Foo.java:20: error: [DeadException] Exception created but not thrown
+foo/Foo.java:30: warning: [MissingOverride] baz implements method in Bar; expected @Override
+Note: Some input files use unchecked or unsafe operations.
+1 error
+2 warnings
+"""
+
+
+class ErrorproneReportTest(unittest.TestCase):
+  """Unit tests for errorprone_report.py."""
+
+  def test_parse_findings(self):
+    findings = errorprone_report.parse_findings(LOG.splitlines(True))
+    self.assertEqual(findings, [
+        Finding('foo/Foo.java', 12, 'MissingOverride', 'WARN',
+                'bar implements method in Bar; expected @Override'),
+        Finding('foo/Foo.java', 20, 'DeadException', 'ERROR',
+                'Exception created but not thrown'),
+        Finding('foo/Foo.java', 30, 'MissingOverride', 'WARN',
+                'baz implements method in Bar; expected @Override'),
+    ])
+
+  def test_parse_allowed_warnings(self):
+    self.assertEqual(
+        errorprone_report.parse_allowed_warnings(['MissingOverride:2']),
+        {'MissingOverride': 2})
+    with self.assertRaises(ValueError):
+      errorprone_report.parse_allowed_warnings(['MissingOverride'])
+
+  def test_check_budgets(self):
+    findings = errorprone_report.parse_findings(LOG.splitlines(True))
+    warnings = [f for f in findings if f.severity == 'WARN']
+
+    self.assertEqual(errorprone_report.check_budgets(warnings, {}), [])
+    self.assertEqual(
+        errorprone_report.check_budgets(warnings, {'MissingOverride': 2}), [])
+    self.assertEqual(
+        errorprone_report.check_budgets(warnings, {'MissingOverride': 1}),
+        ['MissingOverride: 2 findings, only 1 allowed'])
+    self.assertEqual(
+        errorprone_report.check_budgets(findings, {}),
+        ['DeadException: 1 findings, the check is an error'])
+    self.assertEqual(
+        errorprone_report.check_budgets(findings, {'DeadException': 1}), [])
+
+  def test_to_sarif(self):
+    findings = errorprone_report.parse_findings(LOG.splitlines(True))
+    sarif = errorprone_report.to_sarif('foo', findings)
+    run = sarif['runs'][0]
+    self.assertEqual(sarif['version'], '2.1.0')
+    self.assertEqual(run['properties'], {'module': 'foo'})
+    self.assertEqual(run['tool']['driver']['rules'],
+                     [{'id': 'DeadException'}, {'id': 'MissingOverride'}])
+    self.assertEqual([(r['ruleId'], r['ruleIndex'], r['level'])
+                      for r in run['results']],
+                     [('MissingOverride', 1, 'warning'),
+                      ('DeadException', 0, 'error'),
+                      ('MissingOverride', 1, 'warning')])
+    self.assertEqual(run['results'][1]['locations'][0]['physicalLocation'], {
+        'artifactLocation': {'uri': 'foo/Foo.java'},
+        'region': {'startLine': 20},
+    })
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,190 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+"""
+Explain why a member of the bootclasspath has its hidden API flags.
+
+Reads the hiddenapi-explain.json manifest written by the platform_bootclasspath
+module, built by m hiddenapi-explain, and reports for a member signature the
+module and bootclasspath_fragment that provide it, the stub API scopes that
+expose it, the annotations and flag files that list it, and which of those
+determined each of its final flags.
+"""
+
+import argparse
+import csv
+import json
+import sys
+import zipfile
+
+# The flags assigned by each category of flag file, see HiddenAPIFlagFileCategories in
+# java/hiddenapi_modular.go.
+CATEGORY_FLAGS = {
+    'unsupported': 'unsupported',
+    'removed': 'unsupported',
+    'max_target_r_low_priority': 'max-target-r',
+    'max_target_q': 'max-target-q',
+    'max_target_p': 'max-target-p',
+    'max_target_o_low_priority': 'max-target-o',
+    'blocked': 'blocked',
+    'unsupported_packages': 'unsupported',
+}
+
+# The tags added to the flags assigned by some categories of flag file.
+CATEGORY_TAGS = {
+    'removed': 'removed',
+    'max_target_r_low_priority': 'lo-prio',
+    'max_target_o_low_priority': 'lo-prio',
+}
+
+# Categories whose files list packages instead of signatures.
+PACKAGE_CATEGORIES = {'unsupported_packages'}
+
+# The flags from the stub flags file that cause a member to be in the sdk.
+SDK_STUB_FLAGS = {'public-api', 'system-api'}
+
+
+def read_flags(path, signature):
+    """Returns the flags of signature in a hidden API CSV file, or None."""
+    with open(path, 'r') as f:
+        for row in csv.reader(f, delimiter=',', quotechar='|'):
+            if row and row[0] == signature:
+                return [flag for flag in row[1:] if flag]
+    return None
+
+
+def read_lines(path):
+    """Returns the lines of a flag file, without comments and blank lines."""
+    with open(path, 'r') as f:
+        lines = [line.strip() for line in f]
+    return [line for line in lines if line and not line.startswith('#')]
+
+
+def class_of(signature):
+    """Returns the class descriptor of a member signature, e.g. Lfoo/Bar;."""
+    return signature.split(';->')[0] + ';'
+
+
+def package_of(signature):
+    """Returns the Java package of a member signature, e.g. foo."""
+    return class_of(signature)[1:-1].rpartition('/')[0].replace('/', '.')
+
+
+def find_providers(modules, signature, open_zip=zipfile.ZipFile):
+    """Returns the modules whose classes jars contain the class of signature."""
+    entry = class_of(signature)[1:-1] + '.class'
+    providers = []
+    for module in modules:
+        for jar in module.get('classes_jars') or []:
+            with open_zip(jar) as z:
+                if entry in z.namelist():
+                    providers.append(module)
+                    break
+    return providers
+
+
+def find_flag_files(flag_files, signature):
+    """Returns the flag files that list signature or its package."""
+    matches = []
+    for flag_file in flag_files:
+        if flag_file['category'] in PACKAGE_CATEGORIES:
+            key = package_of(signature)
+        else:
+            key = signature
+        if key in read_lines(flag_file['path']):
+            matches.append(flag_file)
+    return matches
+
+
+def explain(manifest, signature, open_zip=zipfile.ZipFile):
+    """Returns a textual explanation of the flags of signature."""
+    lines = ['signature: %s' % signature]
+
+    final_flags = read_flags(manifest['flags'], signature)
+    if final_flags is None:
+        lines.append('not found in %s: the member is not on the bootclasspath'
+                     % manifest['flags'])
+        return '\n'.join(lines) + '\n'
+    lines.append('final flags: %s' % ','.join(final_flags))
+
+    providers = find_providers(manifest['modules'], signature, open_zip)
+    for module in providers:
+        fragment = module.get('fragment') or '<none>'
+        lines.append('provided by: module %s, bootclasspath_fragment %s' %
+                     (module['name'], fragment))
+    if not providers:
+        lines.append('provided by: <unknown>')
+
+    stub_flags = read_flags(manifest['stub_flags'], signature) or []
+    lines.append('stub scopes: %s' % (','.join(stub_flags) or '<none>'))
+
+    # The sources of each flag: (flag, description) tuples.
+    sources = [(flag, 'stub scopes in %s' % manifest['stub_flags'])
+               for flag in stub_flags]
+    if SDK_STUB_FLAGS.intersection(stub_flags):
+        sources.append(('sdk', 'public or system stub scope in %s' %
+                        manifest['stub_flags']))
+
+    for path in manifest['annotation_flags']:
+        flags = read_flags(path, signature)
+        if flags:
+            lines.append('annotations: %s in %s' % (','.join(flags), path))
+            sources.extend((flag, 'annotation in %s' % path) for flag in flags)
+
+    for flag_file in find_flag_files(manifest['flag_files'], signature):
+        lines.append('flag file: %s (%s)' % (flag_file['path'],
+                                             flag_file['category']))
+        description = '%s flag file %s' % (flag_file['category'],
+                                           flag_file['path'])
+        sources.append((CATEGORY_FLAGS[flag_file['category']], description))
+        if flag_file['category'] in CATEGORY_TAGS:
+            sources.append((CATEGORY_TAGS[flag_file['category']], description))
+
+    lines.append('explanation:')
+    for flag in final_flags:
+        reasons = [description for f, description in sources if f == flag]
+        if reasons:
+            for reason in reasons:
+                lines.append('  %s: from %s' % (flag, reason))
+        elif flag == 'blocked':
+            lines.append('  blocked: not exposed by any stub scope and not '
+                         'assigned another flag by an annotation or a flag '
+                         'file')
+        else:
+            lines.append('  %s: <unknown>' % flag)
+
+    return '\n'.join(lines) + '\n'
+
+
+def main(args):
+    args_parser = argparse.ArgumentParser(
+        description='Explain the hidden API flags of bootclasspath members.')
+    args_parser.add_argument(
+        '--manifest', default='out/soong/hiddenapi/hiddenapi-explain.json',
+        help='The manifest built by m hiddenapi-explain')
+    args_parser.add_argument('signatures', nargs='+',
+                             help='Dex signatures of members, e.g. '
+                             'Ljava/lang/Object;->hashCode()I')
+    args = args_parser.parse_args(args)
+
+    with open(args.manifest, 'r') as f:
+        manifest = json.load(f)
+
+    for signature in args.signatures:
+        sys.stdout.write(explain(manifest, signature))
+
+
+if __name__ == '__main__':
+    main(sys.argv[1:])
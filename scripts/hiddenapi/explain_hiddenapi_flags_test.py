@@ -0,0 +1,103 @@
+#!/usr/bin/env python
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the 'License');
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an 'AS IS' BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Unit tests for explain_hiddenapi_flags.py."""
+import os
+import shutil
+import tempfile
+import unittest
+import zipfile
+
+from explain_hiddenapi_flags import explain, package_of
+
+
+class TestExplainHiddenapiFlags(unittest.TestCase):
+
+    def setUp(self):
+        self.tmp = tempfile.mkdtemp()
+
+    def tearDown(self):
+        shutil.rmtree(self.tmp)
+
+    def write(self, name, contents):
+        path = os.path.join(self.tmp, name)
+        with open(path, 'w') as f:
+            f.write(contents)
+        return path
+
+    def manifest(self):
+        jar = os.path.join(self.tmp, 'foo.jar')
+        with zipfile.ZipFile(jar, 'w') as z:
+            z.writestr('foo/Foo.class', b'')
+        return {
+            'stub_flags': self.write('stub-flags.csv',
+                'Lfoo/Foo;->api()V,public-api,system-api,test-api\n'
+                'Lfoo/Foo;->hidden()V\n'
+                'Lfoo/Foo;->max()V\n'
+                'Lfoo/Foo;->pkg()V\n'),
+            'flags': self.write('all-flags.csv',
+                'Lfoo/Foo;->api()V,public-api,sdk,system-api,test-api\n'
+                'Lfoo/Foo;->hidden()V,blocked\n'
+                'Lfoo/Foo;->max()V,max-target-o,lo-prio\n'
+                'Lfoo/Foo;->pkg()V,unsupported\n'),
+            'annotation_flags': [self.write('annotation-flags.csv',
+                'Lfoo/Foo;->max()V,max-target-o\n')],
+            'flag_files': [
+                {'category': 'unsupported_packages',
+                 'path': self.write('packages.txt', '# comment\nfoo\n')},
+                {'category': 'max_target_o_low_priority',
+                 'path': self.write('max-target-o.txt', 'Lfoo/Foo;->max()V\n')},
+            ],
+            'modules': [
+                {'name': 'bar', 'fragment': 'bar-fragment', 'classes_jars': None},
+                {'name': 'foo', 'fragment': 'foo-fragment', 'classes_jars': [jar]},
+            ],
+        }
+
+    def test_package_of(self):
+        self.assertEqual('foo.bar', package_of('Lfoo/bar/Baz$Inner;->f:I'))
+        self.assertEqual('', package_of('LFoo;->f:I'))
+
+    def test_api(self):
+        text = explain(self.manifest(), 'Lfoo/Foo;->api()V')
+        self.assertIn('provided by: module foo, bootclasspath_fragment foo-fragment\n', text)
+        self.assertIn('stub scopes: public-api,system-api,test-api\n', text)
+        self.assertIn('  sdk: from public or system stub scope in', text)
+
+    def test_blocked(self):
+        text = explain(self.manifest(), 'Lfoo/Foo;->hidden()V')
+        self.assertIn('final flags: blocked\n', text)
+        self.assertIn('stub scopes: <none>\n', text)
+        self.assertIn('  blocked: not exposed by any stub scope', text)
+
+    def test_flag_files_and_annotations(self):
+        text = explain(self.manifest(), 'Lfoo/Foo;->max()V')
+        self.assertIn('annotations: max-target-o in', text)
+        self.assertIn('  max-target-o: from annotation in', text)
+        self.assertIn('  max-target-o: from max_target_o_low_priority flag file', text)
+        self.assertIn('  lo-prio: from max_target_o_low_priority flag file', text)
+
+    def test_packages(self):
+        text = explain(self.manifest(), 'Lfoo/Foo;->pkg()V')
+        self.assertIn('  unsupported: from unsupported_packages flag file', text)
+
+    def test_missing(self):
+        text = explain(self.manifest(), 'Lfoo/Foo;->missing()V')
+        self.assertIn('the member is not on the bootclasspath', text)
+
+
+if __name__ == '__main__':
+    unittest.main(verbosity=2)
@@ -0,0 +1,87 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Extracts the javac time of each java module from the .ninja_log of a build.
+
+The output lists one "<module> <seconds>" line per module, and is meant to be
+passed to a later build with SOONG_JAVAC_COMPILE_TIMES so that Soong can choose
+the number of javac shards of each module from its javac time.  The time of a
+sharded module is the sum of the time of its shards, and the time of a module
+with several variants is the time of its slowest variant.
+"""
+
+import argparse
+import re
+import sys
+
+# Matches the outputs of the javac rules, which are
+# .intermediates/<dir>/<module>/<variant>/javac/<jar>[<shard>].
+JAVAC_OUTPUT_RE = re.compile(
+    r'(?:^|/)\.intermediates/(?:.*/)?([^/]+)/([^/]+)/javac/[^/]+\.jar\d*$')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the javac times to.')
+  parser.add_argument('ninja_log', help='path to the .ninja_log of a build.')
+  return parser.parse_args()
+
+
+def javac_times(lines):
+  """Returns the javac time in seconds of each module of a .ninja_log."""
+  # A .ninja_log accumulates the entries of successive builds, only keep the
+  # most recent entry of each output.
+  durations = {}
+  for line in lines:
+    if line.startswith('#'):
+      continue
+    fields = line.rstrip('\n').split('\t')
+    if len(fields) != 5:
+      continue
+    start, end, _, output, _ = fields
+    durations[output] = int(end) - int(start)
+
+  variant_times = {}
+  for output, duration in durations.items():
+    match = JAVAC_OUTPUT_RE.search(output)
+    if not match:
+      continue
+    key = match.group(1, 2)
+    variant_times[key] = variant_times.get(key, 0) + duration
+
+  times = {}
+  for (module, _), duration in variant_times.items():
+    times[module] = max(times.get(module, 0), duration / 1000.0)
+  return times
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  with open(args.ninja_log) as f:
+    times = javac_times(f)
+
+  with open(args.output, 'w') as f:
+    for module in sorted(times):
+      f.write('%s %.1f\n' % (module, times[module]))
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,45 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for javac_compile_times.py."""
+
+import unittest
+
+import javac_compile_times
+
+
+class JavacTimesTest(unittest.TestCase):
+  """Unit tests for javac_times function."""
+
+  def test_javac_times(self):
+    lines = [
+        '# ninja log v5\n',
+        # An older entry superseded by the next one.
+        '0\t90000\t0\tout/soong/.intermediates/a/foo/android_common/javac/foo.jar\t1\n',
+        '0\t20000\t0\tout/soong/.intermediates/a/foo/android_common/javac/foo.jar\t1\n',
+        '0\t1500\t0\tout/soong/.intermediates/bar/android_common/javac/bar.jar0\t1\n',
+        '0\t2500\t0\tout/soong/.intermediates/bar/android_common/javac/bar.jar1\t1\n',
+        '0\t3000\t0\tout/soong/.intermediates/bar/linux_glibc_common/javac/bar.jar\t1\n',
+        '0\t9000\t0\tout/soong/.intermediates/bar/android_common/turbine/bar.jar\t1\n',
+        '0\t9000\t0\tout/soong/.intermediates/bar/android_common/kotlin/bar.jar\t1\n',
+    ]
+    self.assertEqual(javac_compile_times.javac_times(lines),
+                     {'foo': 20.0, 'bar': 4.0})
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,84 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Lists the issues of a lint baseline that lint no longer reports.
+
+The reference baseline is written by lint with --write-reference-baseline, and
+contains all the issues that lint found in the module, including the ones that
+were filtered by the baseline.  Issues of the baseline that are missing from the
+reference baseline have been fixed and can be removed from the baseline.  Like
+lint, issues are matched by id, message and file, ignoring line numbers.
+"""
+
+import argparse
+import collections
+import sys
+from xml.dom import minidom
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--name', dest='name', required=True,
+                      help='name of the module.')
+  parser.add_argument('--baseline', dest='baseline', required=True,
+                      help='the baseline of the module.')
+  parser.add_argument('--reference', dest='reference', required=True,
+                      help='the reference baseline written by lint.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the stale issues to.')
+  return parser.parse_args()
+
+
+def baseline_issues(doc):
+  """Returns the (id, message, file) of the issues of a baseline document."""
+  issues = []
+  for issue in doc.getElementsByTagName('issue'):
+    locations = issue.getElementsByTagName('location')
+    location = locations[0].getAttribute('file') if locations else ''
+    issues.append((issue.getAttribute('id'), issue.getAttribute('message'),
+                   location))
+  return issues
+
+
+def stale_issues(baseline, reference):
+  """Returns the issues of baseline that are not in reference."""
+  remaining = collections.Counter(reference)
+  stale = []
+  for issue in baseline:
+    if remaining[issue] > 0:
+      remaining[issue] -= 1
+    else:
+      stale.append(issue)
+  return stale
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  baseline = baseline_issues(minidom.parse(args.baseline))
+  reference = baseline_issues(minidom.parse(args.reference))
+
+  with open(args.output, 'w') as f:
+    for issue_id, message, location in stale_issues(baseline, reference):
+      f.write('%s: %s: %s: %s: %s\n' % (args.name, args.baseline, location,
+                                        issue_id, message))
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,76 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for lint_stale_baseline.py."""
+
+import unittest
+from xml.dom import minidom
+
+import lint_stale_baseline
+
+
+BASELINE = """<?xml version="1.0" encoding="UTF-8"?>
+<issues format="5" by="lint 4.1.0" client="cli" variant="all" version="4.1.0">
+    <issue id="NewApi" message="Call requires API level 30" errorLine1="foo()">
+        <location file="src/Foo.java" line="10" column="5"/>
+    </issue>
+    <issue id="NewApi" message="Call requires API level 30" errorLine1="foo()">
+        <location file="src/Foo.java" line="20" column="5"/>
+    </issue>
+    <issue id="UnusedResources" message="The resource R.string.bar appears to be unused">
+        <location file="res/values/strings.xml" line="3"/>
+    </issue>
+</issues>
+"""
+
+REFERENCE = """<?xml version="1.0" encoding="UTF-8"?>
+<issues format="5" by="lint 4.1.0" client="cli" variant="all" version="4.1.0">
+    <issue id="NewApi" message="Call requires API level 30" errorLine1="foo()">
+        <location file="src/Foo.java" line="12" column="5"/>
+    </issue>
+    <issue id="SetTextI18n" message="Do not concatenate text">
+        <location file="src/Bar.java" line="7"/>
+    </issue>
+</issues>
+"""
+
+
+class StaleIssuesTest(unittest.TestCase):
+  """Unit tests for stale_issues function."""
+
+  def test_baseline_issues(self):
+    issues = lint_stale_baseline.baseline_issues(minidom.parseString(REFERENCE))
+    self.assertEqual(issues, [
+        ('NewApi', 'Call requires API level 30', 'src/Foo.java'),
+        ('SetTextI18n', 'Do not concatenate text', 'src/Bar.java'),
+    ])
+
+  def test_stale_issues(self):
+    baseline = lint_stale_baseline.baseline_issues(
+        minidom.parseString(BASELINE))
+    reference = lint_stale_baseline.baseline_issues(
+        minidom.parseString(REFERENCE))
+    # One of the two NewApi issues in Foo.java was fixed, the other one moved.
+    self.assertEqual(lint_stale_baseline.stale_issues(baseline, reference), [
+        ('NewApi', 'Call requires API level 30', 'src/Foo.java'),
+        ('UnusedResources', 'The resource R.string.bar appears to be unused',
+         'res/values/strings.xml'),
+    ])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
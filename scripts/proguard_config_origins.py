@@ -0,0 +1,169 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+"""Merges the proguard flag files of a module, annotating each rule with its origin.
+
+The sources file lists the inputs of the R8 configuration of a module in order,
+one per line, as tab separated fields:
+  file<TAB><origin module><TAB><path of a flag file>
+  flag<TAB><origin module><TAB><inline flags>
+
+Files included with -include or @ are expanded in place, relative to the
+directory of the including file.  All the files that are read, including the
+included ones, are listed in the depfile of the output when --depfile is set.  The merged configuration starts with a summary
+of the rules that disable shrinking, optimization or obfuscation, or that keep
+all classes, so that the dependency that disabled shrinking can be found.
+"""
+
+import argparse
+import os
+import re
+import sys
+
+# Rules that disable shrinking, optimization or obfuscation of the whole app.
+_GLOBAL_RULE_RE = re.compile(
+    r'^-(dontshrink|dontoptimize|dontobfuscate)\b|'
+    r'^-keep\S*\s+(?:[\w!,]+\s+)*class\s+\*\*?(?:\s*\{|\s*$)')
+
+_INCLUDE_RE = re.compile(r'^(?:-include\s+|@)(\S+)$')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--name', dest='name', required=True,
+                      help='name of the module.')
+  parser.add_argument('--sources', dest='sources', required=True,
+                      help='file listing the flag files and inline flags.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the merged configuration to.')
+  parser.add_argument('--depfile', dest='depfile',
+                      help='depfile to write the files read to.')
+  return parser.parse_args()
+
+
+def split_rules(text):
+  """Splits proguard flags into rules, returning (line number, rule) tuples.
+
+  A rule starts with an option at the top level and extends over the
+  following lines until the next option, so that class specifications spanning
+  several lines stay together.  Comments and blank lines are dropped.
+  """
+  rules = []
+  depth = 0
+  for number, line in enumerate(text.splitlines(), 1):
+    line = line.split('#', 1)[0].strip()
+    if not line:
+      continue
+    if depth == 0 and (line.startswith('-') or line.startswith('@')) or not rules:
+      rules.append((number, line))
+    else:
+      rules[-1] = (rules[-1][0], rules[-1][1] + '\n' + line)
+    depth = max(depth + line.count('{') - line.count('}'), 0)
+  return rules
+
+
+def file_rules(origin, path, seen=None, read_files=None):
+  """Returns the (origin, location, rule) tuples of a flag file and its includes.
+
+  The paths of the files read are appended to read_files if it is set.
+  """
+  seen = seen if seen is not None else set()
+  if path in seen:
+    return []
+  seen.add(path)
+  if read_files is not None:
+    read_files.append(path)
+  with open(path) as f:
+    text = f.read()
+  rules = []
+  for number, rule in split_rules(text):
+    include = _INCLUDE_RE.match(rule)
+    if include:
+      included = include.group(1)
+      if not os.path.isabs(included):
+        included = os.path.join(os.path.dirname(path), included)
+      rules.extend(file_rules(origin, os.path.normpath(included), seen,
+                              read_files))
+    else:
+      rules.append((origin, '%s:%d' % (path, number), rule))
+  return rules
+
+
+def read_sources(sources, read_files=None):
+  """Returns the (origin, location, rule) tuples of all the sources in order.
+
+  The paths of the flag files read are appended to read_files if it is set.
+  """
+  rules = []
+  for line in sources.splitlines():
+    if not line:
+      continue
+    kind, origin, value = line.split('\t', 2)
+    if kind == 'file':
+      rules.extend(file_rules(origin, value, read_files=read_files))
+    elif kind == 'flag':
+      rules.extend((origin, '<inline>', rule) for _, rule in split_rules(value))
+    else:
+      raise ValueError('unknown source kind %r in %r' % (kind, line))
+  return rules
+
+
+def merged_config(name, rules):
+  """Returns the merged configuration with the origin of each rule."""
+  lines = ['# Merged R8 configuration of %s.' % name, '#']
+  global_rules = [r for r in rules if _GLOBAL_RULE_RE.match(r[2])]
+  if global_rules:
+    lines.append('# Rules that disable shrinking, optimization or obfuscation,'
+                 ' or keep all classes:')
+    for origin, location, rule in global_rules:
+      lines.append('#   %s (%s: %s)' % (rule.split('\n')[0], origin, location))
+  else:
+    lines.append('# No rule disables shrinking, optimization or obfuscation,'
+                 ' or keeps all classes.')
+  for origin, location, rule in rules:
+    lines.append('')
+    lines.append('# %s: %s' % (origin, location))
+    lines.append(rule)
+  return '\n'.join(lines) + '\n'
+
+
+def depfile(output, read_files):
+  """Returns the contents of a depfile listing the files read for the output."""
+  def escape(path):
+    return path.replace(' ', '\\ ')
+  deps = sorted(set(read_files))
+  return '%s: %s\n' % (escape(output), ' \\\n  '.join(escape(d) for d in deps))
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  read_files = []
+  with open(args.sources) as f:
+    rules = read_sources(f.read(), read_files)
+
+  with open(args.output, 'w') as f:
+    f.write(merged_config(args.name, rules))
+
+  if args.depfile:
+    with open(args.depfile, 'w') as f:
+      f.write(depfile(args.output, read_files))
+
+
+if __name__ == '__main__':
+  sys.exit(main())
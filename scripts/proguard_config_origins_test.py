@@ -0,0 +1,102 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for proguard_config_origins.py."""
+
+import os
+import shutil
+import tempfile
+import unittest
+
+import proguard_config_origins
+
+
+class SplitRulesTest(unittest.TestCase):
+
+  def test_multiline_rules(self):
+    rules = proguard_config_origins.split_rules(
+        '# comment\n'
+        '-keep class foo.Foo {\n'
+        '  -keep* <methods>;  # not an option\n'
+        '}\n'
+        '\n'
+        '-dontwarn foo.**\n')
+    self.assertEqual(rules, [
+        (2, '-keep class foo.Foo {\n-keep* <methods>;\n}'),
+        (6, '-dontwarn foo.**'),
+    ])
+
+  def test_continuation(self):
+    rules = proguard_config_origins.split_rules(
+        '-keepclassmembers\n  class * { *; }\n')
+    self.assertEqual(rules, [(1, '-keepclassmembers\nclass * { *; }')])
+
+
+class MergedConfigTest(unittest.TestCase):
+
+  def setUp(self):
+    self.tmp = tempfile.mkdtemp()
+
+  def tearDown(self):
+    shutil.rmtree(self.tmp)
+
+  def write(self, name, contents):
+    path = os.path.join(self.tmp, name)
+    with open(path, 'w') as f:
+      f.write(contents)
+    return path
+
+  def test_origins(self):
+    self.write('basic.flags', '-keepattributes *Annotation*\n')
+    build = self.write('build.flags', '-include basic.flags\n-dontnote\n')
+    lib = self.write('lib.flags', '-keep class ** { *; }\n')
+    sources = ('file\tbuild\t%s\n'
+               'file\tlib1\t%s\n'
+               'flag\tfoo\t-dontobfuscate\n') % (build, lib)
+
+    read_files = []
+    rules = proguard_config_origins.read_sources(sources, read_files)
+    self.assertEqual(read_files, [build, os.path.join(self.tmp, 'basic.flags'),
+                                  lib])
+    self.assertEqual(rules, [
+        ('build', os.path.join(self.tmp, 'basic.flags') + ':1',
+         '-keepattributes *Annotation*'),
+        ('build', build + ':2', '-dontnote'),
+        ('lib1', lib + ':1', '-keep class ** { *; }'),
+        ('foo', '<inline>', '-dontobfuscate'),
+    ])
+
+    config = proguard_config_origins.merged_config('foo', rules)
+    self.assertIn('#   -keep class ** { *; } (lib1: %s:1)\n' % lib, config)
+    self.assertIn('#   -dontobfuscate (foo: <inline>)\n', config)
+    self.assertNotIn('#   -dontnote', config)
+    self.assertIn('\n# lib1: %s:1\n-keep class ** { *; }\n' % lib, config)
+
+  def test_depfile(self):
+    self.assertEqual(
+        proguard_config_origins.depfile('out/merged.txt',
+                                        ['b.flags', 'a dir/a.flags', 'b.flags']),
+        'out/merged.txt: a\\ dir/a.flags \\\n  b.flags\n')
+
+  def test_no_global_rules(self):
+    config = proguard_config_origins.merged_config(
+        'foo', [('foo', '<inline>', '-keep class foo.** { *; }')])
+    self.assertIn('# No rule disables shrinking', config)
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,131 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Type checks the sources of a Python module with mypy.
+
+The source zips of the module and of its dependencies are unpacked into a
+temporary directory, which is the root of the imports, and mypy checks the
+given files of the module.  The diagnostics are written to --output as JSON,
+and printed if there are errors.
+"""
+
+import argparse
+import json
+import os
+import re
+import shutil
+import subprocess
+import sys
+import tempfile
+import zipfile
+
+# Matches a diagnostic printed by mypy with --show-column-numbers and
+# --show-error-codes, e.g. "a/b.py:12:5: error: Name "x" is not defined
+# [name-defined]".
+DIAGNOSTIC_RE = re.compile(
+    r'^(?P<file>[^:\n]+):(?P<line>\d+):(?:(?P<column>\d+):)? '
+    r'(?P<severity>error|warning|note): (?P<message>.*?)'
+    r'(?:  \[(?P<code>[a-z0-9-]+)\])?$')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--mypy', dest='mypy', required=True,
+                      help='the mypy executable.')
+  parser.add_argument('--strict', dest='strict', action='store_true',
+                      help='enable the strict checks of mypy.')
+  parser.add_argument('--srcs_zip', dest='srcs_zip', required=True,
+                      help='the source zip of the module.')
+  parser.add_argument('--deps_zip', dest='deps_zips', action='append',
+                      default=[], help='the source zip of a dependency.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the diagnostics to, as JSON.')
+  parser.add_argument('files', nargs='+',
+                      help='the files to check, relative to the zip roots.')
+  return parser.parse_args()
+
+
+def parse_diagnostics(lines):
+  """Returns the diagnostics printed by mypy."""
+  diagnostics = []
+  for line in lines:
+    match = DIAGNOSTIC_RE.match(line.rstrip('\n'))
+    if not match:
+      continue
+    diagnostics.append({
+        'file': match.group('file'),
+        'line': int(match.group('line')),
+        'column': int(match.group('column') or 0),
+        'severity': match.group('severity'),
+        'message': match.group('message'),
+        'code': match.group('code') or '',
+    })
+  return diagnostics
+
+
+def mypy_command(mypy, strict, files):
+  """Returns the command running mypy on files."""
+  cmd = [
+      mypy,
+      '--no-error-summary',
+      '--no-color-output',
+      '--show-column-numbers',
+      '--show-error-codes',
+      '--namespace-packages',
+      '--explicit-package-bases',
+      # The cache would be written to the temporary directory.
+      '--cache-dir=' + os.devnull,
+  ]
+  if strict:
+    cmd.append('--strict')
+  return cmd + ['--'] + files
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  root = tempfile.mkdtemp(prefix='python_typecheck_')
+  try:
+    # The module's sources take precedence over its dependencies'.
+    for zip_path in reversed([args.srcs_zip] + args.deps_zips):
+      with zipfile.ZipFile(zip_path) as z:
+        z.extractall(root)
+    env = dict(os.environ, MYPYPATH=root)
+    result = subprocess.run(
+        mypy_command(os.path.abspath(args.mypy), args.strict, args.files),
+        cwd=root, env=env, stdout=subprocess.PIPE, stderr=subprocess.STDOUT,
+        universal_newlines=True)
+  finally:
+    shutil.rmtree(root, ignore_errors=True)
+
+  diagnostics = parse_diagnostics(result.stdout.splitlines())
+  with open(args.output, 'w') as f:
+    json.dump({'diagnostics': diagnostics}, f, indent=2, sort_keys=True)
+    f.write('\n')
+
+  errors = [d for d in diagnostics if d['severity'] == 'error']
+  # mypy exits with 1 when it finds errors, and 2 when it fails.
+  if errors or result.returncode not in (0, 1):
+    sys.stdout.write(result.stdout)
+    return 1
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,73 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for python_typecheck.py."""
+
+import unittest
+
+import python_typecheck
+
+MYPY_OUTPUT = """\
+a/b.py:12:5: error: Name "x" is not defined  [name-defined]
+a/b.py:20: note: See https://mypy.readthedocs.io for more details
+a/c.py:3:1: error: Function is missing a type annotation  [no-untyped-def]
+Success: no issues found in 1 source file
+"""
+
+
+class PythonTypecheckTest(unittest.TestCase):
+
+  def test_parse_diagnostics(self):
+    self.assertEqual(
+        python_typecheck.parse_diagnostics(MYPY_OUTPUT.splitlines()), [
+            {
+                'file': 'a/b.py',
+                'line': 12,
+                'column': 5,
+                'severity': 'error',
+                'message': 'Name "x" is not defined',
+                'code': 'name-defined',
+            },
+            {
+                'file': 'a/b.py',
+                'line': 20,
+                'column': 0,
+                'severity': 'note',
+                'message': 'See https://mypy.readthedocs.io for more details',
+                'code': '',
+            },
+            {
+                'file': 'a/c.py',
+                'line': 3,
+                'column': 1,
+                'severity': 'error',
+                'message': 'Function is missing a type annotation',
+                'code': 'no-untyped-def',
+            },
+        ])
+
+  def test_mypy_command(self):
+    cmd = python_typecheck.mypy_command('/bin/mypy', True, ['a/b.py'])
+    self.assertEqual(cmd[0], '/bin/mypy')
+    self.assertIn('--strict', cmd)
+    self.assertEqual(cmd[-2:], ['--', 'a/b.py'])
+    self.assertNotIn(
+        '--strict', python_typecheck.mypy_command('mypy', False, ['a/b.py']))
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,161 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Verifies and unpacks the wheels of a python_requirements module.
+
+The lockfile pins the version and the sha256 hashes of the wheels of each
+package, in the format written by pip-compile --generate-hashes:
+
+  requests==2.26.0 \\
+      --hash=sha256:6c1246513ecd5ecd4528a0906f910e8f0f9c6b8ec72030dc9fd154dc1a6efd24
+
+Each pinned package must have exactly one wheel, whose version and hash match
+the lockfile, and every wheel must be pinned.  Only pure python wheels can be
+bundled in python binaries.  The wheels are unpacked to --output_dir and the
+packages are listed in --manifest, one "<name>==<version>" per line.
+"""
+
+import argparse
+import hashlib
+import os
+import re
+import sys
+import zipfile
+
+# Matches a pinned requirement, e.g. "requests[socks]==2.26.0".
+PIN_RE = re.compile(
+    r'^(?P<name>[A-Za-z0-9][A-Za-z0-9._-]*)(?:\[[^\]]*\])?\s*==\s*'
+    r'(?P<version>[^\s;]+)')
+
+# Matches the hashes of a requirement.
+HASH_RE = re.compile(r'--hash[=\s]sha256:(?P<hash>[0-9a-fA-F]{64})')
+
+
+class Error(Exception):
+  """An invalid lockfile or wheel."""
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--lockfile', dest='lockfile', required=True,
+                      help='the pinned requirements of the wheels.')
+  parser.add_argument('--output_dir', dest='output_dir', required=True,
+                      help='directory to unpack the wheels to.')
+  parser.add_argument('--manifest', dest='manifest', required=True,
+                      help='file to write the bundled packages to.')
+  parser.add_argument('wheels', nargs='*', help='the wheels to unpack.')
+  return parser.parse_args()
+
+
+def normalize(name):
+  """Returns the normalized name of a package, as defined by PEP 503."""
+  return re.sub(r'[-_.]+', '-', name).lower()
+
+
+def parse_lockfile(lines):
+  """Returns the pinned version and hashes of each package of a lockfile."""
+  pins = {}
+  requirement = ''
+  for line in list(lines) + ['']:
+    line = line.split('#', 1)[0].rstrip()
+    if line.endswith('\\'):
+      requirement += line[:-1] + ' '
+      continue
+    requirement = (requirement + line).strip()
+    if requirement and not requirement.startswith('-'):
+      match = PIN_RE.match(requirement)
+      if not match:
+        raise Error('%r is not pinned with ==' % requirement)
+      hashes = set(h.lower() for h in HASH_RE.findall(requirement))
+      if not hashes:
+        raise Error('%r has no sha256 hash' % requirement)
+      name = normalize(match.group('name'))
+      if name in pins:
+        raise Error('%s is pinned more than once' % name)
+      pins[name] = (match.group('version'), hashes)
+    requirement = ''
+  return pins
+
+
+def parse_wheel_name(path):
+  """Returns the name, version and platform of a wheel from its file name."""
+  parts = os.path.basename(path)[:-len('.whl')].split('-')
+  if not path.endswith('.whl') or len(parts) not in (5, 6):
+    raise Error('%s is not a wheel' % path)
+  return normalize(parts[0]), parts[1], parts[-1]
+
+
+def sha256(path):
+  """Returns the sha256 hash of a file."""
+  digest = hashlib.sha256()
+  with open(path, 'rb') as f:
+    for chunk in iter(lambda: f.read(65536), b''):
+      digest.update(chunk)
+  return digest.hexdigest()
+
+
+def check_wheels(pins, wheels):
+  """Returns the wheels of each package, checked against the pins."""
+  packages = {}
+  for wheel in wheels:
+    name, version, platform = parse_wheel_name(wheel)
+    if name not in pins:
+      raise Error('%s is not pinned in the lockfile' % wheel)
+    if name in packages:
+      raise Error('%s and %s are wheels of the same package' %
+                  (packages[name], wheel))
+    pinned_version, hashes = pins[name]
+    if version != pinned_version:
+      raise Error('%s is version %s but %s is pinned to %s' %
+                  (wheel, version, name, pinned_version))
+    if platform != 'any':
+      raise Error('%s is not a pure python wheel' % wheel)
+    if sha256(wheel) not in hashes:
+      raise Error('the sha256 hash of %s is not in the lockfile' % wheel)
+    packages[name] = wheel
+  missing = sorted(set(pins) - set(packages))
+  if missing:
+    raise Error('no wheel for %s' % ', '.join(missing))
+  return packages
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  try:
+    with open(args.lockfile) as f:
+      pins = parse_lockfile(f)
+    packages = check_wheels(pins, args.wheels)
+  except Error as e:
+    print('%s: %s' % (args.lockfile, e), file=sys.stderr)
+    return 1
+
+  for name in sorted(packages):
+    with zipfile.ZipFile(packages[name]) as wheel:
+      wheel.extractall(args.output_dir)
+
+  with open(args.manifest, 'w') as f:
+    for name in sorted(packages):
+      f.write('%s==%s\n' % (name, pins[name][0]))
+
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
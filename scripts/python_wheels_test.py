@@ -0,0 +1,117 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for python_wheels.py."""
+
+import hashlib
+import os
+import tempfile
+import unittest
+import zipfile
+
+import python_wheels
+
+LOCKFILE = """\
+# This file is autogenerated by pip-compile
+#
+certifi==2021.5.30 \\
+    --hash=sha256:%(certifi)s
+requests[socks]==2.26.0 \\
+    --hash=sha256:%(requests)s \\
+    --hash=sha256:%(other)s
+    # via -r requirements.in
+Typing_Extensions==3.10.0.2 --hash=sha256:%(typing)s
+"""
+
+HASHES = {
+    'certifi': 'a' * 64,
+    'requests': 'b' * 64,
+    'other': 'c' * 64,
+    'typing': 'd' * 64,
+}
+
+
+class PythonWheelsTest(unittest.TestCase):
+
+  def setUp(self):
+    self.tmp = tempfile.TemporaryDirectory()
+    self.addCleanup(self.tmp.cleanup)
+
+  def write_wheel(self, name, files):
+    path = os.path.join(self.tmp.name, name)
+    with zipfile.ZipFile(path, 'w') as wheel:
+      for file_name, content in files.items():
+        wheel.writestr(file_name, content)
+    with open(path, 'rb') as f:
+      return path, hashlib.sha256(f.read()).hexdigest()
+
+  def test_parse_lockfile(self):
+    pins = python_wheels.parse_lockfile(
+        (LOCKFILE % HASHES).splitlines(True))
+    self.assertEqual(pins, {
+        'certifi': ('2021.5.30', {'a' * 64}),
+        'requests': ('2.26.0', {'b' * 64, 'c' * 64}),
+        'typing-extensions': ('3.10.0.2', {'d' * 64}),
+    })
+
+  def test_parse_lockfile_errors(self):
+    with self.assertRaisesRegex(python_wheels.Error, 'not pinned'):
+      python_wheels.parse_lockfile(
+          ['requests>=2.0 --hash=sha256:%s' % HASHES['requests']])
+    with self.assertRaisesRegex(python_wheels.Error, 'no sha256 hash'):
+      python_wheels.parse_lockfile(['requests==2.26.0'])
+    with self.assertRaisesRegex(python_wheels.Error, 'more than once'):
+      python_wheels.parse_lockfile([
+          'requests==2.26.0 --hash=sha256:%s' % HASHES['requests'],
+          'Requests==2.25.0 --hash=sha256:%s' % HASHES['other'],
+      ])
+
+  def test_parse_wheel_name(self):
+    self.assertEqual(
+        python_wheels.parse_wheel_name(
+            'wheels/typing_extensions-3.10.0.2-py3-none-any.whl'),
+        ('typing-extensions', '3.10.0.2', 'any'))
+    with self.assertRaisesRegex(python_wheels.Error, 'is not a wheel'):
+      python_wheels.parse_wheel_name('requests-2.26.0.tar.gz')
+
+  def test_check_wheels(self):
+    wheel, digest = self.write_wheel('certifi-2021.5.30-py2.py3-none-any.whl',
+                                     {'certifi/__init__.py': ''})
+    pins = {'certifi': ('2021.5.30', {digest})}
+    self.assertEqual(python_wheels.check_wheels(pins, [wheel]),
+                     {'certifi': wheel})
+
+    with self.assertRaisesRegex(python_wheels.Error, 'is not in the lockfile'):
+      python_wheels.check_wheels({'certifi': ('2021.5.30', {'a' * 64})},
+                                 [wheel])
+    with self.assertRaisesRegex(python_wheels.Error, 'is pinned to 2021.10.8'):
+      python_wheels.check_wheels({'certifi': ('2021.10.8', {digest})}, [wheel])
+    with self.assertRaisesRegex(python_wheels.Error, 'no wheel for requests'):
+      python_wheels.check_wheels(
+          dict(pins, requests=('2.26.0', {'b' * 64})), [wheel])
+    with self.assertRaisesRegex(python_wheels.Error, 'is not pinned'):
+      python_wheels.check_wheels({}, [wheel])
+
+  def test_check_wheels_platform(self):
+    wheel, digest = self.write_wheel(
+        'six-1.16.0-cp39-cp39-manylinux1_x86_64.whl', {'six.py': ''})
+    with self.assertRaisesRegex(python_wheels.Error, 'not a pure python'):
+      python_wheels.check_wheels({'six': ('1.16.0', {digest})}, [wheel])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,129 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Applies the machine applicable suggestions of rustc and clippy to sources.
+
+The input is the rust-fixes.json file written by m rust-diagnostics with
+RUST_DIAGNOSTICS=true.  Each fix is a set of edits to the sources, which are
+applied together.  A fix that overlaps with a fix that was already applied is
+skipped, running the build and the tool again applies it if it still applies.
+"""
+
+import argparse
+import collections
+import json
+import os
+import sys
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--root', dest='root', default='.',
+                      help='directory the paths of the fixes are relative to.')
+  parser.add_argument('--lint', dest='lints', action='append', default=[],
+                      help='only apply the fixes of this lint, e.g. '
+                      'clippy::needless_return.  May be repeated.')
+  parser.add_argument('--exclude', dest='excludes', action='append',
+                      default=None,
+                      help='path prefix of the files not to modify, out/ by '
+                      'default.  May be repeated.')
+  parser.add_argument('--dry_run', dest='dry_run', action='store_true',
+                      help='print the fixes instead of applying them.')
+  parser.add_argument('fixes', help='rust-fixes.json')
+  args = parser.parse_args()
+  if args.excludes is None:
+    args.excludes = ['out/']
+  return args
+
+
+def select_fixes(fixes, lints, excludes):
+  """Returns the fixes of the lints that only modify the non excluded files."""
+  selected = []
+  for fix in fixes:
+    if lints and fix['rule'] not in lints:
+      continue
+    if any(e['file'].startswith(tuple(excludes)) or os.path.isabs(e['file'])
+           for e in fix['edits']):
+      continue
+    selected.append(fix)
+  return selected
+
+
+def plan_edits(fixes):
+  """Returns the edits to apply to each file, and the applied fixes.
+
+  Fixes are applied as a whole, a fix that has an edit overlapping an edit of
+  an earlier fix is skipped.  Identical edits, from the same diagnostic
+  reported for several crates, are applied once.
+  """
+  edits = collections.defaultdict(list)
+  applied = []
+  for fix in fixes:
+    new_edits = [e for e in fix['edits'] if e not in edits.get(e['file'], [])]
+    if any(overlap(e, other) for e in new_edits
+           for other in edits.get(e['file'], [])):
+      continue
+    for e in new_edits:
+      edits[e['file']].append(e)
+    applied.append(fix)
+  return edits, applied
+
+
+def overlap(a, b):
+  """Returns whether two edits of a file overlap."""
+  if a['byte_start'] == a['byte_end'] == b['byte_start'] == b['byte_end']:
+    # Two insertions at the same offset.
+    return True
+  return a['byte_start'] < b['byte_end'] and b['byte_start'] < a['byte_end']
+
+
+def apply_edits(content, edits):
+  """Returns content, as bytes, with the edits applied."""
+  for e in sorted(edits, key=lambda e: e['byte_start'], reverse=True):
+    content = (content[:e['byte_start']] + e['replacement'].encode('utf-8') +
+               content[e['byte_end']:])
+  return content
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+  with open(args.fixes) as f:
+    fixes = json.load(f)
+
+  edits, applied = plan_edits(select_fixes(fixes, args.lints, args.excludes))
+
+  for fix in applied:
+    files = sorted(set(e['file'] for e in fix['edits']))
+    print('%s: %s (%s)' % (', '.join(files), fix['message'], fix['rule']))
+  if args.dry_run:
+    return 0
+
+  for path in sorted(edits):
+    full_path = os.path.join(args.root, path)
+    with open(full_path, 'rb') as f:
+      content = f.read()
+    with open(full_path, 'wb') as f:
+      f.write(apply_edits(content, edits[path]))
+
+  print('Applied %d of %d fixes.' % (len(applied), len(fixes)))
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
@@ -0,0 +1,78 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for rust_apply_fixes.py."""
+
+import unittest
+
+import rust_apply_fixes
+
+
+def fix(rule, *edits):
+  return {
+      'rule': rule,
+      'message': rule,
+      'edits': [{'file': f, 'byte_start': s, 'byte_end': e, 'replacement': r}
+                for f, s, e, r in edits],
+  }
+
+
+class RustApplyFixesTest(unittest.TestCase):
+  """Unit tests for rust_apply_fixes.py."""
+
+  def test_select_fixes(self):
+    fixes = [
+        fix('clippy::needless_return', ('a.rs', 0, 1, 'x')),
+        fix('clippy::len_zero', ('a.rs', 5, 6, 'y')),
+        fix('clippy::needless_return', ('out/gen.rs', 0, 1, 'x')),
+        fix('clippy::needless_return', ('/abs/a.rs', 0, 1, 'x')),
+    ]
+    self.assertEqual(
+        rust_apply_fixes.select_fixes(fixes, [], ['out/']), fixes[:2])
+    self.assertEqual(
+        rust_apply_fixes.select_fixes(fixes, ['clippy::len_zero'], ['out/']),
+        fixes[1:2])
+
+  def test_plan_edits(self):
+    first = fix('a', ('a.rs', 0, 4, 'x'), ('b.rs', 0, 1, 'y'))
+    duplicate = fix('a', ('a.rs', 0, 4, 'x'))
+    overlapping = fix('b', ('a.rs', 2, 6, 'z'), ('c.rs', 0, 1, 'w'))
+    adjacent = fix('c', ('a.rs', 4, 6, 'v'))
+    edits, applied = rust_apply_fixes.plan_edits(
+        [first, duplicate, overlapping, adjacent])
+    self.assertEqual(applied, [first, duplicate, adjacent])
+    self.assertEqual(sorted(edits), ['a.rs', 'b.rs'])
+    self.assertEqual(len(edits['a.rs']), 2)
+
+  def test_plan_edits_insertions(self):
+    first = fix('a', ('a.rs', 3, 3, 'x'))
+    second = fix('b', ('a.rs', 3, 3, 'y'))
+    _, applied = rust_apply_fixes.plan_edits([first, second])
+    self.assertEqual(applied, [first])
+
+  def test_apply_edits(self):
+    content = 'fn f() -> i32 { return 1; }'.encode('utf-8')
+    edits = [
+        {'byte_start': 16, 'byte_end': 25, 'replacement': '1'},
+        {'byte_start': 0, 'byte_end': 2, 'replacement': 'pub fn'},
+    ]
+    self.assertEqual(rust_apply_fixes.apply_edits(content, edits),
+                     b'pub fn f() -> i32 { 1 }')
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,214 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Reports the crates linked into rust binaries and their use of unsafe code.
+
+The manifest written by Soong lists the crates built by rust modules, with
+the dep-info file written by rustc for each of them, and the crates linked
+into each rust binary and shared library.  The sources of each crate are read
+from its dep-info file and scanned for unsafe blocks, functions, impls and
+traits, ignoring comments and string literals.  The report lists the crates of
+each binary with their unsafe counts.
+
+With --allowlist, the crates containing unsafe code must be listed in the
+allowlist, one "<crate_name> [<max unsafe count>]" per line, or the check
+fails.
+"""
+
+import argparse
+import json
+import re
+import sys
+
+# Matches the line comments, the start of the block comments, the string
+# literals and the char literals, which are removed before counting.  Lifetimes
+# are not matched as char literals as they are not closed by a quote.
+NOISE_RE = re.compile(
+    r'//[^\n]*'
+    r'|/\*'
+    r'|b?r(?P<hashes>#*)"(?:.|\n)*?"(?P=hashes)'
+    r'|b?"(?:[^"\\]|\\.|\\\n)*"'
+    r"|b?'(?:[^'\\\n]|\\[^\n]{1,10}?)'")
+
+# Matches the delimiters of block comments, which can be nested.
+COMMENT_RE = re.compile(r'/\*|\*/')
+
+# Matches the uses of unsafe, e.g. "unsafe {", "unsafe fn",
+# "unsafe extern "C" fn", "unsafe impl" and "unsafe trait".
+UNSAFE_RE = re.compile(
+    r'\bunsafe\s*(?:(?P<block>\{)|(?:extern\s*(?:"[^"]*"\s*)?)?'
+    r'(?P<kind>fn|impl|trait)\b)')
+
+KINDS = ('blocks', 'fns', 'impls', 'traits')
+
+
+def parse_args():
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  parser.add_argument('--manifest', dest='manifest', required=True,
+                      help='the crates and binaries written by Soong.')
+  parser.add_argument('--output', dest='output', required=True,
+                      help='file to write the JSON report to.')
+  parser.add_argument('--allowlist', dest='allowlist',
+                      help='the crates allowed to contain unsafe code.')
+  parser.add_argument('--check_output', dest='check_output',
+                      help='file to touch when the allowlist check passes.')
+  return parser.parse_args()
+
+
+def strip_noise(source):
+  """Returns the source without its comments and literals."""
+  parts = []
+  pos = 0
+  while True:
+    match = NOISE_RE.search(source, pos)
+    if not match:
+      break
+    parts.append(source[pos:match.start()])
+    parts.append(' ')
+    pos = match.end()
+    if match.group() == '/*':
+      depth = 1
+      while depth:
+        delimiter = COMMENT_RE.search(source, pos)
+        if not delimiter:
+          pos = len(source)
+          break
+        depth += 1 if delimiter.group() == '/*' else -1
+        pos = delimiter.end()
+  parts.append(source[pos:])
+  return ''.join(parts)
+
+
+def count_unsafe(source):
+  """Returns the number of each kind of unsafe use in source."""
+  counts = dict.fromkeys(KINDS, 0)
+  for match in UNSAFE_RE.finditer(strip_noise(source)):
+    if match.group('block'):
+      counts['blocks'] += 1
+    else:
+      counts[match.group('kind') + 's'] += 1
+  return counts
+
+
+def dep_info_sources(lines, output):
+  """Returns the rust sources of output in a rustc dep-info file."""
+  sources = []
+  for line in lines:
+    line = line.rstrip('\n')
+    target, sep, deps = line.partition(': ')
+    if not sep or target != output:
+      continue
+    # Spaces in paths are escaped with a backslash.
+    for dep in re.split(r'(?<!\\) ', deps):
+      dep = dep.replace('\\ ', ' ')
+      if dep.endswith('.rs'):
+        sources.append(dep)
+  return sources
+
+
+def read_allowlist(lines):
+  """Returns the maximum unsafe count of each allowed crate, or None."""
+  allowed = {}
+  for line in lines:
+    fields = line.split('#', 1)[0].split()
+    if not fields:
+      continue
+    allowed[fields[0]] = int(fields[1]) if len(fields) > 1 else None
+  return allowed
+
+
+def scan_crate(crate):
+  """Returns the report of a crate of the manifest."""
+  with open(crate['dep_info']) as f:
+    sources = dep_info_sources(f, crate['output'])
+  counts = dict.fromkeys(KINDS, 0)
+  for source in sources:
+    with open(source, errors='replace') as f:
+      for kind, count in count_unsafe(f.read()).items():
+        counts[kind] += count
+  report = {k: crate[k] for k in
+            ('crate_name', 'module', 'variant', 'path', 'external',
+             'proc_macro')}
+  report['sources'] = len(sources)
+  report['unsafe'] = counts
+  report['unsafe_total'] = sum(counts.values())
+  return report
+
+
+def check_allowlist(crates, allowed):
+  """Returns the violations of the allowlist by the crates."""
+  errors = []
+  for crate in crates:
+    total = crate['unsafe_total']
+    if not total:
+      continue
+    name = crate['crate_name']
+    if name not in allowed:
+      errors.append('%s (%s) contains %d uses of unsafe but is not in the '
+                    'allowlist' % (name, crate['module'], total))
+    elif allowed[name] is not None and total > allowed[name]:
+      errors.append('%s (%s) contains %d uses of unsafe, more than the %d '
+                    'allowed' % (name, crate['module'], total, allowed[name]))
+  return sorted(set(errors))
+
+
+def main():
+  """Program entry point."""
+  args = parse_args()
+
+  with open(args.manifest) as f:
+    manifest = json.load(f)
+
+  crates = [scan_crate(crate) for crate in manifest['crates']]
+  binaries = []
+  for binary in manifest['binaries']:
+    binary_crates = [crates[i] for i in binary['crates']]
+    binaries.append({
+        'module': binary['module'],
+        'variant': binary['variant'],
+        'path': binary['path'],
+        'crates': binary_crates,
+        'external_crates': sorted(set(
+            c['crate_name'] for c in binary_crates if c['external'])),
+        'unsafe_total': sum(c['unsafe_total'] for c in binary_crates),
+    })
+
+  with open(args.output, 'w') as f:
+    json.dump({'crates': crates, 'binaries': binaries}, f, indent=2,
+              sort_keys=True)
+    f.write('\n')
+
+  if args.allowlist:
+    with open(args.allowlist) as f:
+      allowed = read_allowlist(f)
+    errors = check_allowlist(crates, allowed)
+    if errors:
+      print('The use of unsafe code in rust crates violates %s:' %
+            args.allowlist)
+      for error in errors:
+        print('  ' + error)
+      return 1
+    if args.check_output:
+      with open(args.check_output, 'w'):
+        pass
+
+  return 0
+
+
+if __name__ == '__main__':
+  sys.exit(main())
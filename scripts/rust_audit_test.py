@@ -0,0 +1,123 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for rust_audit.py."""
+
+import json
+import os
+import tempfile
+import unittest
+
+import rust_audit
+
+SOURCE = r'''
+// unsafe { in a comment }
+/* unsafe fn in a /* nested */ comment unsafe { */
+const S: &str = "unsafe { in a string";
+const R: &str = r#"unsafe fn in a "raw" string"#;
+const C: char = '"';
+
+pub unsafe fn foo<'a>(x: &'a u8) -> u8 {
+    unsafe { *(x as *const u8) }
+}
+
+pub unsafe extern "C" fn bar() {}
+
+unsafe impl Send for Foo {}
+
+pub unsafe trait Baz {}
+
+fn main() {
+    let unsafe_count = 1;
+    unsafe{ foo(&0) };
+}
+'''
+
+
+class RustAuditTest(unittest.TestCase):
+
+  def test_count_unsafe(self):
+    self.assertEqual(rust_audit.count_unsafe(SOURCE), {
+        'blocks': 2,
+        'fns': 2,
+        'impls': 1,
+        'traits': 1,
+    })
+
+  def test_strip_noise(self):
+    self.assertEqual(
+        rust_audit.strip_noise('a /* b /* c */ d */ e "f // g" h // i\nj'),
+        'a   e   h  \nj')
+
+  def test_dep_info_sources(self):
+    lines = [
+        'out/libfoo.rlib: src/lib.rs src/my\\ mod.rs out/gen.rs\n',
+        '\n',
+        'src/lib.rs:\n',
+        'out/other.rlib: src/other.rs\n',
+    ]
+    self.assertEqual(
+        rust_audit.dep_info_sources(lines, 'out/libfoo.rlib'),
+        ['src/lib.rs', 'src/my mod.rs', 'out/gen.rs'])
+
+  def test_read_allowlist(self):
+    self.assertEqual(
+        rust_audit.read_allowlist(['# comment\n', 'foo\n', 'bar 3 # max\n']),
+        {'foo': None, 'bar': 3})
+
+  def test_check_allowlist(self):
+    crates = [
+        {'crate_name': 'foo', 'module': 'libfoo', 'unsafe_total': 10},
+        {'crate_name': 'bar', 'module': 'libbar', 'unsafe_total': 4},
+        {'crate_name': 'baz', 'module': 'libbaz', 'unsafe_total': 1},
+        {'crate_name': 'safe', 'module': 'libsafe', 'unsafe_total': 0},
+    ]
+    self.assertEqual(
+        rust_audit.check_allowlist(crates, {'foo': None, 'bar': 3}), [
+            'bar (libbar) contains 4 uses of unsafe, more than the 3 allowed',
+            'baz (libbaz) contains 1 uses of unsafe but is not in the '
+            'allowlist',
+        ])
+
+  def test_scan_crate(self):
+    with tempfile.TemporaryDirectory() as tmp:
+      source = os.path.join(tmp, 'lib.rs')
+      with open(source, 'w') as f:
+        f.write('unsafe fn foo() {}\nfn bar() { unsafe { foo() } }\n')
+      dep_info = os.path.join(tmp, 'libfoo.rlib.d.raw')
+      with open(dep_info, 'w') as f:
+        f.write('out/libfoo.rlib: %s\n' % source)
+      crate = {
+          'crate_name': 'foo',
+          'module': 'libfoo',
+          'variant': 'android_arm64_armv8-a_rlib',
+          'path': 'external/rust/crates/foo',
+          'external': True,
+          'proc_macro': False,
+          'output': 'out/libfoo.rlib',
+          'dep_info': dep_info,
+      }
+      report = rust_audit.scan_crate(crate)
+      self.assertEqual(report['sources'], 1)
+      self.assertEqual(report['unsafe_total'], 2)
+      self.assertEqual(report['unsafe']['fns'], 1)
+      self.assertTrue(report['external'])
+      self.assertNotIn('dep_info', json.dumps(report))
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
@@ -0,0 +1,249 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Collects the JSON diagnostics of rustc and clippy-driver.
+
+The run command runs rustc or clippy-driver with --error-format=json, writes the
+diagnostics it reports to a file, one JSON object per line, and prints them to
+stderr as the compiler would have.  The exit code is the one of the compiler.
+
+The report command aggregates the diagnostics files of many crates into a SARIF
+report, and writes the machine applicable suggestions of the diagnostics to a
+JSON file that can be applied to the sources with rust_apply_fixes.py.
+"""
+
+import argparse
+import json
+import subprocess
+import sys
+
+
+def parse_args(argv):
+  """Parse commandline arguments."""
+  parser = argparse.ArgumentParser()
+  subparsers = parser.add_subparsers(dest='command')
+  subparsers.required = True
+
+  run = subparsers.add_parser('run', help='run rustc or clippy-driver.')
+  run.add_argument('--output', dest='output', required=True,
+                   help='file to write the diagnostics to.')
+  run.add_argument('compiler', nargs=argparse.REMAINDER,
+                   help='the compiler command, after --.')
+
+  report = subparsers.add_parser('report', help='aggregate diagnostics.',
+                                 fromfile_prefix_chars='@')
+  report.add_argument('--sarif', dest='sarif', required=True,
+                      help='SARIF file to write the diagnostics to.')
+  report.add_argument('--fixes', dest='fixes', required=True,
+                      help='JSON file to write the suggestions to.')
+  report.add_argument('diagnostics', nargs='*',
+                      help='the diagnostics files written by run.')
+
+  args = parser.parse_args(argv)
+  if args.command == 'run':
+    if args.compiler and args.compiler[0] == '--':
+      args.compiler = args.compiler[1:]
+    if not args.compiler:
+      parser.error('missing compiler command')
+  return args
+
+
+def split_output(stderr):
+  """Splits the stderr of the compiler into diagnostics and other lines."""
+  diagnostics = []
+  other = []
+  for line in stderr.splitlines():
+    try:
+      diagnostic = json.loads(line)
+    except ValueError:
+      diagnostic = None
+    if isinstance(diagnostic, dict) and 'rendered' in diagnostic:
+      diagnostics.append(diagnostic)
+    else:
+      other.append(line)
+  return diagnostics, other
+
+
+def run(args):
+  """Runs the compiler and collects its diagnostics."""
+  proc = subprocess.run(args.compiler + ['--error-format=json'],
+                        stderr=subprocess.PIPE, universal_newlines=True)
+  diagnostics, other = split_output(proc.stderr)
+
+  with open(args.output, 'w') as f:
+    for diagnostic in diagnostics:
+      f.write(json.dumps(diagnostic, sort_keys=True) + '\n')
+
+  for line in other:
+    print(line, file=sys.stderr)
+  for diagnostic in diagnostics:
+    if diagnostic['rendered']:
+      sys.stderr.write(diagnostic['rendered'])
+  return proc.returncode
+
+
+def read_diagnostics(lines):
+  """Returns the diagnostics of a file written by run."""
+  return [json.loads(line) for line in lines if line.strip()]
+
+
+def primary_span(diagnostic):
+  """Returns the primary span of a diagnostic, or None."""
+  for span in diagnostic.get('spans') or []:
+    if span.get('is_primary'):
+      return span
+  return None
+
+
+def rule_id(diagnostic):
+  """Returns the lint or error code of a diagnostic."""
+  code = diagnostic.get('code')
+  if code and code.get('code'):
+    return code['code']
+  return 'rustc'
+
+
+def unique_diagnostics(diagnostics):
+  """Returns the diagnostics with a location, without duplicates.
+
+  The same diagnostic is reported for each variant of a crate, and for each
+  crate that includes the same source file.
+  """
+  seen = set()
+  result = []
+  for diagnostic in diagnostics:
+    span = primary_span(diagnostic)
+    if not span:
+      # Summaries like "2 warnings emitted" don't have a location.
+      continue
+    key = (diagnostic.get('level'), rule_id(diagnostic),
+           diagnostic.get('message'), span['file_name'], span['line_start'],
+           span['column_start'])
+    if key in seen:
+      continue
+    seen.add(key)
+    result.append(diagnostic)
+  return result
+
+
+def sarif_level(level):
+  """Converts the level of a rustc diagnostic to a SARIF level."""
+  if level in ('error', 'error: internal compiler error'):
+    return 'error'
+  if level == 'warning':
+    return 'warning'
+  return 'note'
+
+
+def to_sarif(diagnostics):
+  """Returns the SARIF document for the diagnostics."""
+  rules = sorted(set(rule_id(d) for d in diagnostics))
+  results = []
+  for d in diagnostics:
+    span = primary_span(d)
+    results.append({
+        'ruleId': rule_id(d),
+        'ruleIndex': rules.index(rule_id(d)),
+        'level': sarif_level(d.get('level')),
+        'message': {'text': d.get('message', '')},
+        'locations': [{
+            'physicalLocation': {
+                'artifactLocation': {'uri': span['file_name']},
+                'region': {
+                    'startLine': span['line_start'],
+                    'startColumn': span['column_start'],
+                    'endLine': span['line_end'],
+                    'endColumn': span['column_end'],
+                },
+            },
+        }],
+    })
+  return {
+      '$schema': 'https://json.schemastore.org/sarif-2.1.0.json',
+      'version': '2.1.0',
+      'runs': [{
+          'tool': {
+              'driver': {
+                  'name': 'rustc',
+                  'informationUri': 'https://doc.rust-lang.org/rustc/',
+                  'rules': [{'id': rule} for rule in rules],
+              },
+          },
+          'results': results,
+      }],
+  }
+
+
+def suggestion_edits(diagnostic):
+  """Returns the machine applicable edits suggested by a diagnostic."""
+  edits = []
+  for d in [diagnostic] + (diagnostic.get('children') or []):
+    for span in d.get('spans') or []:
+      if (span.get('suggestion_applicability') == 'MachineApplicable' and
+          span.get('suggested_replacement') is not None):
+        edits.append({
+            'file': span['file_name'],
+            'byte_start': span['byte_start'],
+            'byte_end': span['byte_end'],
+            'replacement': span['suggested_replacement'],
+        })
+  return edits
+
+
+def to_fixes(diagnostics):
+  """Returns the fixes for the diagnostics with machine applicable edits."""
+  fixes = []
+  for d in diagnostics:
+    edits = suggestion_edits(d)
+    if edits:
+      fixes.append({
+          'rule': rule_id(d),
+          'message': d.get('message', ''),
+          'edits': edits,
+      })
+  return fixes
+
+
+def report(args):
+  """Aggregates the diagnostics files."""
+  diagnostics = []
+  for path in args.diagnostics:
+    try:
+      with open(path) as f:
+        diagnostics.extend(read_diagnostics(f))
+    except FileNotFoundError:
+      # Crates that failed to compile don't write their diagnostics.
+      pass
+  diagnostics = unique_diagnostics(diagnostics)
+
+  with open(args.sarif, 'w') as f:
+    json.dump(to_sarif(diagnostics), f, indent=2, sort_keys=True)
+  with open(args.fixes, 'w') as f:
+    json.dump(to_fixes(diagnostics), f, indent=2, sort_keys=True)
+  return 0
+
+
+def main(argv):
+  """Program entry point."""
+  args = parse_args(argv)
+  if args.command == 'run':
+    return run(args)
+  return report(args)
+
+
+if __name__ == '__main__':
+  sys.exit(main(sys.argv[1:]))
@@ -0,0 +1,137 @@
+#!/usr/bin/env python3
+#
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+#
+
+"""Unit tests for rust_diagnostics.py."""
+
+import json
+import unittest
+
+import rust_diagnostics
+
+
+def span(file_name, line, byte_start, byte_end, primary=True,
+         replacement=None, applicability=None):
+  return {
+      'file_name': file_name,
+      'byte_start': byte_start,
+      'byte_end': byte_end,
+      'line_start': line,
+      'line_end': line,
+      'column_start': 5,
+      'column_end': 10,
+      'is_primary': primary,
+      'suggested_replacement': replacement,
+      'suggestion_applicability': applicability,
+  }
+
+
+NEEDLESS_RETURN = {
+    '$message_type': 'diagnostic',
+    'message': 'unneeded `return` statement',
+    'code': {'code': 'clippy::needless_return', 'explanation': None},
+    'level': 'warning',
+    'spans': [span('foo/src/lib.rs', 3, 20, 29)],
+    'children': [{
+        'message': 'remove `return`',
+        'code': None,
+        'level': 'help',
+        'spans': [span('foo/src/lib.rs', 3, 20, 29, replacement='x',
+                       applicability='MachineApplicable')],
+        'children': [],
+        'rendered': None,
+    }],
+    'rendered': 'warning: unneeded `return` statement\n',
+}
+
+UNUSED = {
+    'message': 'unused variable: `y`',
+    'code': {'code': 'unused_variables', 'explanation': None},
+    'level': 'warning',
+    'spans': [span('foo/src/lib.rs', 5, 40, 41)],
+    'children': [{
+        'message': 'if this is intentional, prefix it with an underscore',
+        'code': None,
+        'level': 'help',
+        'spans': [span('foo/src/lib.rs', 5, 40, 41, replacement='_y',
+                       applicability='MaybeIncorrect')],
+        'children': [],
+        'rendered': None,
+    }],
+    'rendered': 'warning: unused variable: `y`\n',
+}
+
+SUMMARY = {
+    'message': '2 warnings emitted',
+    'code': None,
+    'level': 'warning',
+    'spans': [],
+    'children': [],
+    'rendered': 'warning: 2 warnings emitted\n',
+}
+
+
+class RustDiagnosticsTest(unittest.TestCase):
+  """Unit tests for rust_diagnostics.py."""
+
+  def test_split_output(self):
+    stderr = '\n'.join([json.dumps(NEEDLESS_RETURN), 'ld: some warning',
+                        json.dumps(SUMMARY), '{"not": "a diagnostic"}'])
+    diagnostics, other = rust_diagnostics.split_output(stderr)
+    self.assertEqual(diagnostics, [NEEDLESS_RETURN, SUMMARY])
+    self.assertEqual(other, ['ld: some warning', '{"not": "a diagnostic"}'])
+
+  def test_unique_diagnostics(self):
+    diagnostics = rust_diagnostics.unique_diagnostics(
+        [NEEDLESS_RETURN, SUMMARY, UNUSED, NEEDLESS_RETURN])
+    self.assertEqual(diagnostics, [NEEDLESS_RETURN, UNUSED])
+
+  def test_to_sarif(self):
+    sarif = rust_diagnostics.to_sarif([NEEDLESS_RETURN, UNUSED])
+    run = sarif['runs'][0]
+    self.assertEqual(run['tool']['driver']['rules'],
+                     [{'id': 'clippy::needless_return'},
+                      {'id': 'unused_variables'}])
+    self.assertEqual(len(run['results']), 2)
+    result = run['results'][1]
+    self.assertEqual(result['ruleId'], 'unused_variables')
+    self.assertEqual(result['ruleIndex'], 1)
+    self.assertEqual(result['level'], 'warning')
+    location = result['locations'][0]['physicalLocation']
+    self.assertEqual(location['artifactLocation']['uri'], 'foo/src/lib.rs')
+    self.assertEqual(location['region']['startLine'], 5)
+
+  def test_rule_id(self):
+    self.assertEqual(rust_diagnostics.rule_id(NEEDLESS_RETURN),
+                     'clippy::needless_return')
+    self.assertEqual(rust_diagnostics.rule_id(SUMMARY), 'rustc')
+
+  def test_to_fixes(self):
+    fixes = rust_diagnostics.to_fixes([NEEDLESS_RETURN, UNUSED])
+    self.assertEqual(fixes, [{
+        'rule': 'clippy::needless_return',
+        'message': 'unneeded `return` statement',
+        'edits': [{
+            'file': 'foo/src/lib.rs',
+            'byte_start': 20,
+            'byte_end': 29,
+            'replacement': 'x',
+        }],
+    }])
+
+
+if __name__ == '__main__':
+  unittest.main(verbosity=2)
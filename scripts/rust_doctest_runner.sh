@@ -0,0 +1,108 @@
+#!/bin/bash
+
+# Copyright (C) 2021 The Android Open Source Project
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Runs the doctests of a rust_doctest_host module.
+#
+# The doctests are compiled when the module is built, with
+# rustdoc --test --persist-doctests <dir> --no-run, and zipped next to this
+# script as <script>.doctests.zip, with the list of the doctests printed by
+# rustdoc --test -- --list. This script runs them the way rustdoc would and
+# prints the results in the format of the Rust test harness, which is what the
+# test runner of tradefed expects:
+#  - compile_fail doctests were checked when they were compiled, so they pass.
+#  - no_run doctests were compiled, so they pass without being run.
+#  - should_panic doctests pass if they exit with an error.
+#  - ignored doctests are not compiled, so they are reported as ignored.
+
+set -u
+
+readonly ZIP="$0.doctests.zip"
+readonly TMP_DIR="$(mktemp -d)"
+trap 'rm -rf "${TMP_DIR}"' EXIT
+
+unzip -qo "${ZIP}" -d "${TMP_DIR}" || exit 1
+readonly LIST="${TMP_DIR}/doctests.list"
+readonly DOCTESTS_DIR="${TMP_DIR}/doctests"
+
+# The list has a "<file> - <item> (line <line>)[ - <attribute>]: test" line
+# for each doctest.
+readonly TEST_RE='^(([^ ]+) - .* \(line ([0-9]+)\)( - (compile|compile fail|should panic))?): test$'
+
+tests=()
+while IFS= read -r line; do
+  if [[ "${line}" =~ ${TEST_RE} ]]; then
+    tests+=("${line%: test}")
+  fi
+done < "${LIST}"
+
+passed=0
+failed=0
+ignored=0
+failures=()
+
+echo
+echo "running ${#tests[@]} tests"
+for name in "${tests[@]}"; do
+  [[ "${name}: test" =~ ${TEST_RE} ]]
+  file="${BASH_REMATCH[2]}"
+  line="${BASH_REMATCH[3]}"
+  attribute="${BASH_REMATCH[5]}"
+
+  # rustdoc persists each doctest in <file>_<line>_<n>/rust_out, with the
+  # '/' and '.' of the file replaced by '_'.
+  dir_prefix="${DOCTESTS_DIR}/$(tr '/.\\' '___' <<< "${file}")_${line}_"
+  binary="$(ls -d "${dir_prefix}"*/rust_out 2>/dev/null | head -n 1)"
+
+  result=ok
+  case "${attribute}" in
+    "compile fail"|"compile")
+      ;;
+    *)
+      if [[ -z "${binary}" ]]; then
+        result=ignored
+      else
+        chmod +x "${binary}"
+        output="$("${binary}" 2>&1)"
+        status=$?
+        if [[ "${attribute}" == "should panic" ]]; then
+          [[ ${status} -ne 0 ]] || result=FAILED
+        else
+          [[ ${status} -eq 0 ]] || result=FAILED
+        fi
+        if [[ "${result}" == FAILED ]]; then
+          failures+=("---- ${name} stdout ----" "${output}" "")
+        fi
+      fi
+      ;;
+  esac
+
+  echo "test ${name} ... ${result}"
+  case "${result}" in
+    ok) passed=$((passed + 1)) ;;
+    ignored) ignored=$((ignored + 1)) ;;
+    FAILED) failed=$((failed + 1)) ;;
+  esac
+done
+echo
+
+if [[ ${failed} -ne 0 ]]; then
+  echo "failures:"
+  echo
+  printf '%s\n' "${failures[@]}"
+  echo "test result: FAILED. ${passed} passed; ${failed} failed; ${ignored} ignored; 0 measured; 0 filtered out"
+  exit 101
+fi
+echo "test result: ok. ${passed} passed; 0 failed; ${ignored} ignored; 0 measured; 0 filtered out"
@@ -0,0 +1,75 @@
+#!/bin/bash -e
+
+# Copyright 2021 Google Inc. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Script to extract the debug info of an unstripped binary into a zip file laid
+# out like a debuginfod symbol store, i.e. .build-id/xx/yyyy.debug where xxyyyy
+# is the GNU build-id of the binary. Binaries without a build-id produce an
+# empty zip file and an empty manifest.
+# Inputs:
+#  Environment:
+#   CLANG_BIN: path to the clang bin directory
+#   SOONG_ZIP: path to the soong_zip binary
+#  Arguments:
+#   -i ${file}: input unstripped file (required)
+#   -o ${file}: output zip file (required)
+#   -m ${file}: output manifest file, with a "<build-id> <module> <installed file>" line (required)
+#   -n ${name}: name of the module the binary belongs to (required)
+#   -f ${file}: path the binary is installed to, e.g. /system/bin/foo (required)
+
+set -o pipefail
+
+OPTSTRING=i:o:m:n:f:
+
+usage() {
+    cat <<EOF
+Usage: split_debug_info.sh -i in-file -o out-zip -m out-manifest -n module-name -f installed-file
+EOF
+    exit 1
+}
+
+while getopts $OPTSTRING opt; do
+    case "$opt" in
+        i) infile="${OPTARG}" ;;
+        o) outfile="${OPTARG}" ;;
+        m) manifest="${OPTARG}" ;;
+        n) module="${OPTARG}" ;;
+        f) installed="${OPTARG}" ;;
+        ?) usage ;;
+        *) echo "'${opt}' '${OPTARG}'"
+    esac
+done
+
+if [ -z "${infile}" ] || [ -z "${outfile}" ] || [ -z "${manifest}" ] || [ -z "${module}" ] || [ -z "${installed}" ]; then
+    usage
+fi
+
+tmpdir="${outfile}.tmp"
+rm -rf "${tmpdir}"
+mkdir -p "${tmpdir}"
+
+build_id=$("${CLANG_BIN}/llvm-readelf" -n "${infile}" | sed -n 's/^ *Build ID: *\([0-9a-f]*\)$/\1/p' | head -n 1)
+
+if [ -n "${build_id}" ]; then
+    debugdir="${tmpdir}/.build-id/${build_id:0:2}"
+    mkdir -p "${debugdir}"
+    "${CLANG_BIN}/llvm-objcopy" --only-keep-debug "${infile}" "${debugdir}/${build_id:2}.debug"
+    echo "${build_id} ${module} ${installed}" > "${manifest}"
+else
+    : > "${manifest}"
+fi
+
+"${SOONG_ZIP}" -o "${outfile}" -C "${tmpdir}" -D "${tmpdir}"
+rm -rf "${tmpdir}"
@@ -17,6 +17,7 @@ package sh
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -35,10 +36,23 @@ import (
 // Do not use them for prebuilt C/C++/etc files.  Use cc_prebuilt_binary
 // instead.
 
-var pctx = android.NewPackageContext("android/soong/sh")
+var (
+	pctx = android.NewPackageContext("android/soong/sh")
+
+	// The findings are written as JSON, and printed when there are any.
+	shellcheck = pctx.AndroidStaticRule("shellcheck",
+		blueprint.RuleParams{
+			Command: `$ShellcheckCmd --format=json1 $in > $out || ` +
+				`($ShellcheckCmd --format=gcc $in; exit 1)`,
+			CommandDeps: []string{"$ShellcheckCmd"},
+		})
+
+	hostToolNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.+-]+$`)
+)
 
 func init() {
 	pctx.Import("android/soong/android")
+	pctx.HostBinToolVariable("ShellcheckCmd", "shellcheck")
 
 	registerShBuildComponents(android.InitRegistrationContext)
 
@@ -102,6 +116,10 @@ type shBinaryProperties struct {
 
 	// Make this module available when building for recovery.
 	Recovery_available *bool
+
+	// Whether to check the script with shellcheck. The findings are written to
+	// <filename>.shellcheck.json and fail the build, without delaying the script.
+	Shellcheck *bool
 }
 
 // Test option struct.
@@ -152,6 +170,16 @@ type TestProperties struct {
 
 	// Test options.
 	Test_options TestOptions
+
+	// Whether to run the test with a PATH containing only the directory of the test, where the
+	// data_bins are installed, and the host tools listed in allowed_host_tools. The commands
+	// that are not found are reported on stderr, and appended to the file named by the
+	// SH_TEST_COMMANDS_NOT_FOUND_LOG environment variable if set. Only supported for host tests.
+	Hermetic_path *bool `android:"arch_variant"`
+
+	// list of tools of the host, e.g. "grep", that the test is allowed to run when hermetic_path
+	// is set, in addition to bash and sh.
+	Allowed_host_tools []string `android:"arch_variant"`
 }
 
 type ShBinary struct {
@@ -163,6 +191,9 @@ type ShBinary struct {
 	sourceFilePath android.Path
 	outputFilePath android.OutputPath
 	installedFile  android.InstallPath
+
+	// the validations of the script, run when it is copied.
+	validations android.Paths
 }
 
 var _ android.HostToolProvider = (*ShBinary)(nil)
@@ -254,12 +285,24 @@ func (s *ShBinary) generateAndroidBuildActions(ctx android.ModuleContext) {
 	}
 	s.outputFilePath = android.PathForModuleOut(ctx, filename).OutputPath
 
+	if proptools.Bool(s.properties.Shellcheck) {
+		findings := android.PathForModuleOut(ctx, filename+".shellcheck.json")
+		ctx.Build(pctx, android.BuildParams{
+			Rule:        shellcheck,
+			Description: "shellcheck " + s.sourceFilePath.Rel(),
+			Output:      findings,
+			Input:       s.sourceFilePath,
+		})
+		s.validations = append(s.validations, findings)
+	}
+
 	// This ensures that outputFilePath has the correct name for others to
 	// use, as the source file may have a different name.
 	ctx.Build(pctx, android.BuildParams{
-		Rule:   android.CpExecutable,
-		Output: s.outputFilePath,
-		Input:  s.sourceFilePath,
+		Rule:        android.CpExecutable,
+		Output:      s.outputFilePath,
+		Input:       s.sourceFilePath,
+		Validations: s.validations,
 	})
 }
 
@@ -335,8 +378,82 @@ func (s *ShTest) addToDataModules(ctx android.ModuleContext, relPath string, pat
 	s.dataModules[relPath] = path
 }
 
+// The wrapper running a test with a hermetic PATH. The allowed host tools are linked into a
+// temporary directory, and bash reports the commands that are not found through its
+// command_not_found_handle hook, which is inherited by the bash scripts run by the test.
+const hermeticPathWrapperTemplate = `#!/bin/bash
+# Runs %SCRIPT% with a PATH restricted to the tools declared by the test.
+set -u
+readonly test_dir="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+readonly tools_dir="$(mktemp -d -t sh_test_path.XXXXXX)"
+trap 'rm -rf "${tools_dir}"' EXIT
+for tool in %HOST_TOOLS%; do
+  if tool_path="$(command -v "${tool}")"; then
+    ln -s "${tool_path}" "${tools_dir}/${tool}"
+  else
+    echo "%NAME%: allowed host tool ${tool} is not installed" >&2
+  fi
+done
+command_not_found_handle() {
+  echo "%NAME%: $1: command not found, it must be in data_bins or allowed_host_tools" >&2
+  if [[ -n "${SH_TEST_COMMANDS_NOT_FOUND_LOG:-}" ]]; then
+    echo "$1" >> "${SH_TEST_COMMANDS_NOT_FOUND_LOG}"
+  fi
+  return 127
+}
+export -f command_not_found_handle
+PATH="${test_dir}:${tools_dir}" "${test_dir}/%SCRIPT%" "$@"
+`
+
+// generateHermeticPathWrapper registers build actions to install the test script next to a
+// wrapper running it with a hermetic PATH, and returns the wrapper.
+func (s *ShTest) generateHermeticPathWrapper(ctx android.ModuleContext) android.OutputPath {
+	tools := append([]string{"bash", "sh"}, s.testProperties.Allowed_host_tools...)
+	for _, tool := range s.testProperties.Allowed_host_tools {
+		if !hostToolNameRegexp.MatchString(tool) {
+			ctx.PropertyErrorf("allowed_host_tools", "%q is not a valid tool name", tool)
+		}
+	}
+
+	filename := s.outputFilePath.Base()
+	script := android.PathForModuleOut(ctx, "hermetic", filename+".script")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   android.CpExecutable,
+		Output: script,
+		Input:  s.sourceFilePath,
+	})
+	s.addToDataModules(ctx, script.Base(), script)
+
+	wrapperContents := strings.NewReplacer(
+		"%SCRIPT%", script.Base(),
+		"%NAME%", ctx.ModuleName(),
+		"%HOST_TOOLS%", strings.Join(android.FirstUniqueStrings(tools), " "),
+	).Replace(hermeticPathWrapperTemplate)
+	wrapperSrc := android.PathForModuleOut(ctx, "hermetic", filename+".wrapper")
+	android.WriteFileRule(ctx, wrapperSrc, wrapperContents)
+
+	// The wrapper is installed with the name of the script, keep it as the relative path.
+	wrapper := android.PathForModuleOut(ctx, "hermetic").OutputPath.Join(ctx, filename)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        android.CpExecutable,
+		Output:      wrapper,
+		Input:       wrapperSrc,
+		Implicit:    script,
+		Validations: s.validations,
+	})
+	return wrapper
+}
+
 func (s *ShTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	s.ShBinary.generateAndroidBuildActions(ctx)
+	s.dataModules = make(map[string]android.Path)
+	if Bool(s.testProperties.Hermetic_path) {
+		if ctx.Host() {
+			s.outputFilePath = s.generateHermeticPathWrapper(ctx)
+		} else {
+			ctx.PropertyErrorf("hermetic_path", "only supported for host tests")
+		}
+	}
 	testDir := "nativetest"
 	if ctx.Target().Arch.ArchType.Multilib == "lib64" {
 		testDir = "nativetest64"
@@ -376,7 +493,6 @@ func (s *ShTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	s.testConfig = tradefed.AutoGenShellTestConfig(ctx, s.testProperties.Test_config,
 		s.testProperties.Test_config_template, s.testProperties.Test_suites, configs, s.testProperties.Auto_gen_config, s.outputFilePath.Base())
 
-	s.dataModules = make(map[string]android.Path)
 	ctx.VisitDirectDeps(func(dep android.Module) {
 		depTag := ctx.OtherModuleDependencyTag(dep)
 		switch depTag {
@@ -209,3 +209,54 @@ func TestShTestHost_dataDeviceModules(t *testing.T) {
 	actualData := entries.EntryMap["LOCAL_TEST_DATA"]
 	android.AssertStringPathsRelativeToTopEquals(t, "LOCAL_TEST_DATA", config, expectedData, actualData)
 }
+
+func TestShTestHost_hermeticPath(t *testing.T) {
+	result := prepareForShTest.RunTestWithBp(t, `
+		sh_test_host {
+			name: "foo",
+			src: "test.sh",
+			hermetic_path: true,
+			allowed_host_tools: ["grep", "sed"],
+			shellcheck: true,
+		}
+	`)
+
+	buildOS := result.Config.BuildOS.String()
+	variant := result.ModuleForTests("foo", buildOS+"_x86_64")
+
+	wrapper := variant.Output("out/soong/.intermediates/foo/" + buildOS + "_x86_64/hermetic/foo")
+	android.AssertPathRelativeToTopEquals(t, "wrapper input",
+		"out/soong/.intermediates/foo/"+buildOS+"_x86_64/hermetic/foo.wrapper", wrapper.Input)
+	android.AssertPathsRelativeToTopEquals(t, "wrapper validations", []string{
+		"out/soong/.intermediates/foo/" + buildOS + "_x86_64/foo.shellcheck.json",
+	}, wrapper.Validations)
+
+	contents := android.ContentFromFileRuleForTests(t, variant.Output("hermetic/foo.wrapper"))
+	android.AssertStringDoesContain(t, "wrapper tools", contents, "for tool in bash sh grep sed; do")
+	android.AssertStringDoesContain(t, "wrapper script", contents, `"${test_dir}/foo.script" "$@"`)
+
+	mod := variant.Module().(*ShTest)
+	entries := android.AndroidMkEntriesForTest(t, result.TestContext, mod)[0]
+	android.AssertPathRelativeToTopEquals(t, "LOCAL_PREBUILT_MODULE_FILE",
+		"out/soong/.intermediates/foo/"+buildOS+"_x86_64/hermetic/foo", entries.OutputFile.Path())
+	android.AssertStringEquals(t, "LOCAL_MODULE_STEM", "foo", entries.EntryMap["LOCAL_MODULE_STEM"][0])
+	android.AssertStringPathsRelativeToTopEquals(t, "LOCAL_TEST_DATA", result.Config, []string{
+		"out/soong/.intermediates/foo/" + buildOS + "_x86_64/hermetic/:foo.script",
+	}, entries.EntryMap["LOCAL_TEST_DATA"])
+
+	shellcheck := variant.Rule("shellcheck")
+	android.AssertPathRelativeToTopEquals(t, "shellcheck input", "test.sh", shellcheck.Input)
+}
+
+func TestShTest_hermeticPathDevice(t *testing.T) {
+	prepareForShTest.
+		ExtendWithErrorHandler(android.FixtureExpectsAtLeastOneErrorMatchingPattern(
+			`hermetic_path: only supported for host tests`)).
+		RunTestWithBp(t, `
+			sh_test {
+				name: "foo",
+				src: "test.sh",
+				hermetic_path: true,
+			}
+		`)
+}